@@ -1,16 +1,30 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
-	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/metrics"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rest"
 	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
-	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rls"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -19,61 +33,157 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	addr := fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port)
-	fixedWindowRdbClient := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.FixedWindowDb,
-	})
-	tokenBucketRdbClient := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.TokenBucketDb,
-	})
+	// Each algorithm keeps its state in the backend picked in the storage
+	// section of config.yaml; Redis is only dialled for the ones using it.
+	repos := storage.NewFactory(cfg)
 
-	// Uncomment this 2 line if you want to use in memory store
-	// fixedWindowMemoryRepo := memory.NewFixedWindowRepository()
-	// fixedWindowSvc := service.NewFixedWindowService(fixedWindowMemoryRepo, cfg.RateLimiter.FixedWindow)
+	// Decisions and store latencies are exported on /metrics.
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(reg)
+	repos.SetMetrics(m)
 
-	// Uncomment this 2 line if you want to use redis store
-	fixedWindowRedisRepo := rdb.NewFixedWindowRepository(fixedWindowRdbClient)
-	fixedWindowSvc := service.NewFixedWindowService(fixedWindowRedisRepo, cfg.RateLimiter.FixedWindow)
-
-	// Uncomment this 2 line if you want to use in memory store
-	// tokenBucketMemoryRepo := memory.NewTokenBucketRepository()
-	// tokenBucketSvc := service.NewTokenBucketService(tokenBucketMemoryRepo, cfg.RateLimiter.TokenBucket)
+	// Every limit comes from the policies section of config.yaml; a route
+	// gets the middleware of each policy matching its method and path.
+	policies, err := policy.New(cfg, repos, policy.WithMetrics(m))
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Uncomment this 2 line if you want to use redis store
-	tokenBucketRedisRepo := rdb.NewTokenBucketRepository(
-		tokenBucketRdbClient,
-		cfg.RateLimiter.TokenBucket.MaxTokens,
-		cfg.RateLimiter.TokenBucket.RefillRate,
-	)
-	tokenBucketSvc := service.NewTokenBucketService(tokenBucketRedisRepo, cfg.RateLimiter.TokenBucket)
+	// Limits follow config.yaml while the server runs. A config that does not
+	// load, or that changes policies in more than their limits, is rejected
+	// and the running limits stay in place. Changes to the sections read at
+	// startup, such as server or redis, are logged as waiting for a restart.
+	err = config.Watch(func(newCfg *config.Config, err error) {
+		if err == nil {
+			err = policies.Reload(newCfg)
+		}
+		if err != nil {
+			log.Printf("config reload rejected, keeping current limits: %v", err)
+			return
+		}
+		log.Printf("config reloaded, limits of %d policies updated", len(newCfg.Policies))
+		if sections := cfg.RestartSections(newCfg); len(sections) > 0 {
+			log.Printf("config sections %s changed and need a restart to apply", strings.Join(sections, ", "))
+		}
+	})
+	if err != nil {
+		log.Printf("config hot reload disabled: %v", err)
+	}
 
 	pingHdl := rest.NewPingHandler()
 
 	r := gin.Default()
 
-	r.GET("/fw/apikey/ping", middleware.RateLimit(fixedWindowSvc, func(c *gin.Context) string {
-		return c.GetHeader("X-API-Key")
-	}), pingHdl.Ping)
+	// Probes and metrics are registered on the engine directly rather than
+	// through route, so no policy ever limits them.
+	healthHdl := rest.NewHealthHandler(repos, policies)
+	r.GET("/healthz", healthHdl.Healthz)
+	r.GET("/readyz", healthHdl.Readyz)
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
 
-	r.GET("/fw/ipaddress/ping", middleware.RateLimit(fixedWindowSvc, func(c *gin.Context) string {
-		return c.ClientIP()
-	}), pingHdl.Ping)
+	route := func(method, path string, handler gin.HandlerFunc) {
+		r.Handle(method, path, append(policies.Middleware(method, path), handler)...)
+	}
 
-	r.GET("/tb/apikey/ping", middleware.RateLimit(tokenBucketSvc, func(c *gin.Context) string {
-		return c.GetHeader("X-API-Key")
-	}), pingHdl.Ping)
+	for _, prefix := range []string{"/fw", "/tb", "/swl", "/swc", "/gcra", "/lb", "/cc"} {
+		route(http.MethodGet, prefix+"/apikey/ping", pingHdl.Ping)
+		route(http.MethodGet, prefix+"/ipaddress/ping", pingHdl.Ping)
+	}
+	route(http.MethodPost, "/tb/apikey/bulk", pingHdl.Ping)
 
-	r.GET("/tb/ipaddress/ping", middleware.RateLimit(tokenBucketSvc, func(c *gin.Context) string {
-		return c.ClientIP()
-	}), pingHdl.Ping)
+	// The admin API inspects, resets and overrides client limits. It is only
+	// served when a token is configured.
+	if cfg.Admin.Token != "" {
+		adminHdl := rest.NewAdminHandler(policies)
+		admin := r.Group("/admin/policies/:policy/clients", middleware.BearerAuth(cfg.Admin.Token))
+		admin.GET("", adminHdl.Clients)
+		admin.GET("/:key", adminHdl.State)
+		admin.DELETE("/:key", adminHdl.Reset)
+		admin.PUT("/:key/override", adminHdl.Override)
+		admin.DELETE("/:key/override", adminHdl.ClearOverride)
+	}
 
-	addr = fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Server listening on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatal(err)
+	// The decision API answers for other services, so it is not limited by
+	// the policies it applies either. Like the admin API it is only served
+	// when a token is configured, since it shares the public port.
+	if cfg.DecisionAPI.Token != "" {
+		decisionHdl := rest.NewDecisionHandler(policies)
+		r.POST("/v1/ratelimit/check", middleware.BearerAuth(cfg.DecisionAPI.Token), decisionHdl.Check)
 	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
+		Handler:      r,
+		ReadTimeout:  millis(cfg.Server.ReadTimeoutMs),
+		WriteTimeout: millis(cfg.Server.WriteTimeoutMs),
+		IdleTimeout:  millis(cfg.Server.IdleTimeoutMs),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 2)
+	go func() {
+		log.Printf("Server listening on %s", srv.Addr)
+		served <- srv.ListenAndServe()
+	}()
+
+	// Envoy calls the descriptor policies through its rate limit service API
+	// on a separate gRPC port.
+	var rlsSrv *grpc.Server
+	if cfg.RLS.Port != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.RLS.Port))
+		if err != nil {
+			log.Fatalf("failed to listen for the rate limit service: %v", err)
+		}
+		rlsSrv = grpc.NewServer()
+		rlsv3.RegisterRateLimitServiceServer(rlsSrv, rls.NewServer(cfg.RLS, cfg.Policies, policies))
+		go func() {
+			log.Printf("Rate limit service listening on %s", lis.Addr())
+			served <- rlsSrv.Serve(lis)
+		}()
+	}
+
+	failed := false
+	select {
+	case err := <-served:
+		log.Printf("server failed: %v", err)
+		failed = true
+	case <-ctx.Done():
+		// A second signal kills the process without waiting for the drain.
+		stop()
+		drain := millis(cfg.Server.ShutdownTimeoutMs)
+		log.Printf("shutting down, draining requests for up to %s", drain)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+		if rlsSrv != nil {
+			go func() {
+				<-shutdownCtx.Done()
+				rlsSrv.Stop()
+			}()
+		}
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("requests still running after the drain period: %v", err)
+		}
+		if rlsSrv != nil {
+			// GracefulStop returns early once the drain period ends and the
+			// goroutine above cuts the remaining calls off.
+			rlsSrv.GracefulStop()
+		}
+	}
+
+	// Only now that no request uses them can the Redis clients go.
+	if err := repos.Close(); err != nil {
+		log.Printf("failed to close redis clients: %v", err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	log.Printf("server stopped")
+}
+
+func millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
 }
@@ -1,49 +1,220 @@
 package config
 
 import (
+	"path/filepath"
+	"reflect"
+	"strings"
+
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	Server      Server      `mapstructure:"server"`
 	Redis       Redis       `mapstructure:"redis"`
+	Storage     Storage     `mapstructure:"storage"`
 	RateLimiter RateLimiter `mapstructure:"rate-limiter"`
+	Policies    []Policy    `mapstructure:"policies"`
+	Tiers       []Tier      `mapstructure:"tiers"`
+	Clients     []Client    `mapstructure:"clients"`
+	Admin       Admin       `mapstructure:"admin"`
+	DecisionAPI DecisionAPI `mapstructure:"decision-api"`
+	RLS         RLS         `mapstructure:"rls"`
 }
 
+// Server configures the HTTP server. The timeouts bound reading a request,
+// writing its response and keeping an idle connection open. ShutdownTimeoutMs
+// is how long running requests get to finish after SIGINT or SIGTERM.
 type Server struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host              string `mapstructure:"host"`
+	Port              int    `mapstructure:"port"`
+	ReadTimeoutMs     int    `mapstructure:"read-timeout-ms"`
+	WriteTimeoutMs    int    `mapstructure:"write-timeout-ms"`
+	IdleTimeoutMs     int    `mapstructure:"idle-timeout-ms"`
+	ShutdownTimeoutMs int    `mapstructure:"shutdown-timeout-ms"`
+}
+
+// Admin configures the admin API. It is disabled while Token is empty.
+type Admin struct {
+	Token string `mapstructure:"token"`
 }
 
+// DecisionAPI configures POST /v1/ratelimit/check. Callers need Token as a
+// bearer token; the API is disabled while it is empty.
+type DecisionAPI struct {
+	Token string `mapstructure:"token"`
+}
+
+// RLS configures the gRPC server implementing Envoy's rate limit service. It
+// is disabled while Port is zero. Requests for a domain other than Domain are
+// rejected; an empty Domain accepts every domain.
+type RLS struct {
+	Port   int    `mapstructure:"port"`
+	Domain string `mapstructure:"domain"`
+}
+
+// How the server connects to Redis.
+const (
+	// RedisModeStandalone connects to the single server at Host and Port. It
+	// is the default.
+	RedisModeStandalone = "standalone"
+	// RedisModeSentinel asks the sentinels at Addrs for the current master
+	// of MasterName and follows failovers.
+	RedisModeSentinel = "sentinel"
+	// RedisModeCluster connects to the cluster the nodes at Addrs belong to.
+	// A cluster only has database 0, so the per-algorithm databases are
+	// ignored and every algorithm shares it.
+	RedisModeCluster = "cluster"
+)
+
+// Redis configures the connection to Redis. Username and Password
+// authenticate to the data nodes; SentinelPassword, when set, to the
+// sentinels. PoolSize and MinIdleConns size the connection pool of each
+// client, zero keeping the go-redis defaults.
+//
+// KeySchema lays out the key of each client, with the placeholders {prefix}
+// for KeyPrefix, {algorithm}, {policy} and {clientID}. Left empty, the Redis
+// repositories use rdb.DefaultKeySchema, which lets algorithms, and services
+// using different prefixes, share one database.
 type Redis struct {
-	Host          string `mapstructure:"host"`
-	Port          int    `mapstructure:"port"`
-	Password      string `mapstructure:"password"`
-	FixedWindowDb int    `mapstructure:"fixed-window-db"`
-	TokenBucketDb int    `mapstructure:"token-bucket-db"`
+	Mode             string   `mapstructure:"mode"`
+	Host             string   `mapstructure:"host"`
+	Port             int      `mapstructure:"port"`
+	Addrs            []string `mapstructure:"addrs"`
+	MasterName       string   `mapstructure:"master-name"`
+	Username         string   `mapstructure:"username"`
+	Password         string   `mapstructure:"password"`
+	SentinelPassword string   `mapstructure:"sentinel-password"`
+	TLS              RedisTLS `mapstructure:"tls"`
+	PoolSize         int      `mapstructure:"pool-size"`
+	MinIdleConns     int      `mapstructure:"min-idle-conns"`
+	KeyPrefix        string   `mapstructure:"key-prefix"`
+	KeySchema        string   `mapstructure:"key-schema"`
+
+	FixedWindowDb          int `mapstructure:"fixed-window-db"`
+	TokenBucketDb          int `mapstructure:"token-bucket-db"`
+	SlidingWindowLogDb     int `mapstructure:"sliding-window-log-db"`
+	SlidingWindowCounterDb int `mapstructure:"sliding-window-counter-db"`
+	GCRADb                 int `mapstructure:"gcra-db"`
+	LeakyBucketDb          int `mapstructure:"leaky-bucket-db"`
+	ConcurrencyDb          int `mapstructure:"concurrency-db"`
+
+	CircuitBreaker CircuitBreaker `mapstructure:"circuit-breaker"`
+}
+
+// RedisTLS turns on TLS to Redis, verified against the system roots unless
+// InsecureSkipVerify is set. ServerName overrides the name checked in the
+// certificate.
+type RedisTLS struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	ServerName         string `mapstructure:"server-name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"`
+}
+
+// CircuitBreaker stops sending commands to Redis after Failures consecutive
+// failed ones, for CooldownMs, after which a single command probes whether
+// Redis is back. A Failures of zero turns the breaker off.
+type CircuitBreaker struct {
+	Failures   int `mapstructure:"failures"`
+	CooldownMs int `mapstructure:"cooldown-ms"`
+}
+
+// Storage backends an algorithm can keep its state in.
+const (
+	StorageMemory = "memory"
+	StorageRedis  = "redis"
+)
+
+// Algorithm names, as used for the keys of the storage and rate-limiter
+// sections and for the algorithm of a policy.
+const (
+	AlgorithmFixedWindow          = "fixed-window"
+	AlgorithmTokenBucket          = "token-bucket"
+	AlgorithmSlidingWindowLog     = "sliding-window-log"
+	AlgorithmSlidingWindowCounter = "sliding-window-counter"
+	AlgorithmGCRA                 = "gcra"
+	AlgorithmLeakyBucket          = "leaky-bucket"
+	AlgorithmConcurrency          = "concurrency"
+)
+
+var algorithms = []string{
+	AlgorithmFixedWindow, AlgorithmTokenBucket, AlgorithmSlidingWindowLog, AlgorithmSlidingWindowCounter,
+	AlgorithmGCRA, AlgorithmLeakyBucket, AlgorithmConcurrency,
+}
+
+// Storage picks the backend of each algorithm. Every field is either
+// StorageMemory or StorageRedis and defaults to StorageRedis.
+type Storage struct {
+	FixedWindow          string `mapstructure:"fixed-window"`
+	TokenBucket          string `mapstructure:"token-bucket"`
+	SlidingWindowLog     string `mapstructure:"sliding-window-log"`
+	SlidingWindowCounter string `mapstructure:"sliding-window-counter"`
+	GCRA                 string `mapstructure:"gcra"`
+	LeakyBucket          string `mapstructure:"leaky-bucket"`
+	Concurrency          string `mapstructure:"concurrency"`
+
+	Memory MemoryStorage `mapstructure:"memory"`
+}
+
+// MemoryStorage bounds the in-memory fixed-window and token-bucket stores.
+// Entries expire like the Redis keys would; a janitor removes expired ones
+// every JanitorIntervalMs and, when MaxEntries is set, the least recently
+// used client is evicted to make room for a new one. Zero turns either off.
+type MemoryStorage struct {
+	JanitorIntervalMs int `mapstructure:"janitor-interval-ms"`
+	MaxEntries        int `mapstructure:"max-entries"`
 }
 
 type RateLimiter struct {
-	FixedWindow FixedWindow `mapstructure:"fixed-window"`
-	TokenBucket TokenBucket `mapstructure:"token-bucket"`
+	HeaderStyle          string               `mapstructure:"header-style"`
+	FixedWindow          FixedWindow          `mapstructure:"fixed-window"`
+	TokenBucket          TokenBucket          `mapstructure:"token-bucket"`
+	SlidingWindowLog     SlidingWindowLog     `mapstructure:"sliding-window-log"`
+	SlidingWindowCounter SlidingWindowCounter `mapstructure:"sliding-window-counter"`
+	GCRA                 GCRA                 `mapstructure:"gcra"`
+	LeakyBucket          LeakyBucket          `mapstructure:"leaky-bucket"`
+	Concurrency          Concurrency          `mapstructure:"concurrency"`
 }
 
 type FixedWindow struct {
-	MaxRequests int `mapstructure:"max-requests"`
-	TimeFrameMs int `mapstructure:"time-frame-ms"`
+	MaxRequests int `mapstructure:"max-requests" json:"max-requests"`
+	TimeFrameMs int `mapstructure:"time-frame-ms" json:"time-frame-ms"`
 }
 
 type TokenBucket struct {
-	MaxTokens  float64 `mapstructure:"max-tokens"`
-	RefillRate float64 `mapstructure:"refill-rate"`
+	MaxTokens  float64 `mapstructure:"max-tokens" json:"max-tokens"`
+	RefillRate float64 `mapstructure:"refill-rate" json:"refill-rate"`
+}
+
+type SlidingWindowLog struct {
+	MaxRequests int `mapstructure:"max-requests" json:"max-requests"`
+	TimeFrameMs int `mapstructure:"time-frame-ms" json:"time-frame-ms"`
+}
+
+type SlidingWindowCounter struct {
+	MaxRequests int `mapstructure:"max-requests" json:"max-requests"`
+	TimeFrameMs int `mapstructure:"time-frame-ms" json:"time-frame-ms"`
+}
+
+type GCRA struct {
+	Rate  float64 `mapstructure:"rate" json:"rate"`
+	Burst int     `mapstructure:"burst" json:"burst"`
+}
+
+type LeakyBucket struct {
+	LeakRate  float64 `mapstructure:"leak-rate" json:"leak-rate"`
+	Capacity  int     `mapstructure:"capacity" json:"capacity"`
+	MaxWaitMs int     `mapstructure:"max-wait-ms" json:"max-wait-ms"`
+}
+
+type Concurrency struct {
+	MaxInFlight int `mapstructure:"max-in-flight" json:"max-in-flight"`
+	LeaseTTLMs  int `mapstructure:"lease-ttl-ms" json:"lease-ttl-ms"`
 }
 
 func Load() (*Config, error) {
-	v := viper.New()
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-	v.AddConfigPath(".")
+	v := newViper()
 
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -56,5 +227,185 @@ func Load() (*Config, error) {
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, domain.WrapError(err, domain.ErrUnknown, "failed to unmarshal config")
 	}
+
+	if err := config.Redis.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Storage.validate(); err != nil {
+		return nil, err
+	}
+	if err := validatePolicies(config.Policies, config.RateLimiter); err != nil {
+		return nil, err
+	}
+	if err := validateTiers(config.Tiers, config.Clients); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
+
+// Watch loads the config file again every time it is written or replaced and
+// passes the outcome of Load to onChange. Callbacks run one at a time on the
+// watcher's goroutine. The directory is watched rather than the file, so the
+// watch survives editors that save by writing a new file and renaming it over
+// the old one, and a ConfigMap swapping the symlink the file resolves through.
+func Watch(onChange func(*Config, error)) error {
+	v := newViper()
+	if err := v.ReadInConfig(); err != nil {
+		return domain.WrapError(err, domain.ErrUnknown, "failed to find config file to watch")
+	}
+	file := filepath.Clean(v.ConfigFileUsed())
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return domain.WrapError(err, domain.ErrUnknown, "failed to create config watcher")
+	}
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return domain.WrapError(err, domain.ErrUnknown, "failed to watch config directory")
+	}
+
+	go func() {
+		defer watcher.Close()
+		target, _ := filepath.EvalSymlinks(file)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// A removed or renamed file needs nothing: the directory
+				// stays watched and the file coming back is a Create.
+				current, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create))
+				if written || (current != "" && current != target) {
+					target = current
+					onChange(Load())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				onChange(nil, domain.WrapError(err, domain.ErrUnknown, "config watcher failed"))
+			}
+		}
+	}()
+	return nil
+}
+
+// RestartSections returns the sections that differ between c and next and
+// only take effect on a restart: server, redis, storage, storage.memory,
+// admin, decision-api and rls. Everything else is applied by a reload.
+func (c *Config) RestartSections(next *Config) []string {
+	storage, nextStorage := c.Storage, next.Storage
+	storage.Memory, nextStorage.Memory = MemoryStorage{}, MemoryStorage{}
+
+	sections := []struct {
+		name       string
+		old, fresh any
+	}{
+		{"server", c.Server, next.Server},
+		{"redis", c.Redis, next.Redis},
+		{"storage", storage, nextStorage},
+		{"storage.memory", c.Storage.Memory, next.Storage.Memory},
+		{"admin", c.Admin, next.Admin},
+		{"decision-api", c.DecisionAPI, next.DecisionAPI},
+		{"rls", c.RLS, next.RLS},
+	}
+	var changed []string
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.fresh) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(".")
+
+	for _, algorithm := range algorithms {
+		v.SetDefault("storage."+algorithm, StorageRedis)
+	}
+	v.SetDefault("storage.memory.janitor-interval-ms", 60000)
+	v.SetDefault("server.read-timeout-ms", 10000)
+	v.SetDefault("server.write-timeout-ms", 30000)
+	v.SetDefault("server.idle-timeout-ms", 60000)
+	v.SetDefault("server.shutdown-timeout-ms", 15000)
+	v.SetDefault("redis.mode", RedisModeStandalone)
+	v.SetDefault("redis.key-prefix", "ratelimit")
+	v.SetDefault("redis.circuit-breaker.failures", 5)
+	v.SetDefault("redis.circuit-breaker.cooldown-ms", 5000)
+	// The API tokens are better kept out of config.yaml.
+	v.BindEnv("admin.token", "ADMIN_TOKEN")
+	v.BindEnv("decision-api.token", "DECISION_API_TOKEN")
+	return v
+}
+
+func (r Redis) validate() error {
+	switch r.Mode {
+	case RedisModeStandalone:
+	case RedisModeSentinel:
+		if r.MasterName == "" || len(r.Addrs) == 0 {
+			return domain.NewError(domain.ErrInvalidArgument, "redis sentinel mode needs a master-name and the sentinel addrs")
+		}
+	case RedisModeCluster:
+		if len(r.Addrs) == 0 {
+			return domain.NewError(domain.ErrInvalidArgument, "redis cluster mode needs the addrs of some cluster nodes")
+		}
+	default:
+		return domain.NewError(domain.ErrInvalidArgument, "unknown redis mode %q, expected %q, %q or %q",
+			r.Mode, RedisModeStandalone, RedisModeSentinel, RedisModeCluster)
+	}
+	if r.PoolSize < 0 || r.MinIdleConns < 0 {
+		return domain.NewError(domain.ErrInvalidArgument, "redis pool sizes cannot be negative")
+	}
+	return r.validateKeys()
+}
+
+// keyPlaceholders are the placeholders a redis key-schema may use.
+var keyPlaceholders = strings.NewReplacer("{prefix}", "", "{algorithm}", "", "{policy}", "", "{clientID}", "")
+
+// validateKeys checks that the key schema gives every client its own key and
+// that braces only appear around the client ID, which Redis Cluster hashes on.
+func (r Redis) validateKeys() error {
+	if r.KeySchema != "" && strings.Count(r.KeySchema, "{clientID}") != 1 {
+		return domain.NewError(domain.ErrInvalidArgument, "redis key-schema %q must contain {clientID} once", r.KeySchema)
+	}
+	if strings.ContainsAny(keyPlaceholders.Replace(r.KeySchema), "{}") {
+		return domain.NewError(domain.ErrInvalidArgument,
+			"redis key-schema %q may only use the placeholders {prefix}, {algorithm}, {policy} and {clientID}", r.KeySchema)
+	}
+	if strings.ContainsAny(r.KeyPrefix, "{}") {
+		return domain.NewError(domain.ErrInvalidArgument, "redis key-prefix %q cannot contain braces", r.KeyPrefix)
+	}
+	return nil
+}
+
+func (s Storage) validate() error {
+	backends := []struct {
+		algorithm string
+		backend   string
+	}{
+		{AlgorithmFixedWindow, s.FixedWindow},
+		{AlgorithmTokenBucket, s.TokenBucket},
+		{AlgorithmSlidingWindowLog, s.SlidingWindowLog},
+		{AlgorithmSlidingWindowCounter, s.SlidingWindowCounter},
+		{AlgorithmGCRA, s.GCRA},
+		{AlgorithmLeakyBucket, s.LeakyBucket},
+		{AlgorithmConcurrency, s.Concurrency},
+	}
+
+	for _, b := range backends {
+		if b.backend != StorageMemory && b.backend != StorageRedis {
+			return domain.NewError(domain.ErrInvalidArgument,
+				"unknown storage backend %q for %s, expected %q or %q", b.backend, b.algorithm, StorageMemory, StorageRedis)
+		}
+	}
+	if s.Memory.JanitorIntervalMs < 0 || s.Memory.MaxEntries < 0 {
+		return domain.NewError(domain.ErrInvalidArgument, "storage.memory settings cannot be negative")
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package config_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
@@ -34,6 +37,57 @@ rate-limiter:
     time-frame-ms: 1000
 `
 
+var storageYAML = `
+storage:
+  fixed-window: memory
+  gcra: redis
+  memory: { max-entries: 100000 }
+`
+
+var invalidStorageYAML = `
+storage:
+  token-bucket: postgres
+`
+
+var policiesYAML = `
+rate-limiter:
+  fixed-window:
+    max-requests: 5
+    time-frame-ms: 1000
+policies:
+  - name: fw-apikey
+    algorithm: fixed-window
+    key: { source: header, name: X-API-Key }
+    match: { methods: [GET], path: /fw/* }
+  - name: tb-bulk
+    algorithm: token-bucket
+    key: { source: ip }
+    cost: { body-bytes-per-unit: 1024 }
+    token-bucket:
+      max-tokens: 8
+      refill-rate: 2
+`
+
+var tiersYAML = `
+tiers:
+  - name: free
+    fixed-window: { max-requests: 5, time-frame-ms: 60000 }
+  - name: enterprise
+    fixed-window: { max-requests: 500, time-frame-ms: 60000 }
+    token-bucket: { max-tokens: 100, refill-rate: 50 }
+clients:
+  - key: Partner-ABC
+    tier: enterprise
+  - key: partner-xyz
+    tier: free
+    fixed-window: { max-requests: 20, time-frame-ms: 60000 }
+`
+
+var gcraDefaultsYAML = `
+rate-limiter:
+  gcra: { rate: 1, burst: 2 }
+`
+
 func withTempConfig(t *testing.T, content string, fn func()) {
 	dir := t.TempDir()
 	configPath := filepath.Join(dir, "config.yaml")
@@ -68,6 +122,9 @@ func TestLoad_ValidConfig(t *testing.T) {
 		if cfg.RateLimiter.FixedWindow.TimeFrameMs != 1000 {
 			t.Errorf("expected time-frame-ms=1000, got %d", cfg.RateLimiter.FixedWindow.TimeFrameMs)
 		}
+		if cfg.Server.WriteTimeoutMs != 30000 || cfg.Server.ShutdownTimeoutMs != 15000 {
+			t.Errorf("expected default server timeouts, got %+v", cfg.Server)
+		}
 	})
 }
 
@@ -127,3 +184,440 @@ func TestLoad_ConfigFileNotFound(t *testing.T) {
 		t.Errorf("expected error code ErrNotFound, got %v", e.Code())
 	}
 }
+
+func TestLoad_Storage(t *testing.T) {
+	withTempConfig(t, storageYAML, func() {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("expected Load to succeed, got error: %v", err)
+		}
+
+		if cfg.Storage.FixedWindow != config.StorageMemory {
+			t.Errorf("expected fixed-window=memory, got %s", cfg.Storage.FixedWindow)
+		}
+		if cfg.Storage.GCRA != config.StorageRedis {
+			t.Errorf("expected gcra=redis, got %s", cfg.Storage.GCRA)
+		}
+		if cfg.Storage.TokenBucket != config.StorageRedis {
+			t.Errorf("expected token-bucket to default to redis, got %s", cfg.Storage.TokenBucket)
+		}
+		if m := cfg.Storage.Memory; m.MaxEntries != 100000 || m.JanitorIntervalMs != 60000 {
+			t.Errorf("expected max-entries=100000 and the default janitor interval, got %+v", m)
+		}
+	})
+}
+
+func TestLoad_InvalidStorage(t *testing.T) {
+	withTempConfig(t, invalidStorageYAML, func() {
+		_, err := config.Load()
+		if err == nil {
+			t.Fatal("expected Load to fail due to unknown storage backend")
+		}
+
+		e, ok := err.(*domain.Error)
+		if !ok {
+			t.Fatalf("expected *domain.Error, got %T", err)
+		}
+
+		if e.Code() != domain.ErrInvalidArgument {
+			t.Errorf("expected error code ErrInvalidArgument, got %v", e.Code())
+		}
+	})
+}
+
+func TestLoad_Policies(t *testing.T) {
+	withTempConfig(t, policiesYAML, func() {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("expected Load to succeed, got error: %v", err)
+		}
+
+		if len(cfg.Policies) != 2 {
+			t.Fatalf("expected 2 policies, got %d", len(cfg.Policies))
+		}
+		fw := cfg.Policies[0]
+		if fw.Key.Source != config.KeySourceHeader || fw.Key.Name != "X-API-Key" {
+			t.Errorf("unexpected key %+v", fw.Key)
+		}
+		if fw.Match.Path != "/fw/*" || len(fw.Match.Methods) != 1 || fw.Match.Methods[0] != "GET" {
+			t.Errorf("unexpected match %+v", fw.Match)
+		}
+		if fw.FixedWindow != nil {
+			t.Errorf("expected no fixed-window block, got %+v", *fw.FixedWindow)
+		}
+
+		tb := cfg.Policies[1]
+		if tb.TokenBucket == nil || tb.TokenBucket.MaxTokens != 8 || tb.TokenBucket.RefillRate != 2 {
+			t.Errorf("unexpected token-bucket block %+v", tb.TokenBucket)
+		}
+		if tb.Cost.BodyBytesPerUnit != 1024 {
+			t.Errorf("expected body-bytes-per-unit=1024, got %d", tb.Cost.BodyBytesPerUnit)
+		}
+	})
+}
+
+func TestLoad_InvalidPolicies(t *testing.T) {
+	tests := map[string]string{
+		"missing name": `
+policies:
+  - algorithm: gcra
+    key: { source: ip }
+`,
+		"duplicate name": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: ip } }
+  - { name: a, algorithm: gcra, key: { source: ip } }
+`,
+		"unknown algorithm": `
+policies:
+  - { name: a, algorithm: bogus, key: { source: ip } }
+`,
+		"unknown key source": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: cookie } }
+`,
+		"unknown on-error": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: ip }, on-error: retry }
+`,
+		"header without name": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: header } }
+`,
+		"two costs": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: ip }, cost: { fixed: 2, header: X-Cost } }
+`,
+		"max without header or body": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: ip }, cost: { fixed: 2, max: 10 } }
+`,
+		"negative max": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: ip }, cost: { header: X-Cost, max: -1 } }
+`,
+		"concurrency with cost": `
+policies:
+  - { name: a, algorithm: concurrency, key: { source: ip }, cost: { fixed: 2 } }
+`,
+		"descriptor with match": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: descriptor, name: remote_address }, match: { path: /a } }
+`,
+		"descriptor with cost": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: descriptor, name: remote_address }, cost: { fixed: 2 } }
+`,
+		"concurrency descriptor": `
+policies:
+  - { name: a, algorithm: concurrency, key: { source: descriptor, name: remote_address } }
+`,
+		"duplicate descriptor": `
+policies:
+  - { name: a, algorithm: gcra, key: { source: descriptor, name: remote_address } }
+  - { name: b, algorithm: gcra, key: { source: descriptor, name: remote_address } }
+`,
+		"zero default limit": `
+policies:
+  - { name: a, algorithm: fixed-window, key: { source: ip } }
+`,
+		"zero policy limit": `
+policies:
+  - name: a
+    algorithm: gcra
+    key: { source: ip }
+    gcra: { rate: 0, burst: 2 }
+`,
+		"gcra interval under a nanosecond": `
+policies:
+  - name: a
+    algorithm: gcra
+    key: { source: ip }
+    gcra: { rate: 2e9, burst: 2 }
+`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			withTempConfig(t, gcraDefaultsYAML+content, func() {
+				_, err := config.Load()
+				if err == nil {
+					t.Fatal("expected Load to fail")
+				}
+
+				e, ok := err.(*domain.Error)
+				if !ok {
+					t.Fatalf("expected *domain.Error, got %T", err)
+				}
+				if e.Code() != domain.ErrInvalidArgument {
+					t.Errorf("expected error code ErrInvalidArgument, got %v", e.Code())
+				}
+			})
+		})
+	}
+}
+
+// watch starts config.Watch and returns a function waiting until onChange
+// gets a result want accepts.
+func watch(t *testing.T) func(want func(*config.Config, error) bool) {
+	t.Helper()
+	type result struct {
+		cfg *config.Config
+		err error
+	}
+	results := make(chan result, 16)
+	err := config.Watch(func(cfg *config.Config, err error) {
+		select {
+		case results <- result{cfg, err}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to watch config: %v", err)
+	}
+
+	// A single write can fire several events, the first of them seeing a
+	// truncated file, so wait for the reload we are after.
+	return func(want func(*config.Config, error) bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case r := <-results:
+				if want(r.cfg, r.err) {
+					return
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for reload")
+			}
+		}
+	}
+}
+
+func maxRequests(n int) func(*config.Config, error) bool {
+	return func(cfg *config.Config, err error) bool {
+		return err == nil && cfg.RateLimiter.FixedWindow.MaxRequests == n
+	}
+}
+
+func TestWatch(t *testing.T) {
+	withTempConfig(t, validYAML, func() {
+		waitFor := watch(t)
+
+		updated := strings.Replace(validYAML, "max-requests: 5", "max-requests: 9", 1)
+		if err := os.WriteFile("config.yaml", []byte(updated), 0644); err != nil {
+			t.Fatalf("failed to rewrite config: %v", err)
+		}
+		waitFor(maxRequests(9))
+
+		if err := os.WriteFile("config.yaml", []byte(invalidStorageYAML), 0644); err != nil {
+			t.Fatalf("failed to rewrite config: %v", err)
+		}
+		waitFor(func(_ *config.Config, err error) bool {
+			var e *domain.Error
+			return errors.As(err, &e) && e.Code() == domain.ErrInvalidArgument
+		})
+	})
+}
+
+func TestWatch_Rename(t *testing.T) {
+	withTempConfig(t, validYAML, func() {
+		waitFor := watch(t)
+
+		// Save the way many editors do: write a new file, rename it over the
+		// old one.
+		updated := strings.Replace(validYAML, "max-requests: 5", "max-requests: 9", 1)
+		if err := os.WriteFile("config.yaml.tmp", []byte(updated), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if err := os.Rename("config.yaml.tmp", "config.yaml"); err != nil {
+			t.Fatalf("failed to replace config: %v", err)
+		}
+		waitFor(maxRequests(9))
+
+		// Nor may deleting the file and writing a new one end the watch.
+		if err := os.Remove("config.yaml"); err != nil {
+			t.Fatalf("failed to remove config: %v", err)
+		}
+		updated = strings.Replace(validYAML, "max-requests: 5", "max-requests: 7", 1)
+		if err := os.WriteFile("config.yaml", []byte(updated), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		waitFor(maxRequests(7))
+	})
+}
+
+func TestConfig_RestartSections(t *testing.T) {
+	old := &config.Config{
+		Server:      config.Server{Port: 8080},
+		Redis:       config.Redis{Host: "localhost"},
+		Storage:     config.Storage{FixedWindow: config.StorageRedis, Memory: config.MemoryStorage{MaxEntries: 10}},
+		RateLimiter: config.RateLimiter{FixedWindow: config.FixedWindow{MaxRequests: 5}},
+	}
+
+	next := *old
+	next.RateLimiter.FixedWindow.MaxRequests = 9
+	if got := old.RestartSections(&next); len(got) != 0 {
+		t.Errorf("expected a limit change to need no restart, got %v", got)
+	}
+
+	next.Server.Port = 9090
+	next.Storage.Memory.MaxEntries = 20
+	next.DecisionAPI.Token = "secret"
+	want := []string{"server", "storage.memory", "decision-api"}
+	if got := old.RestartSections(&next); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestLoad_Tiers(t *testing.T) {
+	withTempConfig(t, tiersYAML, func() {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("expected Load to succeed, got error: %v", err)
+		}
+
+		if len(cfg.Tiers) != 2 || cfg.Tiers[1].Name != "enterprise" {
+			t.Fatalf("unexpected tiers %+v", cfg.Tiers)
+		}
+		if tb := cfg.Tiers[1].TokenBucket; tb == nil || tb.MaxTokens != 100 {
+			t.Errorf("unexpected enterprise token-bucket %+v", tb)
+		}
+		if cfg.Tiers[0].TokenBucket != nil {
+			t.Errorf("expected free tier without token-bucket, got %+v", *cfg.Tiers[0].TokenBucket)
+		}
+
+		if len(cfg.Clients) != 2 {
+			t.Fatalf("expected 2 clients, got %d", len(cfg.Clients))
+		}
+		if cfg.Clients[0].Key != "Partner-ABC" {
+			t.Errorf("expected client key to keep its case, got %q", cfg.Clients[0].Key)
+		}
+		if fw := cfg.Clients[1].FixedWindow; fw == nil || fw.MaxRequests != 20 {
+			t.Errorf("unexpected override %+v", fw)
+		}
+	})
+}
+
+func TestLoad_InvalidTiers(t *testing.T) {
+	tests := map[string]string{
+		"unknown tier": `
+clients:
+  - { key: a, tier: gold }
+`,
+		"duplicate client": `
+tiers:
+  - { name: free }
+clients:
+  - { key: a, tier: free }
+  - { key: a, tier: free }
+`,
+		"duplicate tier": `
+tiers:
+  - { name: free }
+  - { name: free }
+`,
+		"invalid tier limits": `
+tiers:
+  - name: free
+    token-bucket: { max-tokens: 0, refill-rate: 1 }
+`,
+		"invalid override": `
+clients:
+  - key: a
+    fixed-window: { max-requests: 5 }
+`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			withTempConfig(t, content, func() {
+				_, err := config.Load()
+				if err == nil {
+					t.Fatal("expected Load to fail")
+				}
+
+				e, ok := err.(*domain.Error)
+				if !ok {
+					t.Fatalf("expected *domain.Error, got %T", err)
+				}
+				if e.Code() != domain.ErrInvalidArgument {
+					t.Errorf("expected error code ErrInvalidArgument, got %v", e.Code())
+				}
+			})
+		})
+	}
+}
+
+func TestLoad_RedisSentinel(t *testing.T) {
+	yaml := `
+redis:
+  mode: sentinel
+  master-name: mymaster
+  addrs: [sentinel-1:26379, sentinel-2:26379]
+  username: limiter
+  tls: { enabled: true, server-name: redis.internal }
+  pool-size: 20
+`
+	withTempConfig(t, yaml, func() {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("expected Load to succeed, got error: %v", err)
+		}
+
+		r := cfg.Redis
+		if r.Mode != config.RedisModeSentinel || r.MasterName != "mymaster" || len(r.Addrs) != 2 {
+			t.Errorf("unexpected sentinel settings %+v", r)
+		}
+		if r.Username != "limiter" || !r.TLS.Enabled || r.TLS.ServerName != "redis.internal" || r.PoolSize != 20 {
+			t.Errorf("unexpected connection settings %+v", r)
+		}
+	})
+}
+
+func TestLoad_RedisKeys(t *testing.T) {
+	withTempConfig(t, "redis: { key-prefix: checkout }", func() {
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("expected Load to succeed, got error: %v", err)
+		}
+		if cfg.Redis.KeyPrefix != "checkout" {
+			t.Errorf("expected key prefix checkout, got %q", cfg.Redis.KeyPrefix)
+		}
+		if cfg.Redis.KeySchema != "" {
+			t.Errorf("expected no key schema, leaving the default to rdb, got %q", cfg.Redis.KeySchema)
+		}
+	})
+}
+
+func TestLoad_InvalidRedis(t *testing.T) {
+	tests := map[string]string{
+		"unknown mode":           "redis: { mode: ring }",
+		"sentinel without addrs": "redis: { mode: sentinel, master-name: mymaster }",
+		"sentinel without name":  "redis: { mode: sentinel, addrs: [sentinel-1:26379] }",
+		"cluster without addrs":  "redis: { mode: cluster }",
+		"negative pool size":     "redis: { pool-size: -1 }",
+		"schema without client":  "redis: { key-schema: '{prefix}:{policy}' }",
+		"unknown placeholder":    "redis: { key-schema: '{prefix}:{tenant}:{clientID}' }",
+		"prefix with braces":     "redis: { key-prefix: '{rl}' }",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			withTempConfig(t, content, func() {
+				_, err := config.Load()
+				if err == nil {
+					t.Fatal("expected Load to fail")
+				}
+
+				e, ok := err.(*domain.Error)
+				if !ok {
+					t.Fatalf("expected *domain.Error, got %T", err)
+				}
+				if e.Code() != domain.ErrInvalidArgument {
+					t.Errorf("expected error code ErrInvalidArgument, got %v", e.Code())
+				}
+			})
+		})
+	}
+}
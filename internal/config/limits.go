@@ -0,0 +1,91 @@
+package config
+
+import (
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+)
+
+// Limits holds an optional parameter block per algorithm. It is embedded in
+// policies, tiers and clients, which only set the blocks they need.
+type Limits struct {
+	FixedWindow          *FixedWindow          `mapstructure:"fixed-window" json:"fixed-window,omitempty"`
+	TokenBucket          *TokenBucket          `mapstructure:"token-bucket" json:"token-bucket,omitempty"`
+	SlidingWindowLog     *SlidingWindowLog     `mapstructure:"sliding-window-log" json:"sliding-window-log,omitempty"`
+	SlidingWindowCounter *SlidingWindowCounter `mapstructure:"sliding-window-counter" json:"sliding-window-counter,omitempty"`
+	GCRA                 *GCRA                 `mapstructure:"gcra" json:"gcra,omitempty"`
+	LeakyBucket          *LeakyBucket          `mapstructure:"leaky-bucket" json:"leaky-bucket,omitempty"`
+	Concurrency          *Concurrency          `mapstructure:"concurrency" json:"concurrency,omitempty"`
+}
+
+// Has reports whether l sets the block of algorithm.
+func (l Limits) Has(algorithm string) bool {
+	switch algorithm {
+	case AlgorithmFixedWindow:
+		return l.FixedWindow != nil
+	case AlgorithmTokenBucket:
+		return l.TokenBucket != nil
+	case AlgorithmSlidingWindowLog:
+		return l.SlidingWindowLog != nil
+	case AlgorithmSlidingWindowCounter:
+		return l.SlidingWindowCounter != nil
+	case AlgorithmGCRA:
+		return l.GCRA != nil
+	case AlgorithmLeakyBucket:
+		return l.LeakyBucket != nil
+	case AlgorithmConcurrency:
+		return l.Concurrency != nil
+	default:
+		return false
+	}
+}
+
+// Validate checks every block l sets. owner names l in the error, e.g.
+// "tier free".
+func (l Limits) Validate(owner string) error {
+	for _, algorithm := range algorithms {
+		if l.Has(algorithm) && !validLimits(algorithm, l, RateLimiter{}) {
+			return domain.NewError(domain.ErrInvalidArgument, "%s has invalid %s limits", owner, algorithm)
+		}
+	}
+	return nil
+}
+
+// validLimits reports whether the parameters algorithm runs with, the block in
+// l or else the one in defaults, are usable.
+func validLimits(algorithm string, l Limits, defaults RateLimiter) bool {
+	switch algorithm {
+	case AlgorithmFixedWindow:
+		c := orDefault(l.FixedWindow, defaults.FixedWindow)
+		return c.MaxRequests > 0 && c.TimeFrameMs > 0
+	case AlgorithmTokenBucket:
+		c := orDefault(l.TokenBucket, defaults.TokenBucket)
+		return c.MaxTokens > 0 && c.RefillRate > 0
+	case AlgorithmSlidingWindowLog:
+		c := orDefault(l.SlidingWindowLog, defaults.SlidingWindowLog)
+		return c.MaxRequests > 0 && c.TimeFrameMs > 0
+	case AlgorithmSlidingWindowCounter:
+		c := orDefault(l.SlidingWindowCounter, defaults.SlidingWindowCounter)
+		return c.MaxRequests > 0 && c.TimeFrameMs > 0
+	case AlgorithmGCRA:
+		c := orDefault(l.GCRA, defaults.GCRA)
+		// Above one request per nanosecond the emission interval truncates
+		// to zero, which the service divides by.
+		return c.Rate > 0 && time.Duration(float64(time.Second)/c.Rate) > 0 && c.Burst > 0
+	case AlgorithmLeakyBucket:
+		c := orDefault(l.LeakyBucket, defaults.LeakyBucket)
+		return c.LeakRate > 0 && c.Capacity > 0 && c.MaxWaitMs >= 0
+	case AlgorithmConcurrency:
+		c := orDefault(l.Concurrency, defaults.Concurrency)
+		return c.MaxInFlight > 0 && c.LeaseTTLMs > 0
+	default:
+		return false
+	}
+}
+
+func orDefault[T any](params *T, def T) T {
+	if params != nil {
+		return *params
+	}
+	return def
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"slices"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+)
+
+// Sources a policy can read the client key from.
+const (
+	KeySourceHeader   = "header"
+	KeySourceIP       = "ip"
+	KeySourceQuery    = "query"
+	KeySourceJWTClaim = "jwt-claim"
+	// KeySourceDescriptor takes the key from the descriptors Envoy sends to
+	// the rate limit service. Name lists the descriptor's entry keys joined
+	// with dots, e.g. "generic_key.remote_address", and the key is the entry
+	// values. Such policies are matched by descriptor, never by route.
+	KeySourceDescriptor = "descriptor"
+)
+
+// What a policy does when its limiter fails, typically because its store is
+// unreachable.
+const (
+	// OnErrorFailClosed answers 500 without serving the request. It is the
+	// default.
+	OnErrorFailClosed = "fail-closed"
+	// OnErrorFailOpen serves the request and logs the error.
+	OnErrorFailOpen = "fail-open"
+	// OnErrorFallback decides with the same limits kept in local memory, so
+	// each instance enforces them on its own until the store is back.
+	OnErrorFallback = "fallback"
+)
+
+// Policy limits the routes it matches with one algorithm. The parameter block
+// named after the algorithm is optional; without it the policy uses the
+// defaults from the rate-limiter section. A tiered policy gives clients listed
+// in the clients section the limits of their tier or their own override
+// instead.
+type Policy struct {
+	Name      string      `mapstructure:"name"`
+	Algorithm string      `mapstructure:"algorithm"`
+	Key       PolicyKey   `mapstructure:"key"`
+	Match     PolicyMatch `mapstructure:"match"`
+	Cost      PolicyCost  `mapstructure:"cost"`
+	Tiered    bool        `mapstructure:"tiered"`
+	OnError   string      `mapstructure:"on-error"`
+
+	Limits `mapstructure:",squash"`
+}
+
+// PolicyKey says where the client key of a request comes from. Name is the
+// header, query parameter or claim to read and is unused for KeySourceIP.
+// JWTSecret, when set, makes the jwt-claim source verify HS256 signatures;
+// without it the claims of the bearer token are read unverified.
+type PolicyKey struct {
+	Source    string `mapstructure:"source"`
+	Name      string `mapstructure:"name"`
+	JWTSecret string `mapstructure:"jwt-secret"`
+}
+
+// PolicyMatch selects the routes a policy applies to. Path is either a route
+// pattern as registered with gin, a prefix ending in "/*", or empty for every
+// route. An empty Methods matches every method.
+type PolicyMatch struct {
+	Methods []string `mapstructure:"methods"`
+	Path    string   `mapstructure:"path"`
+}
+
+// PolicyCost sets how many units a request uses. Header and BodyBytesPerUnit
+// are alternatives to the fixed cost; a policy without any costs one unit.
+// Max caps the costs taken from the header or the body, 1000 when zero;
+// requests above it are rejected without reading the rest of their body.
+type PolicyCost struct {
+	Fixed            int    `mapstructure:"fixed"`
+	Header           string `mapstructure:"header"`
+	BodyBytesPerUnit int64  `mapstructure:"body-bytes-per-unit"`
+	Max              int    `mapstructure:"max"`
+}
+
+func validatePolicies(policies []Policy, defaults RateLimiter) error {
+	seen := make(map[string]bool, len(policies))
+	descriptors := make(map[string]string)
+	for i, p := range policies {
+		if p.Name == "" {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %d has no name", i)
+		}
+		if seen[p.Name] {
+			return domain.NewError(domain.ErrInvalidArgument, "duplicate policy name %q", p.Name)
+		}
+		seen[p.Name] = true
+
+		if !slices.Contains(algorithms, p.Algorithm) {
+			return domain.NewError(domain.ErrInvalidArgument, "unknown algorithm %q in policy %q", p.Algorithm, p.Name)
+		}
+
+		switch p.Key.Source {
+		case KeySourceIP:
+		case KeySourceHeader, KeySourceQuery, KeySourceJWTClaim, KeySourceDescriptor:
+			if p.Key.Name == "" {
+				return domain.NewError(domain.ErrInvalidArgument, "policy %q needs a key name for source %q", p.Name, p.Key.Source)
+			}
+		default:
+			return domain.NewError(domain.ErrInvalidArgument, "unknown key source %q in policy %q", p.Key.Source, p.Name)
+		}
+
+		costs := 0
+		for _, set := range []bool{p.Cost.Fixed != 0, p.Cost.Header != "", p.Cost.BodyBytesPerUnit != 0} {
+			if set {
+				costs++
+			}
+		}
+		if costs > 0 && p.Algorithm == AlgorithmConcurrency {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %q: concurrency policies hold one slot per request and take no cost", p.Name)
+		}
+		if p.Key.Source == KeySourceDescriptor {
+			switch {
+			case p.Algorithm == AlgorithmConcurrency:
+				return domain.NewError(domain.ErrInvalidArgument, "policy %q: concurrency policies cannot take descriptor keys, Envoy does not report when a request ends", p.Name)
+			case costs > 0:
+				return domain.NewError(domain.ErrInvalidArgument, "policy %q: descriptor policies take their cost from Envoy's hits_addend", p.Name)
+			case p.Match.Path != "" || len(p.Match.Methods) > 0:
+				return domain.NewError(domain.ErrInvalidArgument, "policy %q: descriptor policies are matched by descriptor and take no match", p.Name)
+			}
+			if descriptors[p.Key.Name] != "" {
+				return domain.NewError(domain.ErrInvalidArgument, "policies %q and %q both take descriptor %q", descriptors[p.Key.Name], p.Name, p.Key.Name)
+			}
+			descriptors[p.Key.Name] = p.Name
+		}
+		if costs > 1 {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %q sets more than one cost", p.Name)
+		}
+		if p.Cost.Fixed < 0 || p.Cost.BodyBytesPerUnit < 0 || p.Cost.Max < 0 {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %q has a negative cost", p.Name)
+		}
+		if p.Cost.Max != 0 && p.Cost.Header == "" && p.Cost.BodyBytesPerUnit == 0 {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %q: cost max only applies to header and body-bytes-per-unit costs", p.Name)
+		}
+
+		switch p.OnError {
+		case "", OnErrorFailClosed, OnErrorFailOpen, OnErrorFallback:
+		default:
+			return domain.NewError(domain.ErrInvalidArgument, "unknown on-error %q in policy %q", p.OnError, p.Name)
+		}
+
+		if err := p.validateLimits(defaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateLimits checks the parameters the policy runs with, its own block or
+// the rate-limiter defaults, so a typo cannot divide by zero or turn a limit
+// off.
+func (p Policy) validateLimits(defaults RateLimiter) error {
+	if !validLimits(p.Algorithm, p.Limits, defaults) {
+		return domain.NewError(domain.ErrInvalidArgument, "policy %q has invalid %s limits", p.Name, p.Algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import "github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+
+// Tier is a named set of limits, such as a pricing plan.
+type Tier struct {
+	Name   string `mapstructure:"name"`
+	Limits `mapstructure:",squash"`
+}
+
+// Client puts a client key on a tier. Blocks set on the client override the
+// ones of its tier; a client may also have overrides and no tier at all. Key is
+// the value a policy reads from the request, such as the API key.
+type Client struct {
+	Key    string `mapstructure:"key"`
+	Tier   string `mapstructure:"tier"`
+	Limits `mapstructure:",squash"`
+}
+
+// Tiers and clients are lists rather than maps because viper lowercases map
+// keys, and client keys are case sensitive.
+func validateTiers(tiers []Tier, clients []Client) error {
+	names := make(map[string]bool, len(tiers))
+	for i, t := range tiers {
+		if t.Name == "" {
+			return domain.NewError(domain.ErrInvalidArgument, "tier %d has no name", i)
+		}
+		if names[t.Name] {
+			return domain.NewError(domain.ErrInvalidArgument, "duplicate tier name %q", t.Name)
+		}
+		names[t.Name] = true
+
+		if err := t.Limits.Validate("tier " + t.Name); err != nil {
+			return err
+		}
+	}
+
+	keys := make(map[string]bool, len(clients))
+	for i, c := range clients {
+		if c.Key == "" {
+			return domain.NewError(domain.ErrInvalidArgument, "client %d has no key", i)
+		}
+		if keys[c.Key] {
+			return domain.NewError(domain.ErrInvalidArgument, "client %q is listed twice", c.Key)
+		}
+		keys[c.Key] = true
+
+		if c.Tier != "" && !names[c.Tier] {
+			return domain.NewError(domain.ErrInvalidArgument, "client %q is on unknown tier %q", c.Key, c.Tier)
+		}
+		if err := c.Limits.Validate("client " + c.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package ratelimit
+
+import "time"
+
+// Decision describes the outcome of a single rate limit check.
+type Decision struct {
+	Allowed bool
+	// Limit is the number of requests the client may send in a burst.
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// ResetAt is when the client is back to its full limit.
+	ResetAt time.Time
+	// RetryAfter is how long a rejected client has to wait before the next
+	// request can be allowed. It is zero when the request was allowed.
+	RetryAfter time.Duration
+}
@@ -0,0 +1,9 @@
+package ratelimit
+
+import "time"
+
+// GCRA holds the theoretical arrival time (TAT) of the next request that would
+// conform to the configured rate. It is the only state the algorithm needs.
+type GCRA struct {
+	TAT time.Time
+}
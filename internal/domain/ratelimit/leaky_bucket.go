@@ -0,0 +1,10 @@
+package ratelimit
+
+import "time"
+
+// LeakyBucket holds the time slot handed to the most recently admitted
+// request. Requests leak out one interval apart, so the next free slot is
+// LastSlot plus one interval.
+type LeakyBucket struct {
+	LastSlot time.Time
+}
@@ -0,0 +1,7 @@
+package ratelimit
+
+import "time"
+
+type SlidingLog struct {
+	Timestamps []time.Time
+}
@@ -0,0 +1,9 @@
+package ratelimit
+
+import "time"
+
+type SlidingWindowCounter struct {
+	PreviousCount int
+	CurrentCount  int
+	CurrentStart  time.Time
+}
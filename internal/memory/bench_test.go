@@ -0,0 +1,126 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+// globalLockWindows is the fixed-window store as it was before sharding: one
+// map behind one lock, read and written separately while the service holds a
+// striped lock for the client.
+type globalLockWindows struct {
+	mu    sync.RWMutex
+	store map[string]ratelimit.Window
+}
+
+func (r *globalLockWindows) GetWindow(ctx context.Context, clientID string) (ratelimit.Window, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.store[clientID], nil
+}
+
+func (r *globalLockWindows) SaveWindow(ctx context.Context, clientID string, w ratelimit.Window) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store[clientID] = w
+	return nil
+}
+
+func (r *globalLockWindows) DeleteWindow(ctx context.Context, clientID string) error {
+	return nil
+}
+
+func (r *globalLockWindows) ListWindows(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+// globalLockBuckets is the token-bucket store as it was before sharding.
+type globalLockBuckets struct {
+	mu   sync.RWMutex
+	data map[string]ratelimit.TokenBucket
+}
+
+func (r *globalLockBuckets) GetBucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.data[clientID], nil
+}
+
+func (r *globalLockBuckets) SaveBucket(ctx context.Context, clientID string, b ratelimit.TokenBucket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[clientID] = b
+	return nil
+}
+
+func (r *globalLockBuckets) DeleteBucket(ctx context.Context, clientID string) error {
+	return nil
+}
+
+func (r *globalLockBuckets) ListBuckets(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+// benchClients is the number of distinct clients the requests are spread over.
+const benchClients = 10000
+
+var benchGoroutines = []int{1, 16, 128}
+
+// runParallel calls allow from b.SetParallelism(p) goroutines per CPU for each
+// p in benchGoroutines, every goroutine walking the clients from its own
+// offset.
+func runParallel(b *testing.B, allow func(ctx context.Context, clientID string) (bool, error)) {
+	clientIDs := make([]string, benchClients)
+	for i := range clientIDs {
+		clientIDs[i] = "client:" + strconv.Itoa(i)
+	}
+
+	for _, p := range benchGoroutines {
+		b.Run(fmt.Sprintf("goroutines=%dxCPU", p), func(b *testing.B) {
+			ctx := context.Background()
+			var offset atomic.Int64
+			b.SetParallelism(p)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(offset.Add(7919))
+				for pb.Next() {
+					allow(ctx, clientIDs[i%benchClients])
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkFixedWindow(b *testing.B) {
+	cfg := config.FixedWindow{MaxRequests: 1 << 30, TimeFrameMs: 60000}
+
+	b.Run("global-lock", func(b *testing.B) {
+		repo := &globalLockWindows{store: make(map[string]ratelimit.Window)}
+		runParallel(b, service.NewFixedWindowService(repo, cfg).Allow)
+	})
+	b.Run("sharded", func(b *testing.B) {
+		runParallel(b, service.NewFixedWindowService(memory.NewFixedWindowRepository(), cfg).Allow)
+	})
+}
+
+func BenchmarkTokenBucket(b *testing.B) {
+	cfg := config.TokenBucket{MaxTokens: 1 << 30, RefillRate: 1}
+
+	b.Run("global-lock", func(b *testing.B) {
+		repo := &globalLockBuckets{data: make(map[string]ratelimit.TokenBucket)}
+		runParallel(b, service.NewTokenBucketService(repo, cfg).Allow)
+	})
+	b.Run("sharded", func(b *testing.B) {
+		runParallel(b, service.NewTokenBucketService(memory.NewTokenBucketRepository(cfg.MaxTokens, cfg.RefillRate), cfg).Allow)
+	})
+}
@@ -0,0 +1,318 @@
+package memory
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultShards spreads the entries over enough locks that goroutines working
+// on different clients rarely wait for each other.
+const defaultShards = 64
+
+// Option configures how an in-memory repository stores its entries.
+type Option func(*cacheConfig)
+
+type cacheConfig struct {
+	shards          int
+	janitorInterval time.Duration
+	maxEntries      int
+}
+
+// WithShards splits the entries over n maps, each behind its own lock. It
+// defaults to 64.
+func WithShards(n int) Option {
+	return func(c *cacheConfig) {
+		c.shards = n
+	}
+}
+
+// WithJanitor removes expired entries every interval on a background
+// goroutine, stopped by Close. Without it expired entries are only dropped
+// when read, evicted or overwritten.
+func WithJanitor(interval time.Duration) Option {
+	return func(c *cacheConfig) {
+		c.janitorInterval = interval
+	}
+}
+
+// WithMaxEntries caps the number of entries, evicting the least recently used
+// one to make room for a new client. Zero means no cap. The cap bounds the
+// total over all shards: a new client only evicts once the total is over it,
+// taking the least recently used entry of its own shard, so eviction order is
+// only approximately global.
+func WithMaxEntries(n int) Option {
+	return func(c *cacheConfig) {
+		c.maxEntries = n
+	}
+}
+
+// Stats describes the entries of an in-memory repository.
+type Stats struct {
+	// Entries is the number of entries stored, expired ones not yet removed
+	// included.
+	Entries int
+	// Expired counts the entries removed because they expired.
+	Expired uint64
+	// Evictions counts the entries removed to stay under the max entries.
+	Evictions uint64
+}
+
+type cacheEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// cache is a map whose entries expire and that optionally keeps only the most
+// recently used ones. A missing or expired entry reads as the zero value, the
+// same as a client that was never seen. Keys are hashed onto shards so that
+// only operations on keys of the same shard contend.
+type cache[V any] struct {
+	shards     []shard[V]
+	maxEntries int
+	// entries counts the entries of all shards, so the cap holds for the
+	// total however the keys hash.
+	entries atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type shard[V any] struct {
+	mu    sync.Mutex
+	items map[string]*list.Element
+	// order holds the entries from the most to the least recently used.
+	order   *list.List
+	entries *atomic.Int64
+	stats   Stats
+}
+
+func newCache[V any](opts []Option) *cache[V] {
+	cfg := cacheConfig{shards: defaultShards}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.shards = max(cfg.shards, 1)
+
+	c := &cache[V]{
+		shards:     make([]shard[V], cfg.shards),
+		maxEntries: cfg.maxEntries,
+		stop:       make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i] = shard[V]{
+			items:   make(map[string]*list.Element),
+			order:   list.New(),
+			entries: &c.entries,
+		}
+	}
+	if cfg.janitorInterval > 0 {
+		go c.janitor(cfg.janitorInterval)
+	}
+	return c
+}
+
+// shard picks the shard of key with FNV-1a, inlined to keep the hot path free
+// of allocations.
+func (c *cache[V]) shard(key string) *shard[V] {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &c.shards[h%uint32(len(c.shards))]
+}
+
+func (c *cache[V]) get(key string, now time.Time) (V, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(key, now)
+}
+
+func (c *cache[V]) set(key string, value V, expiresAt time.Time) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.put(s, key, value, expiresAt)
+}
+
+// update reads the entry of key and stores what fn returns in one step under
+// the shard's lock, so no other call on the key runs in between. fn gets the
+// zero value and false when there is no live entry, and decides whether to
+// store anything; its result is returned either way.
+func (c *cache[V]) update(key string, now time.Time, fn func(value V, found bool) (updated V, expiresAt time.Time, store bool)) V {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, found := s.get(key, now)
+	updated, expiresAt, store := fn(value, found)
+	if store {
+		c.put(s, key, updated, expiresAt)
+	}
+	return updated
+}
+
+// put stores the entry in s, whose lock the caller holds, and evicts one entry
+// when that takes the total over the cap.
+func (c *cache[V]) put(s *shard[V], key string, value V, expiresAt time.Time) {
+	if !s.set(key, value, expiresAt) || c.maxEntries <= 0 || c.entries.Load() <= int64(c.maxEntries) {
+		return
+	}
+	// The new entry is at the front, so anything behind it is older.
+	if s.order.Len() > 1 {
+		s.remove(s.order.Back())
+		s.stats.Evictions++
+		return
+	}
+	// s held nothing else. Another shard gives up its oldest entry instead;
+	// TryLock keeps two shards doing this at once from waiting on each other,
+	// at the cost of briefly going over the cap when every other shard is busy.
+	for i := range c.shards {
+		o := &c.shards[i]
+		if o == s || !o.mu.TryLock() {
+			continue
+		}
+		back := o.order.Back()
+		if back != nil {
+			o.remove(back)
+			o.stats.Evictions++
+		}
+		o.mu.Unlock()
+		if back != nil {
+			return
+		}
+	}
+}
+
+func (c *cache[V]) delete(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+}
+
+// keys returns the keys starting with prefix of the entries not expired at
+// now, sorted.
+func (c *cache[V]) keys(prefix string, now time.Time) []string {
+	var keys []string
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for key, el := range s.items {
+			if strings.HasPrefix(key, prefix) && now.Before(el.Value.(*cacheEntry[V]).expiresAt) {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (c *cache[V]) len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func (c *cache[V]) statistics() Stats {
+	var stats Stats
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		stats.Entries += len(s.items)
+		stats.Expired += s.stats.Expired
+		stats.Evictions += s.stats.Evictions
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// sweep removes the entries expired at now, one shard at a time.
+func (c *cache[V]) sweep(now time.Time) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for _, el := range s.items {
+			if !now.Before(el.Value.(*cacheEntry[V]).expiresAt) {
+				s.remove(el)
+				s.stats.Expired++
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (c *cache[V]) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			c.sweep(now)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// close stops the janitor. It is safe to call more than once.
+func (c *cache[V]) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+}
+
+// The shard methods expect the caller to hold mu.
+
+func (s *shard[V]) get(key string, now time.Time) (V, bool) {
+	el, ok := s.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*cacheEntry[V])
+	if !now.Before(e.expiresAt) {
+		s.remove(el)
+		s.stats.Expired++
+		var zero V
+		return zero, false
+	}
+	s.order.MoveToFront(el)
+	return e.value, true
+}
+
+// set stores the entry and reports whether it is a new one.
+func (s *shard[V]) set(key string, value V, expiresAt time.Time) bool {
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*cacheEntry[V])
+		e.value, e.expiresAt = value, expiresAt
+		s.order.MoveToFront(el)
+		return false
+	}
+
+	s.items[key] = s.order.PushFront(&cacheEntry[V]{key: key, value: value, expiresAt: expiresAt})
+	s.entries.Add(1)
+	return true
+}
+
+func (s *shard[V]) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.items, el.Value.(*cacheEntry[V]).key)
+	s.entries.Add(-1)
+}
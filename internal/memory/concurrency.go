@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type ConcurrencyRepository struct {
+	mu     sync.Mutex
+	leases map[string]map[string]time.Time
+}
+
+func NewConcurrencyRepository() *ConcurrencyRepository {
+	return &ConcurrencyRepository{
+		leases: make(map[string]map[string]time.Time),
+	}
+}
+
+func (r *ConcurrencyRepository) Acquire(ctx context.Context, clientID string, leaseID string, now time.Time, limit int, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := r.leases[clientID]
+	for id, expiry := range held {
+		if !expiry.After(now) {
+			delete(held, id)
+		}
+	}
+
+	if len(held) >= limit {
+		return false, nil
+	}
+
+	if held == nil {
+		held = make(map[string]time.Time)
+		r.leases[clientID] = held
+	}
+	held[leaseID] = now.Add(ttl)
+	return true, nil
+}
+
+// Renew extends a lease the client still holds. A lease that already expired
+// is not brought back, since its slot may have been handed out again.
+func (r *ConcurrencyRepository) Renew(ctx context.Context, clientID string, leaseID string, now time.Time, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if expiry, ok := r.leases[clientID][leaseID]; ok && expiry.After(now) {
+		r.leases[clientID][leaseID] = now.Add(ttl)
+	}
+	return nil
+}
+
+func (r *ConcurrencyRepository) Release(ctx context.Context, clientID string, leaseID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := r.leases[clientID]
+	delete(held, leaseID)
+	if len(held) == 0 {
+		delete(r.leases, clientID)
+	}
+	return nil
+}
+
+// Len returns the number of clients holding leases.
+func (r *ConcurrencyRepository) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.leases)
+}
@@ -0,0 +1,83 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+)
+
+func TestConcurrencyRepository_Acquire_Limit(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewConcurrencyRepository()
+	now := time.Now()
+
+	for _, id := range []string{"a", "b"} {
+		ok, err := repo.Acquire(ctx, "client1", id, now, 2, time.Minute)
+		if err != nil || !ok {
+			t.Fatalf("expected lease %s to be acquired", id)
+		}
+	}
+
+	ok, err := repo.Acquire(ctx, "client1", "c", now, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Error("expected third lease to be refused")
+	}
+
+	ok, _ = repo.Acquire(ctx, "client2", "a", now, 2, time.Minute)
+	if !ok {
+		t.Error("expected leases to be counted per client")
+	}
+}
+
+func TestConcurrencyRepository_Release(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewConcurrencyRepository()
+	now := time.Now()
+
+	_, _ = repo.Acquire(ctx, "client1", "a", now, 1, time.Minute)
+	if err := repo.Release(ctx, "client1", "a"); err != nil {
+		t.Fatalf("unexpected error releasing lease: %v", err)
+	}
+
+	ok, _ := repo.Acquire(ctx, "client1", "b", now, 1, time.Minute)
+	if !ok {
+		t.Error("expected slot to be free after release")
+	}
+}
+
+func TestConcurrencyRepository_Acquire_ExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewConcurrencyRepository()
+	now := time.Now()
+
+	_, _ = repo.Acquire(ctx, "client1", "a", now, 1, time.Second)
+
+	ok, _ := repo.Acquire(ctx, "client1", "b", now.Add(2*time.Second), 1, time.Second)
+	if !ok {
+		t.Error("expected expired lease to free its slot")
+	}
+}
+
+func TestConcurrencyRepository_Renew(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewConcurrencyRepository()
+	now := time.Now()
+
+	_, _ = repo.Acquire(ctx, "client1", "a", now, 1, time.Second)
+	_ = repo.Renew(ctx, "client1", "a", now.Add(900*time.Millisecond), time.Second)
+
+	if ok, _ := repo.Acquire(ctx, "client1", "b", now.Add(1500*time.Millisecond), 1, time.Second); ok {
+		t.Error("expected the renewed lease to keep its slot")
+	}
+
+	// An expired lease is not brought back.
+	_ = repo.Renew(ctx, "client1", "a", now.Add(3*time.Second), time.Second)
+	if ok, _ := repo.Acquire(ctx, "client1", "b", now.Add(3*time.Second), 1, time.Second); !ok {
+		t.Error("expected the expired lease to free its slot")
+	}
+}
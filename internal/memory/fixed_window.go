@@ -2,37 +2,74 @@ package memory
 
 import (
 	"context"
-	"sync"
+	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 )
 
+// FixedWindowRepository keeps each window until it ends, like the TTL of the
+// Redis key, after which it reads as a new client.
 type FixedWindowRepository struct {
-	mu    sync.RWMutex
-	store map[string]ratelimit.Window
+	store *cache[ratelimit.Window]
 }
 
-func NewFixedWindowRepository() *FixedWindowRepository {
+func NewFixedWindowRepository(opts ...Option) *FixedWindowRepository {
 	return &FixedWindowRepository{
-		store: make(map[string]ratelimit.Window),
+		store: newCache[ratelimit.Window](opts),
 	}
 }
 
 func (r *FixedWindowRepository) GetWindow(ctx context.Context, clientID string) (ratelimit.Window, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	ws, ok := r.store[clientID]
-	if !ok {
-		return ratelimit.Window{}, nil
-	}
+	ws, _ := r.store.get(clientID, time.Now())
 	return ws, nil
 }
 
 func (r *FixedWindowRepository) SaveWindow(ctx context.Context, clientID string, state ratelimit.Window) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.store.set(clientID, state, state.EndTime)
+	return nil
+}
 
-	r.store[clientID] = state
+// TakeWindow checks and increments the client's window under one lock,
+// opening a new window when the last one has ended. Like the Redis script, a
+// request costing more than a whole window leaves the store alone.
+func (r *FixedWindowRepository) TakeWindow(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.Window, bool, error) {
+	allowed := false
+	window := r.store.update(clientID, now, func(w ratelimit.Window, found bool) (ratelimit.Window, time.Time, bool) {
+		if !found {
+			w = ratelimit.Window{EndTime: now.Add(timeFrame)}
+		}
+		if n > maxRequests-w.Count {
+			return w, w.EndTime, false
+		}
+		w.Count += n
+		allowed = true
+		return w, w.EndTime, true
+	})
+	return window, allowed, nil
+}
+
+func (r *FixedWindowRepository) DeleteWindow(ctx context.Context, clientID string) error {
+	r.store.delete(clientID)
 	return nil
 }
+
+// ListWindows returns the IDs of the clients starting with prefix that have a
+// window, sorted.
+func (r *FixedWindowRepository) ListWindows(ctx context.Context, prefix string) ([]string, error) {
+	return r.store.keys(prefix, time.Now()), nil
+}
+
+// Len returns the number of windows stored.
+func (r *FixedWindowRepository) Len() int {
+	return r.store.len()
+}
+
+// Stats reports the windows stored and how many were expired or evicted.
+func (r *FixedWindowRepository) Stats() Stats {
+	return r.store.statistics()
+}
+
+// Close stops the janitor, if any.
+func (r *FixedWindowRepository) Close() {
+	r.store.close()
+}
@@ -2,6 +2,11 @@ package memory_test
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -96,3 +101,160 @@ func TestFixedWindowRepository_Save_ExistingClient(t *testing.T) {
 		t.Errorf("expected EndTime updated, got %v", got.EndTime)
 	}
 }
+
+func TestFixedWindowRepository_DeleteAndList(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository()
+	for _, clientID := range []string{"fw:b", "fw:a", "tb:a"} {
+		repo.SaveWindow(ctx, clientID, ratelimit.Window{Count: 1, EndTime: time.Now().Add(time.Minute)})
+	}
+
+	got, err := repo.ListWindows(ctx, "fw:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"fw:a", "fw:b"}) {
+		t.Fatalf("expected [fw:a fw:b], got %v", got)
+	}
+
+	if err := repo.DeleteWindow(ctx, "fw:a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ = repo.ListWindows(ctx, "fw:")
+	if !slices.Equal(got, []string{"fw:b"}) {
+		t.Fatalf("expected [fw:b] after delete, got %v", got)
+	}
+}
+
+func TestFixedWindowRepository_Expiry(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository()
+	repo.SaveWindow(ctx, "ended", ratelimit.Window{Count: 5, EndTime: time.Now().Add(-time.Second)})
+
+	got, _ := repo.GetWindow(ctx, "ended")
+	if got.Count != 0 {
+		t.Errorf("expected an ended window to read as new, got %+v", got)
+	}
+	if stats := repo.Stats(); stats.Entries != 0 || stats.Expired != 1 {
+		t.Errorf("expected the window to be removed on read, got %+v", stats)
+	}
+}
+
+func TestFixedWindowRepository_Janitor(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository(memory.WithJanitor(10 * time.Millisecond))
+	defer repo.Close()
+
+	repo.SaveWindow(ctx, "short", ratelimit.Window{Count: 1, EndTime: time.Now().Add(20 * time.Millisecond)})
+	repo.SaveWindow(ctx, "long", ratelimit.Window{Count: 1, EndTime: time.Now().Add(time.Minute)})
+
+	deadline := time.Now().Add(time.Second)
+	for repo.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := repo.Stats(); stats.Entries != 1 || stats.Expired != 1 {
+		t.Errorf("expected the janitor to remove the ended window only, got %+v", stats)
+	}
+}
+
+func TestFixedWindowRepository_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository(memory.WithShards(1), memory.WithMaxEntries(2))
+	window := ratelimit.Window{Count: 1, EndTime: time.Now().Add(time.Minute)}
+
+	repo.SaveWindow(ctx, "a", window)
+	repo.SaveWindow(ctx, "b", window)
+	repo.GetWindow(ctx, "a") // b is now the least recently used
+	repo.SaveWindow(ctx, "c", window)
+
+	got, _ := repo.ListWindows(ctx, "")
+	if !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("expected b to be evicted, got %v", got)
+	}
+	if stats := repo.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("expected 2 entries and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestFixedWindowRepository_MaxEntries_Total(t *testing.T) {
+	ctx := context.Background()
+	window := ratelimit.Window{Count: 1, EndTime: time.Now().Add(time.Minute)}
+
+	for _, limit := range []int{1, 10, 63, 100, 1000} {
+		repo := memory.NewFixedWindowRepository(memory.WithMaxEntries(limit))
+		for i := range 5000 {
+			repo.SaveWindow(ctx, fmt.Sprintf("client-%d", i), window)
+			if n := repo.Len(); n > limit {
+				t.Fatalf("expected at most %d entries, got %d after %d clients", limit, n, i+1)
+			}
+		}
+	}
+}
+
+func TestFixedWindowRepository_MaxEntries_NoEarlyEviction(t *testing.T) {
+	ctx := context.Background()
+	window := ratelimit.Window{Count: 1, EndTime: time.Now().Add(time.Minute)}
+
+	// However the clients hash onto the shards, exactly the cap fits.
+	for _, limit := range []int{1, 10, 63, 100, 1000} {
+		repo := memory.NewFixedWindowRepository(memory.WithMaxEntries(limit))
+		for i := range limit {
+			repo.SaveWindow(ctx, fmt.Sprintf("client-%d", i), window)
+		}
+		if stats := repo.Stats(); stats.Entries != limit || stats.Evictions != 0 {
+			t.Errorf("expected %d entries and no evictions, got %+v", limit, stats)
+		}
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository()
+	now := time.Now()
+
+	w, allowed, err := repo.TakeWindow(ctx, "client", now, 3, time.Minute, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed || w.Count != 2 || !w.EndTime.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected a new window with count 2, got %+v allowed=%v", w, allowed)
+	}
+
+	w, allowed, _ = repo.TakeWindow(ctx, "client", now, 3, time.Minute, 2)
+	if allowed || w.Count != 2 {
+		t.Errorf("expected rejection leaving count 2, got %+v allowed=%v", w, allowed)
+	}
+
+	// A request costing more than a whole window leaves the store alone.
+	if _, allowed, _ := repo.TakeWindow(ctx, "other", now, 3, time.Minute, 4); allowed || repo.Len() != 1 {
+		t.Errorf("expected an oversized request to be rejected without a window, got allowed=%v len=%d", allowed, repo.Len())
+	}
+
+	// A cost near MaxInt must not wrap around when added to the count.
+	w, allowed, _ = repo.TakeWindow(ctx, "client", now, 3, time.Minute, math.MaxInt)
+	if allowed || w.Count != 2 {
+		t.Errorf("expected a MaxInt cost to be rejected leaving count 2, got %+v allowed=%v", w, allowed)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewFixedWindowRepository()
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, _ := repo.TakeWindow(ctx, "client", time.Now(), 50, time.Minute, 1); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 50 {
+		t.Errorf("expected exactly 50 requests allowed, got %d", n)
+	}
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+type GCRARepository struct {
+	mu   sync.RWMutex
+	tats map[string]ratelimit.GCRA
+}
+
+func NewGCRARepository() *GCRARepository {
+	return &GCRARepository{
+		tats: make(map[string]ratelimit.GCRA),
+	}
+}
+
+func (r *GCRARepository) GetTAT(ctx context.Context, clientID string) (ratelimit.GCRA, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state, ok := r.tats[clientID]
+	if !ok {
+		return ratelimit.GCRA{}, nil
+	}
+	return state, nil
+}
+
+func (r *GCRARepository) SaveTAT(ctx context.Context, clientID string, state ratelimit.GCRA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tats[clientID] = state
+	return nil
+}
+
+// Len returns the number of clients with a theoretical arrival time.
+func (r *GCRARepository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tats)
+}
@@ -0,0 +1,42 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+)
+
+func TestGCRARepository_Get_NonExistingClient(t *testing.T) {
+	repo := memory.NewGCRARepository()
+
+	got, err := repo.GetTAT(context.Background(), "nonexistent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.TAT.IsZero() {
+		t.Errorf("expected zero TAT for non-existing client, got %v", got.TAT)
+	}
+}
+
+func TestGCRARepository_Save_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewGCRARepository()
+	clientID := "client1"
+	tat := time.Now().Add(time.Second)
+
+	_ = repo.SaveTAT(ctx, clientID, ratelimit.GCRA{TAT: time.Now()})
+	if err := repo.SaveTAT(ctx, clientID, ratelimit.GCRA{TAT: tat}); err != nil {
+		t.Fatalf("unexpected error saving TAT: %v", err)
+	}
+
+	got, err := repo.GetTAT(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.TAT.Equal(tat) {
+		t.Errorf("expected TAT=%v, got %v", tat, got.TAT)
+	}
+}
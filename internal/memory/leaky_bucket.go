@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+type LeakyBucketRepository struct {
+	mu      sync.RWMutex
+	buckets map[string]ratelimit.LeakyBucket
+}
+
+func NewLeakyBucketRepository() *LeakyBucketRepository {
+	return &LeakyBucketRepository{
+		buckets: make(map[string]ratelimit.LeakyBucket),
+	}
+}
+
+func (r *LeakyBucketRepository) GetLeakyBucket(ctx context.Context, clientID string) (ratelimit.LeakyBucket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b, ok := r.buckets[clientID]
+	if !ok {
+		return ratelimit.LeakyBucket{}, nil
+	}
+	return b, nil
+}
+
+func (r *LeakyBucketRepository) SaveLeakyBucket(ctx context.Context, clientID string, bucket ratelimit.LeakyBucket) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buckets[clientID] = bucket
+	return nil
+}
+
+// Len returns the number of buckets stored.
+func (r *LeakyBucketRepository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.buckets)
+}
@@ -0,0 +1,42 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+)
+
+func TestLeakyBucketRepository_Get_NonExistingClient(t *testing.T) {
+	repo := memory.NewLeakyBucketRepository()
+
+	got, err := repo.GetLeakyBucket(context.Background(), "nonexistent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.LastSlot.IsZero() {
+		t.Errorf("expected zero slot for non-existing client, got %v", got.LastSlot)
+	}
+}
+
+func TestLeakyBucketRepository_Save_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewLeakyBucketRepository()
+	clientID := "client1"
+	slot := time.Now().Add(time.Second)
+
+	_ = repo.SaveLeakyBucket(ctx, clientID, ratelimit.LeakyBucket{LastSlot: time.Now()})
+	if err := repo.SaveLeakyBucket(ctx, clientID, ratelimit.LeakyBucket{LastSlot: slot}); err != nil {
+		t.Fatalf("unexpected error saving bucket: %v", err)
+	}
+
+	got, err := repo.GetLeakyBucket(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.LastSlot.Equal(slot) {
+		t.Errorf("expected LastSlot=%v, got %v", slot, got.LastSlot)
+	}
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+)
+
+type override struct {
+	limits    config.Limits
+	expiresAt time.Time
+}
+
+// OverrideRepository keeps the limits set through the admin API for single
+// clients until they expire. They are not evicted, so WithMaxEntries should
+// not be passed.
+type OverrideRepository struct {
+	data *cache[override]
+}
+
+func NewOverrideRepository(opts ...Option) *OverrideRepository {
+	return &OverrideRepository{data: newCache[override](opts)}
+}
+
+// GetOverride returns the override of the client and when it expires, or a
+// zero time when it has none.
+func (r *OverrideRepository) GetOverride(ctx context.Context, clientID string) (config.Limits, time.Time, error) {
+	o, _ := r.data.get(clientID, time.Now())
+	return o.limits, o.expiresAt, nil
+}
+
+func (r *OverrideRepository) SaveOverride(ctx context.Context, clientID string, limits config.Limits, expiresAt time.Time) error {
+	r.data.set(clientID, override{limits: limits, expiresAt: expiresAt}, expiresAt)
+	return nil
+}
+
+// DeleteOverride removes the override of the client and reports whether it
+// had one.
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, clientID string) (bool, error) {
+	_, found := r.data.get(clientID, time.Now())
+	r.data.delete(clientID)
+	return found, nil
+}
+
+// Close stops the janitor, if any.
+func (r *OverrideRepository) Close() {
+	r.data.close()
+}
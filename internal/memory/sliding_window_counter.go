@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+type SlidingWindowCounterRepository struct {
+	mu       sync.RWMutex
+	counters map[string]ratelimit.SlidingWindowCounter
+}
+
+func NewSlidingWindowCounterRepository() *SlidingWindowCounterRepository {
+	return &SlidingWindowCounterRepository{
+		counters: make(map[string]ratelimit.SlidingWindowCounter),
+	}
+}
+
+func (r *SlidingWindowCounterRepository) GetCounter(ctx context.Context, clientID string) (ratelimit.SlidingWindowCounter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.counters[clientID]
+	if !ok {
+		return ratelimit.SlidingWindowCounter{}, nil
+	}
+	return c, nil
+}
+
+func (r *SlidingWindowCounterRepository) SaveCounter(ctx context.Context, clientID string, counter ratelimit.SlidingWindowCounter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[clientID] = counter
+	return nil
+}
+
+// Len returns the number of counters stored.
+func (r *SlidingWindowCounterRepository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.counters)
+}
@@ -0,0 +1,43 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+)
+
+func TestSlidingWindowCounterRepository_Get_NonExistingClient(t *testing.T) {
+	repo := memory.NewSlidingWindowCounterRepository()
+
+	got, err := repo.GetCounter(context.Background(), "nonexistent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PreviousCount != 0 || got.CurrentCount != 0 || !got.CurrentStart.IsZero() {
+		t.Errorf("expected empty counter for non-existing client, got %+v", got)
+	}
+}
+
+func TestSlidingWindowCounterRepository_Save_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewSlidingWindowCounterRepository()
+	clientID := "client1"
+	start := time.Now().Truncate(time.Minute)
+
+	_ = repo.SaveCounter(ctx, clientID, ratelimit.SlidingWindowCounter{CurrentCount: 1, CurrentStart: start})
+	updated := ratelimit.SlidingWindowCounter{PreviousCount: 1, CurrentCount: 4, CurrentStart: start.Add(time.Minute)}
+	if err := repo.SaveCounter(ctx, clientID, updated); err != nil {
+		t.Fatalf("unexpected error saving counter: %v", err)
+	}
+
+	got, err := repo.GetCounter(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != updated {
+		t.Errorf("expected %+v, got %+v", updated, got)
+	}
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+type SlidingWindowLogRepository struct {
+	mu   sync.RWMutex
+	logs map[string][]time.Time
+}
+
+func NewSlidingWindowLogRepository() *SlidingWindowLogRepository {
+	return &SlidingWindowLogRepository{
+		logs: make(map[string][]time.Time),
+	}
+}
+
+func (r *SlidingWindowLogRepository) GetLog(ctx context.Context, clientID string) (ratelimit.SlidingLog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ts, ok := r.logs[clientID]
+	if !ok {
+		return ratelimit.SlidingLog{}, nil
+	}
+	// Hand out a copy so callers can trim it without touching the stored log.
+	return ratelimit.SlidingLog{Timestamps: append([]time.Time(nil), ts...)}, nil
+}
+
+func (r *SlidingWindowLogRepository) SaveLog(ctx context.Context, clientID string, log ratelimit.SlidingLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(log.Timestamps) == 0 {
+		delete(r.logs, clientID)
+		return nil
+	}
+	r.logs[clientID] = append([]time.Time(nil), log.Timestamps...)
+	return nil
+}
+
+// Len returns the number of logs stored.
+func (r *SlidingWindowLogRepository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.logs)
+}
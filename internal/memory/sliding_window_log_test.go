@@ -0,0 +1,81 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+)
+
+func TestSlidingWindowLogRepository_Get_NonExistingClient(t *testing.T) {
+	repo := memory.NewSlidingWindowLogRepository()
+	ctx := context.Background()
+
+	got, err := repo.GetLog(ctx, "nonexistent")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Timestamps) != 0 {
+		t.Errorf("expected empty log for non-existing client, got %+v", got)
+	}
+}
+
+func TestSlidingWindowLogRepository_Save_NewClient(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewSlidingWindowLogRepository()
+	clientID := "client1"
+	now := time.Now()
+	log := ratelimit.SlidingLog{Timestamps: []time.Time{now.Add(-time.Second), now}}
+
+	if err := repo.SaveLog(ctx, clientID, log); err != nil {
+		t.Fatalf("unexpected error saving log: %v", err)
+	}
+
+	got, err := repo.GetLog(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Timestamps) != 2 {
+		t.Fatalf("expected 2 timestamps, got %d", len(got.Timestamps))
+	}
+	if !got.Timestamps[1].Equal(now) {
+		t.Errorf("expected last timestamp %v, got %v", now, got.Timestamps[1])
+	}
+}
+
+func TestSlidingWindowLogRepository_Get_ReturnsCopy(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewSlidingWindowLogRepository()
+	clientID := "client2"
+	now := time.Now()
+	_ = repo.SaveLog(ctx, clientID, ratelimit.SlidingLog{Timestamps: []time.Time{now}})
+
+	got, _ := repo.GetLog(ctx, clientID)
+	got.Timestamps[0] = now.Add(time.Hour)
+
+	again, _ := repo.GetLog(ctx, clientID)
+	if !again.Timestamps[0].Equal(now) {
+		t.Errorf("expected stored log to be unchanged, got %v", again.Timestamps[0])
+	}
+}
+
+func TestSlidingWindowLogRepository_Save_EmptyLog(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewSlidingWindowLogRepository()
+	clientID := "client3"
+	_ = repo.SaveLog(ctx, clientID, ratelimit.SlidingLog{Timestamps: []time.Time{time.Now()}})
+
+	if err := repo.SaveLog(ctx, clientID, ratelimit.SlidingLog{}); err != nil {
+		t.Fatalf("unexpected error saving log: %v", err)
+	}
+
+	got, err := repo.GetLog(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Timestamps) != 0 {
+		t.Errorf("expected empty log, got %+v", got)
+	}
+}
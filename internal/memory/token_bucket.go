@@ -2,34 +2,86 @@ package memory
 
 import (
 	"context"
-	"sync"
+	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 )
 
+// TokenBucketRepository keeps each bucket for as long as the Redis repository
+// keeps its key, well past the time it takes to refill, so an expired bucket
+// reads as a full one.
 type TokenBucketRepository struct {
-	mu   sync.RWMutex
-	data map[string]ratelimit.TokenBucket
+	data *cache[ratelimit.TokenBucket]
+	ttl  time.Duration
 }
 
-func NewTokenBucketRepository() *TokenBucketRepository {
+func NewTokenBucketRepository(maxTokens float64, refillRate float64, opts ...Option) *TokenBucketRepository {
 	return &TokenBucketRepository{
-		data: make(map[string]ratelimit.TokenBucket),
+		data: newCache[ratelimit.TokenBucket](opts),
+		ttl:  tokenBucketTTL(maxTokens, refillRate),
 	}
 }
 
+// tokenBucketTTL is twice the time a bucket takes to refill completely, plus
+// a margin.
+func tokenBucketTTL(maxTokens float64, refillRate float64) time.Duration {
+	refillTime := time.Duration(maxTokens/refillRate) * time.Second
+	return (refillTime * 2) + (30 * time.Second)
+}
+
 func (r *TokenBucketRepository) GetBucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	if b, ok := r.data[clientID]; ok {
-		return b, nil
-	}
-	return ratelimit.TokenBucket{}, nil
+	b, _ := r.data.get(clientID, time.Now())
+	return b, nil
 }
 
 func (r *TokenBucketRepository) SaveBucket(ctx context.Context, clientID string, bucket ratelimit.TokenBucket) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.data[clientID] = bucket
+	r.data.set(clientID, bucket, time.Now().Add(r.ttl))
+	return nil
+}
+
+// TakeToken refills the client's bucket and takes n tokens from it under one
+// lock. The bucket is kept for the time its own limits need to refill it.
+func (r *TokenBucketRepository) TakeToken(ctx context.Context, clientID string, now time.Time, maxTokens float64, refillRate float64, n int) (ratelimit.TokenBucket, bool, error) {
+	allowed := false
+	bucket := r.data.update(clientID, now, func(b ratelimit.TokenBucket, found bool) (ratelimit.TokenBucket, time.Time, bool) {
+		if !found {
+			b = ratelimit.TokenBucket{Tokens: maxTokens, LastRefill: now}
+		}
+		if elapsed := now.Sub(b.LastRefill).Seconds(); elapsed > 0 {
+			b.Tokens = min(maxTokens, b.Tokens+elapsed*refillRate)
+			b.LastRefill = now
+		}
+		if b.Tokens >= float64(n) {
+			b.Tokens -= float64(n)
+			allowed = true
+		}
+		return b, now.Add(tokenBucketTTL(maxTokens, refillRate)), true
+	})
+	return bucket, allowed, nil
+}
+
+func (r *TokenBucketRepository) DeleteBucket(ctx context.Context, clientID string) error {
+	r.data.delete(clientID)
 	return nil
 }
+
+// ListBuckets returns the IDs of the clients starting with prefix that have a
+// bucket, sorted.
+func (r *TokenBucketRepository) ListBuckets(ctx context.Context, prefix string) ([]string, error) {
+	return r.data.keys(prefix, time.Now()), nil
+}
+
+// Len returns the number of buckets stored.
+func (r *TokenBucketRepository) Len() int {
+	return r.data.len()
+}
+
+// Stats reports the buckets stored and how many were expired or evicted.
+func (r *TokenBucketRepository) Stats() Stats {
+	return r.data.statistics()
+}
+
+// Close stops the janitor, if any.
+func (r *TokenBucketRepository) Close() {
+	r.data.close()
+}
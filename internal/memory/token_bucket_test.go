@@ -2,6 +2,7 @@ package memory_test
 
 import (
 	"context"
+	"slices"
 	"testing"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 )
 
 func setupRepoWithBucket(ctx context.Context, clientID string, tokens float64, lastRefill time.Time) *memory.TokenBucketRepository {
-	repo := memory.NewTokenBucketRepository()
+	repo := memory.NewTokenBucketRepository(10, 1)
 	bucket := ratelimit.TokenBucket{
 		Tokens:     tokens,
 		LastRefill: lastRefill,
@@ -20,7 +21,7 @@ func setupRepoWithBucket(ctx context.Context, clientID string, tokens float64, l
 }
 
 func TestTokenBucketRepository_Get_NonExistingClient(t *testing.T) {
-	repo := memory.NewTokenBucketRepository()
+	repo := memory.NewTokenBucketRepository(10, 1)
 	clientID := "nonexistent"
 	ctx := context.Background()
 
@@ -52,7 +53,7 @@ func TestTokenBucketRepository_Get_ExistingClient(t *testing.T) {
 
 func TestTokenBucketRepository_Save_NewClient(t *testing.T) {
 	ctx := context.Background()
-	repo := memory.NewTokenBucketRepository()
+	repo := memory.NewTokenBucketRepository(10, 1)
 	clientID := "client2"
 	bucket := ratelimit.TokenBucket{
 		Tokens:     2.0,
@@ -96,3 +97,69 @@ func TestTokenBucketRepository_Save_ExistingClient(t *testing.T) {
 		t.Errorf("expected LastRefill updated, got %v", got.LastRefill)
 	}
 }
+
+func TestTokenBucketRepository_DeleteAndList(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewTokenBucketRepository(10, 1)
+	for _, clientID := range []string{"tb:b", "tb:a", "fw:a"} {
+		repo.SaveBucket(ctx, clientID, ratelimit.TokenBucket{Tokens: 1, LastRefill: time.Now()})
+	}
+
+	got, err := repo.ListBuckets(ctx, "tb:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"tb:a", "tb:b"}) {
+		t.Fatalf("expected [tb:a tb:b], got %v", got)
+	}
+
+	if err := repo.DeleteBucket(ctx, "tb:a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ = repo.ListBuckets(ctx, "tb:")
+	if !slices.Equal(got, []string{"tb:b"}) {
+		t.Fatalf("expected [tb:b] after delete, got %v", got)
+	}
+}
+
+func TestTokenBucketRepository_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewTokenBucketRepository(10, 1, memory.WithShards(1), memory.WithMaxEntries(1))
+
+	repo.SaveBucket(ctx, "a", ratelimit.TokenBucket{Tokens: 3, LastRefill: time.Now()})
+	repo.SaveBucket(ctx, "b", ratelimit.TokenBucket{Tokens: 4, LastRefill: time.Now()})
+
+	if got, _ := repo.GetBucket(ctx, "a"); !got.LastRefill.IsZero() {
+		t.Errorf("expected a to be evicted, got %+v", got)
+	}
+	if got, _ := repo.GetBucket(ctx, "b"); got.Tokens != 4 {
+		t.Errorf("expected b to be kept, got %+v", got)
+	}
+	if stats := repo.Stats(); stats.Entries != 1 || stats.Evictions != 1 {
+		t.Errorf("expected 1 entry and 1 eviction, got %+v", stats)
+	}
+}
+
+func TestTokenBucketRepository_TakeToken(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewTokenBucketRepository(10, 1)
+	now := time.Now()
+
+	b, allowed, err := repo.TakeToken(ctx, "client", now, 3, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed || b.Tokens != 1 {
+		t.Errorf("expected 1 token left of a new bucket, got %+v allowed=%v", b, allowed)
+	}
+
+	b, allowed, _ = repo.TakeToken(ctx, "client", now, 3, 1, 2)
+	if allowed || b.Tokens != 1 {
+		t.Errorf("expected rejection leaving 1 token, got %+v allowed=%v", b, allowed)
+	}
+
+	b, allowed, _ = repo.TakeToken(ctx, "client", now.Add(time.Second), 3, 1, 2)
+	if !allowed || b.Tokens != 0 || !b.LastRefill.Equal(now.Add(time.Second)) {
+		t.Errorf("expected a refilled token to allow the request, got %+v allowed=%v", b, allowed)
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+)
+
+// RateLimiter returns limiter counting and timing its decisions under policy
+// and algorithm.
+func (m *Metrics) RateLimiter(limiter middleware.RateLimiter, policy, algorithm string) middleware.RateLimiter {
+	if m == nil {
+		return limiter
+	}
+	return &rateLimiter{next: limiter, m: m, policy: policy, algorithm: algorithm}
+}
+
+// ConcurrencyLimiter is RateLimiter for concurrency limiters. Only Acquire is
+// counted and timed.
+func (m *Metrics) ConcurrencyLimiter(limiter middleware.ConcurrencyLimiter, policy, algorithm string) middleware.ConcurrencyLimiter {
+	if m == nil {
+		return limiter
+	}
+	return &concurrencyLimiter{next: limiter, m: m, policy: policy, algorithm: algorithm}
+}
+
+type rateLimiter struct {
+	next      middleware.RateLimiter
+	m         *Metrics
+	policy    string
+	algorithm string
+}
+
+func (l *rateLimiter) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	start := time.Now()
+	decision, err := l.next.DecideN(ctx, clientID, n)
+	l.m.observeDecision(l.policy, l.algorithm, outcome(decision.Allowed, err), start)
+	return decision, err
+}
+
+type concurrencyLimiter struct {
+	next      middleware.ConcurrencyLimiter
+	m         *Metrics
+	policy    string
+	algorithm string
+}
+
+func (l *concurrencyLimiter) Acquire(ctx context.Context, clientID string) (func(context.Context) error, bool, error) {
+	start := time.Now()
+	release, acquired, err := l.next.Acquire(ctx, clientID)
+	l.m.observeDecision(l.policy, l.algorithm, outcome(acquired, err), start)
+	return release, acquired, err
+}
+
+func outcome(allowed bool, err error) string {
+	switch {
+	case err != nil:
+		return OutcomeError
+	case allowed:
+		return OutcomeAllowed
+	default:
+		return OutcomeRejected
+	}
+}
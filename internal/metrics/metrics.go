@@ -0,0 +1,101 @@
+// Package metrics exposes the decisions of the rate limiters and the latency
+// of their stores to Prometheus. It wraps the middleware and repository
+// interfaces, so every limiter and backend is instrumented the same way.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Outcomes a decision is counted under.
+const (
+	OutcomeAllowed  = "allowed"
+	OutcomeRejected = "rejected"
+	OutcomeError    = "error"
+)
+
+// Metrics holds the collectors shared by every instrumented limiter and
+// repository. A nil *Metrics is valid and instruments nothing.
+type Metrics struct {
+	decisions        *prometheus.CounterVec
+	decisionDuration *prometheus.HistogramVec
+	repoDuration     *prometheus.HistogramVec
+	memoryKeys       *memoryKeys
+}
+
+// New creates the collectors and registers them with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ratelimit_decisions_total",
+			Help: "Rate limit decisions by policy, algorithm and outcome.",
+		}, []string{"policy", "algorithm", "outcome"}),
+		decisionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ratelimit_decision_duration_seconds",
+			Help:    "Time taken to decide on a request, queueing included.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"policy", "algorithm"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ratelimit_repository_duration_seconds",
+			Help:    "Latency of rate limiter store operations by algorithm, backend and operation.",
+			Buckets: prometheus.ExponentialBuckets(0.00005, 4, 10),
+		}, []string{"algorithm", "backend", "operation"}),
+		memoryKeys: &memoryKeys{
+			desc: prometheus.NewDesc(
+				"ratelimit_memory_keys",
+				"Keys held by the in-memory stores of each algorithm.",
+				[]string{"algorithm"}, nil,
+			),
+			stores: make(map[string][]lenner),
+		},
+	}
+	reg.MustRegister(m.decisions, m.decisionDuration, m.repoDuration, m.memoryKeys)
+	return m
+}
+
+func (m *Metrics) observeDecision(policy, algorithm, outcome string, start time.Time) {
+	m.decisions.WithLabelValues(policy, algorithm, outcome).Inc()
+	m.decisionDuration.WithLabelValues(policy, algorithm).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeRepository(algorithm, backend, operation string, start time.Time) {
+	m.repoDuration.WithLabelValues(algorithm, backend, operation).Observe(time.Since(start).Seconds())
+}
+
+// lenner is implemented by the in-memory repositories.
+type lenner interface {
+	Len() int
+}
+
+// memoryKeys reports the number of keys in every in-memory store, summed per
+// algorithm, at scrape time.
+type memoryKeys struct {
+	desc   *prometheus.Desc
+	mu     sync.Mutex
+	stores map[string][]lenner
+}
+
+func (k *memoryKeys) add(algorithm string, store lenner) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.stores[algorithm] = append(k.stores[algorithm], store)
+}
+
+func (k *memoryKeys) Describe(ch chan<- *prometheus.Desc) {
+	ch <- k.desc
+}
+
+func (k *memoryKeys) Collect(ch chan<- prometheus.Metric) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for algorithm, stores := range k.stores {
+		n := 0
+		for _, s := range stores {
+			n += s.Len()
+		}
+		ch <- prometheus.MustNewConstMetric(k.desc, prometheus.GaugeValue, float64(n), algorithm)
+	}
+}
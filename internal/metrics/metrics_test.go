@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/metrics"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type stubRateLimiter struct {
+	allowed bool
+	err     error
+}
+
+func (s stubRateLimiter) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	return ratelimit.Decision{Allowed: s.allowed}, s.err
+}
+
+func TestRateLimiter_CountsOutcomes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+	ctx := context.Background()
+
+	m.RateLimiter(stubRateLimiter{allowed: true}, "fw-apikey", config.AlgorithmFixedWindow).DecideN(ctx, "a", 1)
+	m.RateLimiter(stubRateLimiter{allowed: true}, "fw-apikey", config.AlgorithmFixedWindow).DecideN(ctx, "a", 1)
+	m.RateLimiter(stubRateLimiter{}, "fw-apikey", config.AlgorithmFixedWindow).DecideN(ctx, "a", 1)
+	m.RateLimiter(stubRateLimiter{err: errors.New("down")}, "fw-apikey", config.AlgorithmFixedWindow).DecideN(ctx, "a", 1)
+
+	want := `
+# HELP ratelimit_decisions_total Rate limit decisions by policy, algorithm and outcome.
+# TYPE ratelimit_decisions_total counter
+ratelimit_decisions_total{algorithm="fixed-window",outcome="allowed",policy="fw-apikey"} 2
+ratelimit_decisions_total{algorithm="fixed-window",outcome="error",policy="fw-apikey"} 1
+ratelimit_decisions_total{algorithm="fixed-window",outcome="rejected",policy="fw-apikey"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "ratelimit_decisions_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(reg, "ratelimit_decision_duration_seconds"); n != 1 {
+		t.Errorf("expected one latency histogram, got %d", n)
+	}
+}
+
+func TestRepository_KeepsAtomicPath(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	counters := m.SlidingWindowCounterRepository(memory.NewSlidingWindowCounterRepository(), config.StorageMemory)
+	if _, ok := counters.(service.AtomicSlidingWindowCounterRepository); ok {
+		t.Fatalf("expected a repository without TakeCounter to stay without it")
+	}
+
+	repo := m.TokenBucketRepository(memory.NewTokenBucketRepository(10, 1), config.StorageMemory)
+	if _, ok := repo.(service.AtomicTokenBucketRepository); !ok {
+		t.Fatalf("expected a repository with TakeToken to keep it")
+	}
+
+	svc := service.NewTokenBucketService(repo, config.TokenBucket{MaxTokens: 2, RefillRate: 1})
+	svc.Allow(context.Background(), "a")
+	svc.Allow(context.Background(), "b")
+
+	if n := testutil.CollectAndCount(reg, "ratelimit_repository_duration_seconds"); n != 1 {
+		t.Errorf("expected a take histogram only, got %d", n)
+	}
+	want := `
+# HELP ratelimit_memory_keys Keys held by the in-memory stores of each algorithm.
+# TYPE ratelimit_memory_keys gauge
+ratelimit_memory_keys{algorithm="sliding-window-counter"} 0
+ratelimit_memory_keys{algorithm="token-bucket"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "ratelimit_memory_keys"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNilMetrics_InstrumentsNothing(t *testing.T) {
+	var m *metrics.Metrics
+	limiter := stubRateLimiter{allowed: true}
+	if got := m.RateLimiter(limiter, "p", config.AlgorithmGCRA); got != limiter {
+		t.Errorf("expected the limiter back unwrapped")
+	}
+	repo := memory.NewGCRARepository()
+	if got := m.GCRARepository(repo, config.StorageMemory); got != repo {
+		t.Errorf("expected the repository back unwrapped")
+	}
+}
@@ -0,0 +1,315 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+// The wrappers below time the reads, writes and atomic operations of a
+// repository. A repository implementing the atomic interface of its
+// algorithm is wrapped in a type that implements it too, so the service keeps
+// using the atomic path. Repositories with a Len method are also counted in
+// the memory keys gauge.
+
+// operations a repository call is timed under.
+const (
+	opGet     = "get"
+	opSave    = "save"
+	opTake    = "take"
+	opAcquire = "acquire"
+	opRenew   = "renew"
+	opRelease = "release"
+)
+
+type repo struct {
+	m         *Metrics
+	algorithm string
+	backend   string
+}
+
+func (m *Metrics) repo(algorithm, backend string, r any) repo {
+	if l, ok := r.(lenner); ok {
+		m.memoryKeys.add(algorithm, l)
+	}
+	return repo{m: m, algorithm: algorithm, backend: backend}
+}
+
+func (r repo) observe(operation string, start time.Time) {
+	r.m.observeRepository(r.algorithm, r.backend, operation, start)
+}
+
+// FixedWindowRepository instruments a fixed window repository stored in
+// backend.
+func (m *Metrics) FixedWindowRepository(r service.FixedWindowRepository, backend string) service.FixedWindowRepository {
+	if m == nil {
+		return r
+	}
+	w := &fixedWindowRepository{next: r, repo: m.repo(config.AlgorithmFixedWindow, backend, r)}
+	if a, ok := r.(service.AtomicFixedWindowRepository); ok {
+		return &atomicFixedWindowRepository{fixedWindowRepository: w, atomic: a}
+	}
+	return w
+}
+
+type fixedWindowRepository struct {
+	repo
+	next service.FixedWindowRepository
+}
+
+func (r *fixedWindowRepository) GetWindow(ctx context.Context, clientID string) (ratelimit.Window, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetWindow(ctx, clientID)
+}
+
+func (r *fixedWindowRepository) SaveWindow(ctx context.Context, clientID string, window ratelimit.Window) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveWindow(ctx, clientID, window)
+}
+
+func (r *fixedWindowRepository) DeleteWindow(ctx context.Context, clientID string) error {
+	return r.next.DeleteWindow(ctx, clientID)
+}
+
+func (r *fixedWindowRepository) ListWindows(ctx context.Context, prefix string) ([]string, error) {
+	return r.next.ListWindows(ctx, prefix)
+}
+
+type atomicFixedWindowRepository struct {
+	*fixedWindowRepository
+	atomic service.AtomicFixedWindowRepository
+}
+
+func (r *atomicFixedWindowRepository) TakeWindow(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.Window, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.TakeWindow(ctx, clientID, now, maxRequests, timeFrame, n)
+}
+
+// TokenBucketRepository instruments a token bucket repository stored in
+// backend.
+func (m *Metrics) TokenBucketRepository(r service.TokenBucketRepository, backend string) service.TokenBucketRepository {
+	if m == nil {
+		return r
+	}
+	w := &tokenBucketRepository{next: r, repo: m.repo(config.AlgorithmTokenBucket, backend, r)}
+	if a, ok := r.(service.AtomicTokenBucketRepository); ok {
+		return &atomicTokenBucketRepository{tokenBucketRepository: w, atomic: a}
+	}
+	return w
+}
+
+type tokenBucketRepository struct {
+	repo
+	next service.TokenBucketRepository
+}
+
+func (r *tokenBucketRepository) GetBucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetBucket(ctx, clientID)
+}
+
+func (r *tokenBucketRepository) SaveBucket(ctx context.Context, clientID string, bucket ratelimit.TokenBucket) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveBucket(ctx, clientID, bucket)
+}
+
+func (r *tokenBucketRepository) DeleteBucket(ctx context.Context, clientID string) error {
+	return r.next.DeleteBucket(ctx, clientID)
+}
+
+func (r *tokenBucketRepository) ListBuckets(ctx context.Context, prefix string) ([]string, error) {
+	return r.next.ListBuckets(ctx, prefix)
+}
+
+type atomicTokenBucketRepository struct {
+	*tokenBucketRepository
+	atomic service.AtomicTokenBucketRepository
+}
+
+func (r *atomicTokenBucketRepository) TakeToken(ctx context.Context, clientID string, now time.Time, maxTokens float64, refillRate float64, n int) (ratelimit.TokenBucket, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.TakeToken(ctx, clientID, now, maxTokens, refillRate, n)
+}
+
+// SlidingWindowLogRepository instruments a sliding window log repository
+// stored in backend.
+func (m *Metrics) SlidingWindowLogRepository(r service.SlidingWindowLogRepository, backend string) service.SlidingWindowLogRepository {
+	if m == nil {
+		return r
+	}
+	w := &slidingWindowLogRepository{next: r, repo: m.repo(config.AlgorithmSlidingWindowLog, backend, r)}
+	if a, ok := r.(service.AtomicSlidingWindowLogRepository); ok {
+		return &atomicSlidingWindowLogRepository{slidingWindowLogRepository: w, atomic: a}
+	}
+	return w
+}
+
+type slidingWindowLogRepository struct {
+	repo
+	next service.SlidingWindowLogRepository
+}
+
+func (r *slidingWindowLogRepository) GetLog(ctx context.Context, clientID string) (ratelimit.SlidingLog, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetLog(ctx, clientID)
+}
+
+func (r *slidingWindowLogRepository) SaveLog(ctx context.Context, clientID string, log ratelimit.SlidingLog) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveLog(ctx, clientID, log)
+}
+
+type atomicSlidingWindowLogRepository struct {
+	*slidingWindowLogRepository
+	atomic service.AtomicSlidingWindowLogRepository
+}
+
+func (r *atomicSlidingWindowLogRepository) TakeLog(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (int, time.Time, time.Time, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.TakeLog(ctx, clientID, now, maxRequests, timeFrame, n)
+}
+
+// SlidingWindowCounterRepository instruments a sliding window counter
+// repository stored in backend.
+func (m *Metrics) SlidingWindowCounterRepository(r service.SlidingWindowCounterRepository, backend string) service.SlidingWindowCounterRepository {
+	if m == nil {
+		return r
+	}
+	w := &slidingWindowCounterRepository{next: r, repo: m.repo(config.AlgorithmSlidingWindowCounter, backend, r)}
+	if a, ok := r.(service.AtomicSlidingWindowCounterRepository); ok {
+		return &atomicSlidingWindowCounterRepository{slidingWindowCounterRepository: w, atomic: a}
+	}
+	return w
+}
+
+type slidingWindowCounterRepository struct {
+	repo
+	next service.SlidingWindowCounterRepository
+}
+
+func (r *slidingWindowCounterRepository) GetCounter(ctx context.Context, clientID string) (ratelimit.SlidingWindowCounter, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetCounter(ctx, clientID)
+}
+
+func (r *slidingWindowCounterRepository) SaveCounter(ctx context.Context, clientID string, counter ratelimit.SlidingWindowCounter) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveCounter(ctx, clientID, counter)
+}
+
+type atomicSlidingWindowCounterRepository struct {
+	*slidingWindowCounterRepository
+	atomic service.AtomicSlidingWindowCounterRepository
+}
+
+func (r *atomicSlidingWindowCounterRepository) TakeCounter(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.SlidingWindowCounter, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.TakeCounter(ctx, clientID, now, maxRequests, timeFrame, n)
+}
+
+// GCRARepository instruments a GCRA repository stored in backend.
+func (m *Metrics) GCRARepository(r service.GCRARepository, backend string) service.GCRARepository {
+	if m == nil {
+		return r
+	}
+	w := &gcraRepository{next: r, repo: m.repo(config.AlgorithmGCRA, backend, r)}
+	if a, ok := r.(service.AtomicGCRARepository); ok {
+		return &atomicGCRARepository{gcraRepository: w, atomic: a}
+	}
+	return w
+}
+
+type gcraRepository struct {
+	repo
+	next service.GCRARepository
+}
+
+func (r *gcraRepository) GetTAT(ctx context.Context, clientID string) (ratelimit.GCRA, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetTAT(ctx, clientID)
+}
+
+func (r *gcraRepository) SaveTAT(ctx context.Context, clientID string, state ratelimit.GCRA) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveTAT(ctx, clientID, state)
+}
+
+type atomicGCRARepository struct {
+	*gcraRepository
+	atomic service.AtomicGCRARepository
+}
+
+func (r *atomicGCRARepository) TakeTAT(ctx context.Context, clientID string, now time.Time, emissionInterval time.Duration, burst int, n int) (ratelimit.GCRA, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.TakeTAT(ctx, clientID, now, emissionInterval, burst, n)
+}
+
+// LeakyBucketRepository instruments a leaky bucket repository stored in
+// backend.
+func (m *Metrics) LeakyBucketRepository(r service.LeakyBucketRepository, backend string) service.LeakyBucketRepository {
+	if m == nil {
+		return r
+	}
+	w := &leakyBucketRepository{next: r, repo: m.repo(config.AlgorithmLeakyBucket, backend, r)}
+	if a, ok := r.(service.AtomicLeakyBucketRepository); ok {
+		return &atomicLeakyBucketRepository{leakyBucketRepository: w, atomic: a}
+	}
+	return w
+}
+
+type leakyBucketRepository struct {
+	repo
+	next service.LeakyBucketRepository
+}
+
+func (r *leakyBucketRepository) GetLeakyBucket(ctx context.Context, clientID string) (ratelimit.LeakyBucket, error) {
+	defer r.observe(opGet, time.Now())
+	return r.next.GetLeakyBucket(ctx, clientID)
+}
+
+func (r *leakyBucketRepository) SaveLeakyBucket(ctx context.Context, clientID string, bucket ratelimit.LeakyBucket) error {
+	defer r.observe(opSave, time.Now())
+	return r.next.SaveLeakyBucket(ctx, clientID, bucket)
+}
+
+type atomicLeakyBucketRepository struct {
+	*leakyBucketRepository
+	atomic service.AtomicLeakyBucketRepository
+}
+
+func (r *atomicLeakyBucketRepository) ReserveSlot(ctx context.Context, clientID string, now time.Time, interval time.Duration, capacity int, maxWait time.Duration, n int) (time.Time, bool, error) {
+	defer r.observe(opTake, time.Now())
+	return r.atomic.ReserveSlot(ctx, clientID, now, interval, capacity, maxWait, n)
+}
+
+// ConcurrencyRepository instruments a concurrency repository stored in
+// backend.
+func (m *Metrics) ConcurrencyRepository(r service.ConcurrencyRepository, backend string) service.ConcurrencyRepository {
+	if m == nil {
+		return r
+	}
+	return &concurrencyRepository{next: r, repo: m.repo(config.AlgorithmConcurrency, backend, r)}
+}
+
+type concurrencyRepository struct {
+	repo
+	next service.ConcurrencyRepository
+}
+
+func (r *concurrencyRepository) Acquire(ctx context.Context, clientID string, leaseID string, now time.Time, limit int, ttl time.Duration) (bool, error) {
+	defer r.observe(opAcquire, time.Now())
+	return r.next.Acquire(ctx, clientID, leaseID, now, limit, ttl)
+}
+
+func (r *concurrencyRepository) Renew(ctx context.Context, clientID string, leaseID string, now time.Time, ttl time.Duration) error {
+	defer r.observe(opRenew, time.Now())
+	return r.next.Renew(ctx, clientID, leaseID, now, ttl)
+}
+
+func (r *concurrencyRepository) Release(ctx context.Context, clientID string, leaseID string) error {
+	defer r.observe(opRelease, time.Now())
+	return r.next.Release(ctx, clientID, leaseID)
+}
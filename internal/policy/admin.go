@@ -0,0 +1,162 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+// ClientState is what the admin API reports about one client of a policy.
+// Window is set for fixed-window policies and Bucket for token-bucket ones.
+type ClientState struct {
+	Policy    string                 `json:"policy"`
+	Key       string                 `json:"key"`
+	Algorithm string                 `json:"algorithm"`
+	Window    *ratelimit.Window      `json:"window,omitempty"`
+	Bucket    *ratelimit.TokenBucket `json:"bucket,omitempty"`
+	Override  *Override              `json:"override,omitempty"`
+}
+
+// Override is a temporary change to the limits of one client of a policy.
+type Override struct {
+	Limits    config.Limits `json:"limits"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// stateful is implemented by the services whose per-client state the admin
+// API can list and reset.
+type stateful interface {
+	Reset(ctx context.Context, clientID string) error
+	Clients(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Clients returns the keys of the clients of a policy that have state in its
+// store.
+func (s *Set) Clients(ctx context.Context, policy string) ([]string, error) {
+	p, svc, err := s.stateful(policy)
+	if err != nil {
+		return nil, err
+	}
+	prefix := p.policy.Name + ":"
+	ids, err := svc.Clients(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id[len(prefix):]
+	}
+	return keys, nil
+}
+
+// State returns the current state of a client of a policy, along with its
+// override when it has one.
+func (s *Set) State(ctx context.Context, policy, key string) (ClientState, error) {
+	p, _, err := s.stateful(policy)
+	if err != nil {
+		return ClientState{}, err
+	}
+	clientID := p.policy.Name + ":" + key
+
+	state := ClientState{Policy: p.policy.Name, Key: key, Algorithm: p.policy.Algorithm}
+	switch svc := p.limiter.(type) {
+	case *service.FixedWindowService:
+		window, err := svc.Window(ctx, clientID)
+		if err != nil {
+			return ClientState{}, err
+		}
+		state.Window = &window
+	case *service.TokenBucketService:
+		bucket, err := svc.Bucket(ctx, clientID)
+		if err != nil {
+			return ClientState{}, err
+		}
+		state.Bucket = &bucket
+	}
+	limits, expiresAt, err := p.overrides.GetOverride(ctx, clientID)
+	if err != nil {
+		return ClientState{}, err
+	}
+	if time.Now().Before(expiresAt) {
+		state.Override = &Override{Limits: limits, ExpiresAt: expiresAt}
+	}
+	return state, nil
+}
+
+// Reset deletes the state of a client of a policy, giving it its full limit
+// back.
+func (s *Set) Reset(ctx context.Context, policy, key string) error {
+	p, svc, err := s.stateful(policy)
+	if err != nil {
+		return err
+	}
+	return svc.Reset(ctx, p.policy.Name+":"+key)
+}
+
+// Override gives a client of a policy other limits for ttl. limits must set
+// the block of the policy's algorithm. Overrides are kept in the store of the
+// policy's state, so with Redis every instance applies them; in memory each
+// instance only knows the ones it was sent.
+func (s *Set) Override(ctx context.Context, policy, key string, limits config.Limits, ttl time.Duration) (Override, error) {
+	p, err := s.find(policy)
+	if err != nil {
+		return Override{}, err
+	}
+	if !limits.Has(p.policy.Algorithm) {
+		return Override{}, domain.NewError(domain.ErrInvalidArgument, "override of policy %q needs %s limits", policy, p.policy.Algorithm)
+	}
+	if err := limits.Validate("override"); err != nil {
+		return Override{}, err
+	}
+	if ttl <= 0 {
+		return Override{}, domain.NewError(domain.ErrInvalidArgument, "override ttl must be positive")
+	}
+
+	o := Override{Limits: limits, ExpiresAt: time.Now().Add(ttl)}
+	if err := p.overrides.SaveOverride(ctx, p.policy.Name+":"+key, o.Limits, o.ExpiresAt); err != nil {
+		return Override{}, err
+	}
+	return o, nil
+}
+
+// ClearOverride removes the override of a client of a policy before it
+// expires.
+func (s *Set) ClearOverride(ctx context.Context, policy, key string) error {
+	p, err := s.find(policy)
+	if err != nil {
+		return err
+	}
+	found, err := p.overrides.DeleteOverride(ctx, p.policy.Name+":"+key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return domain.NewError(domain.ErrNotFound, "client %q of policy %q has no override", key, policy)
+	}
+	return nil
+}
+
+func (s *Set) find(policy string) (*compiled, error) {
+	for i := range s.policies {
+		if s.policies[i].policy.Name == policy {
+			return &s.policies[i], nil
+		}
+	}
+	return nil, domain.NewError(domain.ErrNotFound, "unknown policy %q", policy)
+}
+
+func (s *Set) stateful(policy string) (*compiled, stateful, error) {
+	p, err := s.find(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc, ok := p.limiter.(stateful)
+	if !ok {
+		return nil, nil, domain.NewError(domain.ErrInvalidArgument, "policy %q uses %s, whose state cannot be inspected", policy, p.policy.Algorithm)
+	}
+	return p, svc, nil
+}
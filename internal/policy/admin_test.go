@@ -0,0 +1,196 @@
+package policy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func newAdminSet(t *testing.T) (*policy.Set, *gin.Engine) {
+	t.Helper()
+
+	key := config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"}
+	cfg := newConfig(
+		config.Policy{Name: "fw", Algorithm: config.AlgorithmFixedWindow, Key: key, Match: config.PolicyMatch{Path: "/fw"}},
+		config.Policy{Name: "tb", Algorithm: config.AlgorithmTokenBucket, Key: key, Match: config.PolicyMatch{Path: "/tb"}},
+		config.Policy{Name: "gcra", Algorithm: config.AlgorithmGCRA, Key: key, Match: config.PolicyMatch{Path: "/gcra"}},
+	)
+	cfg.RateLimiter.TokenBucket = config.TokenBucket{MaxTokens: 2, RefillRate: 1}
+	cfg.RateLimiter.GCRA = config.GCRA{Rate: 1, Burst: 1}
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	for _, path := range []string{"/fw", "/tb", "/gcra"} {
+		r.GET(path, append(set.Middleware(http.MethodGet, path), func(c *gin.Context) {
+			c.String(http.StatusOK, "pong")
+		})...)
+	}
+	return set, r
+}
+
+func errorCode(t *testing.T, err error) domain.ErrorCode {
+	t.Helper()
+
+	var e *domain.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *domain.Error, got %v", err)
+	}
+	return e.Code()
+}
+
+func TestSet_StateAndReset(t *testing.T) {
+	set, r := newAdminSet(t)
+	ctx := context.Background()
+	alice := http.Header{"X-Api-Key": {"alice"}}
+
+	get(r, "/fw", alice)
+	get(r, "/tb", alice)
+	if code := get(r, "/fw", alice); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+
+	clients, err := set.Clients(ctx, "fw")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(clients, []string{"alice"}) {
+		t.Fatalf("expected clients [alice], got %v", clients)
+	}
+
+	state, err := set.State(ctx, "fw", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.Window == nil || state.Window.Count != 1 || state.Bucket != nil {
+		t.Fatalf("expected a window with count 1, got %+v", state)
+	}
+
+	state, _ = set.State(ctx, "tb", "alice")
+	if state.Bucket == nil || state.Bucket.Tokens >= 2 {
+		t.Fatalf("expected a bucket missing a token, got %+v", state)
+	}
+
+	if err := set.Reset(ctx, "fw", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code := get(r, "/fw", alice); code != http.StatusOK {
+		t.Fatalf("expected 200 after reset, got %d", code)
+	}
+}
+
+func TestSet_State_Errors(t *testing.T) {
+	set, _ := newAdminSet(t)
+	ctx := context.Background()
+
+	if _, err := set.State(ctx, "missing", "alice"); errorCode(t, err) != domain.ErrNotFound {
+		t.Errorf("expected ErrNotFound for an unknown policy, got %v", err)
+	}
+	if err := set.Reset(ctx, "gcra", "alice"); errorCode(t, err) != domain.ErrInvalidArgument {
+		t.Errorf("expected ErrInvalidArgument for a gcra policy, got %v", err)
+	}
+}
+
+func TestSet_Override(t *testing.T) {
+	set, r := newAdminSet(t)
+	ctx := context.Background()
+	alice := http.Header{"X-Api-Key": {"alice"}}
+	bob := http.Header{"X-Api-Key": {"bob"}}
+
+	limits := config.Limits{GCRA: &config.GCRA{Rate: 1, Burst: 3}}
+	if _, err := set.Override(ctx, "gcra", "alice", limits, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	allowed := func(h http.Header) int {
+		n := 0
+		for i := 0; i < 5; i++ {
+			if get(r, "/gcra", h) == http.StatusOK {
+				n++
+			}
+		}
+		return n
+	}
+	if got := allowed(alice); got != 3 {
+		t.Errorf("expected 3 requests allowed with the override, got %d", got)
+	}
+	if got := allowed(bob); got != 1 {
+		t.Errorf("expected 1 request allowed without an override, got %d", got)
+	}
+
+	state, err := set.State(ctx, "fw", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.Override != nil {
+		t.Errorf("expected the gcra override not to show on policy fw")
+	}
+
+	if err := set.ClearOverride(ctx, "gcra", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := set.ClearOverride(ctx, "gcra", "alice"); errorCode(t, err) != domain.ErrNotFound {
+		t.Errorf("expected ErrNotFound for a cleared override, got %v", err)
+	}
+}
+
+func TestSet_Override_Expires(t *testing.T) {
+	set, r := newAdminSet(t)
+	alice := http.Header{"X-Api-Key": {"alice"}}
+
+	limits := config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 5, TimeFrameMs: 60000}}
+	if _, err := set.Override(context.Background(), "fw", "alice", limits, 20*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, _ := set.State(context.Background(), "fw", "alice"); state.Override == nil {
+		t.Fatalf("expected the override in the client state")
+	}
+	get(r, "/fw", alice)
+	if code := get(r, "/fw", alice); code != http.StatusOK {
+		t.Fatalf("expected 200 under the override, got %d", code)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if code := get(r, "/fw", alice); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the override expired, got %d", code)
+	}
+}
+
+func TestSet_Override_Invalid(t *testing.T) {
+	set, _ := newAdminSet(t)
+	fw := config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 5, TimeFrameMs: 60000}}
+
+	tests := map[string]struct {
+		policy string
+		limits config.Limits
+		ttl    time.Duration
+		want   domain.ErrorCode
+	}{
+		"unknown policy":  {"missing", fw, time.Minute, domain.ErrNotFound},
+		"wrong algorithm": {"tb", fw, time.Minute, domain.ErrInvalidArgument},
+		"invalid limits":  {"fw", config.Limits{FixedWindow: &config.FixedWindow{}}, time.Minute, domain.ErrInvalidArgument},
+		"no ttl":          {"fw", fw, 0, domain.ErrInvalidArgument},
+	}
+	for name, tt := range tests {
+		_, err := set.Override(context.Background(), tt.policy, "alice", tt.limits, tt.ttl)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if code := errorCode(t, err); code != tt.want {
+			t.Errorf("%s: expected code %v, got %v", name, tt.want, code)
+		}
+	}
+}
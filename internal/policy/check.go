@@ -0,0 +1,57 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+// Check decides on a request of cost units from key under a policy, the way
+// the policy's middleware would, for services that cannot run the
+// middleware. key is the raw client key, without the policy prefix. A
+// fail-open policy whose store fails allows the request with an empty quota.
+func (s *Set) Check(ctx context.Context, policy, key string, cost int) (ratelimit.Decision, error) {
+	p, err := s.find(policy)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+	if p.decide == nil {
+		return ratelimit.Decision{}, domain.NewError(domain.ErrInvalidArgument, "policy %q uses %s, which holds a slot for the length of a request and cannot be checked", policy, p.policy.Algorithm)
+	}
+	if key == "" {
+		return ratelimit.Decision{}, domain.NewError(domain.ErrInvalidArgument, "missing key")
+	}
+
+	clientID := p.policy.Name + ":" + key
+	decision, err := p.decide.DecideN(ctx, clientID, cost)
+	if err == nil || cancelled(err) || invalid(err) {
+		return decision, err
+	}
+
+	if p.fallback != nil {
+		decision, err = p.fallback.DecideN(ctx, clientID, cost)
+		if err == nil || cancelled(err) {
+			return decision, err
+		}
+	}
+	if p.policy.OnError == config.OnErrorFailOpen {
+		log.Printf("rate limiter failed for %q, letting the request through: %v", clientID, err)
+		return ratelimit.Decision{Allowed: true}, nil
+	}
+	return ratelimit.Decision{}, err
+}
+
+func cancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// invalid reports whether err rejects the request itself, such as a cost
+// below one, rather than reporting a failed store.
+func invalid(err error) bool {
+	var e *domain.Error
+	return errors.As(err, &e) && e.Code() == domain.ErrInvalidArgument
+}
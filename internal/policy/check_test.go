@@ -0,0 +1,78 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+)
+
+func TestSet_Check(t *testing.T) {
+	set, _ := newAdminSet(t)
+	ctx := context.Background()
+
+	decision, err := set.Check(ctx, "tb", "alice", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decision.Allowed || decision.Limit != 2 || decision.Remaining != 0 {
+		t.Errorf("expected allowed with 0 of 2 left, got %+v", decision)
+	}
+
+	decision, err = set.Check(ctx, "tb", "alice", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decision.Allowed || decision.RetryAfter <= 0 {
+		t.Errorf("expected rejected with a retry delay, got %+v", decision)
+	}
+
+	// Keys are scoped to the policy like the middleware's client IDs.
+	if decision, _ := set.Check(ctx, "tb", "bob", 1); !decision.Allowed {
+		t.Error("expected bob to have a bucket of their own")
+	}
+	state, err := set.State(ctx, "tb", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state.Bucket == nil || state.Bucket.Tokens >= 1 {
+		t.Errorf("expected the checks to show in the client state, got %+v", state)
+	}
+}
+
+func TestSet_Check_Errors(t *testing.T) {
+	key := config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"}
+	cfg := newConfig(
+		config.Policy{Name: "fw", Algorithm: config.AlgorithmFixedWindow, Key: key, Match: config.PolicyMatch{Path: "/fw"}},
+		config.Policy{Name: "cc", Algorithm: config.AlgorithmConcurrency, Key: key, Match: config.PolicyMatch{Path: "/cc"}},
+	)
+	cfg.RateLimiter.Concurrency = config.Concurrency{MaxInFlight: 1, LeaseTTLMs: 30000}
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]struct {
+		policy, key string
+		cost        int
+		want        domain.ErrorCode
+	}{
+		"unknown policy": {"nope", "alice", 1, domain.ErrNotFound},
+		"concurrency":    {"cc", "alice", 1, domain.ErrInvalidArgument},
+		"missing key":    {"fw", "", 1, domain.ErrInvalidArgument},
+		"zero cost":      {"fw", "alice", 0, domain.ErrInvalidArgument},
+	}
+	for name, tt := range tests {
+		_, err := set.Check(context.Background(), tt.policy, tt.key, tt.cost)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if code := errorCode(t, err); code != tt.want {
+			t.Errorf("%s: expected code %v, got %v", name, tt.want, code)
+		}
+	}
+}
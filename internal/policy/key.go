@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// keyFunc returns the function reading the client key of a policy. Keys are
+// prefixed with the policy name so policies sharing a store never share a
+// counter. An empty key is left empty for the middleware to reject.
+func keyFunc(policy string, k config.PolicyKey) (func(*gin.Context) string, error) {
+	var read func(*gin.Context) string
+	switch k.Source {
+	case config.KeySourceHeader:
+		read = func(c *gin.Context) string { return c.GetHeader(k.Name) }
+	case config.KeySourceIP:
+		read = func(c *gin.Context) string { return c.ClientIP() }
+	case config.KeySourceQuery:
+		read = func(c *gin.Context) string { return c.Query(k.Name) }
+	case config.KeySourceJWTClaim:
+		secret := []byte(k.JWTSecret)
+		read = func(c *gin.Context) string { return jwtClaim(c.GetHeader("Authorization"), k.Name, secret, time.Now()) }
+	case config.KeySourceDescriptor:
+		// Descriptor keys come from Envoy through Check; the middleware of
+		// these policies is never attached to a route.
+		read = func(*gin.Context) string { return "" }
+	default:
+		return nil, domain.NewError(domain.ErrInvalidArgument, "unknown key source %q in policy %q", k.Source, policy)
+	}
+
+	return func(c *gin.Context) string {
+		key := read(c)
+		if key == "" {
+			return ""
+		}
+		return policy + ":" + key
+	}, nil
+}
+
+// jwtClaim reads a claim from the bearer token in an Authorization header. With
+// a secret the token must be a valid, unexpired HS256 token; without one the
+// claims are read as they are, which only suits tokens already verified by a
+// proxy in front of the service. Claims that are not strings or numbers, and
+// tokens that fail to parse, give an empty key.
+func jwtClaim(authorization, claim string, secret []byte, now time.Time) string {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return ""
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	if len(secret) > 0 && !verifyHS256(parts, secret) {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims map[string]any
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return ""
+	}
+
+	if len(secret) > 0 {
+		if exp, ok := claims["exp"].(json.Number); ok {
+			if seconds, err := exp.Int64(); err != nil || now.Unix() >= seconds {
+				return ""
+			}
+		}
+	}
+
+	switch v := claims[claim].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func verifyHS256(parts []string, secret []byte) bool {
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
@@ -0,0 +1,362 @@
+package policy
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/metrics"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Set holds the middleware of every policy in the config, ready to be attached
+// to the routes they match.
+type Set struct {
+	headerStyle string
+	policies    []compiled
+	tiers       atomic.Pointer[tierTable]
+	metrics     *metrics.Metrics
+	// critical holds the health checks of the stores backing fail-closed
+	// policies.
+	critical map[string]bool
+}
+
+// Option customises a Set.
+type Option func(*Set)
+
+// WithMetrics counts and times the decisions of every policy.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Set) {
+		s.metrics = m
+	}
+}
+
+type compiled struct {
+	policy  config.Policy
+	handler gin.HandlerFunc
+	// limiter is the policy's service, kept for the admin API.
+	limiter any
+	// decide and fallback serve the decision API. decide is nil for
+	// concurrency policies, which hold a slot for the length of a request.
+	decide   middleware.RateLimiter
+	fallback middleware.RateLimiter
+	// setLimits hands new limits to the policy's running service.
+	setLimits func(p config.Policy, defaults config.RateLimiter)
+	// overrides holds the limits set through the admin API, next to the
+	// policy's state.
+	overrides storage.OverrideRepository
+}
+
+// New builds a limiter for each policy in cfg, keeping its state in the
+// backend the storage section picks for the policy's algorithm.
+func New(cfg *config.Config, repos *storage.Factory, opts ...Option) (*Set, error) {
+	headerStyle, err := middleware.ParseHeaderStyle(cfg.RateLimiter.HeaderStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{
+		headerStyle: cfg.RateLimiter.HeaderStyle,
+		policies:    make([]compiled, 0, len(cfg.Policies)),
+		critical:    make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(set)
+	}
+	set.tiers.Store(newTierTable(cfg.Tiers, cfg.Clients))
+	for _, p := range cfg.Policies {
+		c, err := build(cfg, repos, set, p, headerStyle)
+		if err != nil {
+			return nil, err
+		}
+		set.policies = append(set.policies, c)
+
+		if p.OnError == "" || p.OnError == config.OnErrorFailClosed {
+			if name, ok := repos.CheckName(p.Algorithm); ok {
+				set.critical[name] = true
+			}
+		}
+	}
+	return set, nil
+}
+
+// Critical reports whether the health check name covers the store of a
+// fail-closed policy, whose requests fail while it is down. The other
+// policies keep serving through their on-error mode.
+func (s *Set) Critical(name string) bool {
+	return s.critical[name]
+}
+
+// Reload applies the limits of cfg to the running policies, tiers and clients
+// included. Only limits can change this way: when a policy was added, removed
+// or changed in anything but its limits, or the header style changed, nothing
+// is applied and an error says a restart is needed. The sections outside the
+// policies are not looked at; config.Config.RestartSections lists those that
+// changed.
+func (s *Set) Reload(cfg *config.Config) error {
+	if cfg.RateLimiter.HeaderStyle != s.headerStyle {
+		return domain.NewError(domain.ErrInvalidArgument, "header style changed from %q to %q, restart to apply", s.headerStyle, cfg.RateLimiter.HeaderStyle)
+	}
+	if len(cfg.Policies) != len(s.policies) {
+		return domain.NewError(domain.ErrInvalidArgument, "policies were added or removed, restart to apply")
+	}
+	for i, p := range cfg.Policies {
+		if !sameShape(s.policies[i].policy, p) {
+			return domain.NewError(domain.ErrInvalidArgument, "policy %q changed more than its limits, restart to apply", p.Name)
+		}
+	}
+
+	s.tiers.Store(newTierTable(cfg.Tiers, cfg.Clients))
+	for i, p := range cfg.Policies {
+		s.policies[i].setLimits(p, cfg.RateLimiter)
+	}
+	return nil
+}
+
+// sameShape reports whether two policies only differ in their limits.
+func sameShape(a, b config.Policy) bool {
+	return a.Name == b.Name &&
+		a.Algorithm == b.Algorithm &&
+		a.Key == b.Key &&
+		slices.Equal(a.Match.Methods, b.Match.Methods) &&
+		a.Match.Path == b.Match.Path &&
+		a.Cost == b.Cost &&
+		a.Tiered == b.Tiered &&
+		a.OnError == b.OnError
+}
+
+// Middleware returns the handlers of the policies matching a route, in the
+// order the policies are configured. path is the route pattern as registered
+// with gin, not the request path. Descriptor policies match no route.
+func (s *Set) Middleware(method, path string) []gin.HandlerFunc {
+	var handlers []gin.HandlerFunc
+	for _, p := range s.policies {
+		if p.policy.Key.Source != config.KeySourceDescriptor && matches(p.policy.Match, method, path) {
+			handlers = append(handlers, p.handler)
+		}
+	}
+	return handlers
+}
+
+func matches(m config.PolicyMatch, method, path string) bool {
+	if len(m.Methods) > 0 {
+		found := false
+		for _, allowed := range m.Methods {
+			if strings.EqualFold(allowed, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case m.Path == "":
+		return true
+	case strings.HasSuffix(m.Path, "/*"):
+		return strings.HasPrefix(path, strings.TrimSuffix(m.Path, "*"))
+	default:
+		return m.Path == path
+	}
+}
+
+func build(cfg *config.Config, repos *storage.Factory, set *Set, p config.Policy, headerStyle middleware.HeaderStyle) (compiled, error) {
+	key, err := keyFunc(p.Name, p.Key)
+	if err != nil {
+		return compiled{}, err
+	}
+	repos = repos.ForPolicy(p.Name)
+	overrides, err := repos.OverrideRepository(p.Algorithm)
+	if err != nil {
+		return compiled{}, err
+	}
+
+	opts := []middleware.Option{
+		middleware.WithHeaderStyle(headerStyle),
+		middleware.WithPolicyName(p.Name),
+		middleware.WithCost(costFunc(p.Cost)),
+	}
+	if p.OnError == config.OnErrorFailOpen {
+		opts = append(opts, middleware.WithFailOpen())
+	}
+
+	if p.Algorithm == config.AlgorithmConcurrency {
+		svc, setLimits, err := concurrencyLimiter(cfg, repos, set, p, overrides)
+		if err != nil {
+			return compiled{}, err
+		}
+		if p.OnError == config.OnErrorFallback {
+			fallback, setFallbackLimits, err := concurrencyLimiter(cfg, repos.Local(), set, p, nil)
+			if err != nil {
+				return compiled{}, err
+			}
+			opts = append(opts, middleware.WithConcurrencyFallback(fallback))
+			setLimits = both(setLimits, setFallbackLimits)
+		}
+		return compiled{
+			policy:    p,
+			handler:   middleware.ConcurrencyLimit(set.metrics.ConcurrencyLimiter(svc, p.Name, p.Algorithm), key, opts...),
+			limiter:   svc,
+			setLimits: setLimits,
+			overrides: overrides,
+		}, nil
+	}
+
+	limiter, setLimits, err := rateLimiter(cfg, repos, set, p, overrides)
+	if err != nil {
+		return compiled{}, err
+	}
+	var fallback middleware.RateLimiter
+	if p.OnError == config.OnErrorFallback {
+		var setFallbackLimits func(config.Policy, config.RateLimiter)
+		fallback, setFallbackLimits, err = rateLimiter(cfg, repos.Local(), set, p, nil)
+		if err != nil {
+			return compiled{}, err
+		}
+		opts = append(opts, middleware.WithFallback(fallback))
+		setLimits = both(setLimits, setFallbackLimits)
+	}
+	decide := set.metrics.RateLimiter(limiter, p.Name, p.Algorithm)
+	return compiled{
+		policy:    p,
+		handler:   middleware.RateLimit(decide, key, opts...),
+		limiter:   limiter,
+		decide:    decide,
+		fallback:  fallback,
+		setLimits: setLimits,
+		overrides: overrides,
+	}, nil
+}
+
+// both returns a function updating the limits of two services, used to keep
+// a fallback in step with the service it stands in for.
+func both(a, b func(config.Policy, config.RateLimiter)) func(config.Policy, config.RateLimiter) {
+	return func(p config.Policy, defaults config.RateLimiter) {
+		a(p, defaults)
+		b(p, defaults)
+	}
+}
+
+// concurrencyLimiter is rateLimiter for concurrency policies.
+func concurrencyLimiter(cfg *config.Config, repos *storage.Factory, set *Set, p config.Policy, overrides storage.OverrideRepository) (*service.ConcurrencyService, func(config.Policy, config.RateLimiter), error) {
+	repo, err := repos.ConcurrencyRepository()
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := service.NewConcurrencyService(repo, orDefault(p.Concurrency, cfg.RateLimiter.Concurrency))
+	svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.Concurrency { return l.Concurrency }))
+	return svc, func(p config.Policy, defaults config.RateLimiter) {
+		svc.SetConfig(orDefault(p.Concurrency, defaults.Concurrency))
+	}, nil
+}
+
+// rateLimiter builds the service of a policy together with the function that
+// updates its limits. Tiered policies look up each client in the tier table
+// first, and every policy honours the overrides in overrides, if any. The
+// fallbacks get none: they stand in while the store holding the overrides
+// fails.
+func rateLimiter(cfg *config.Config, repos *storage.Factory, set *Set, p config.Policy, overrides storage.OverrideRepository) (middleware.RateLimiter, func(config.Policy, config.RateLimiter), error) {
+	switch p.Algorithm {
+	case config.AlgorithmFixedWindow:
+		params := orDefault(p.FixedWindow, cfg.RateLimiter.FixedWindow)
+		repo, err := repos.FixedWindowRepository()
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewFixedWindowService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.FixedWindow { return l.FixedWindow }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.FixedWindow, defaults.FixedWindow))
+		}, nil
+	case config.AlgorithmTokenBucket:
+		params := orDefault(p.TokenBucket, cfg.RateLimiter.TokenBucket)
+		repo, err := repos.TokenBucketRepository(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewTokenBucketService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.TokenBucket { return l.TokenBucket }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.TokenBucket, defaults.TokenBucket))
+		}, nil
+	case config.AlgorithmSlidingWindowLog:
+		params := orDefault(p.SlidingWindowLog, cfg.RateLimiter.SlidingWindowLog)
+		repo, err := repos.SlidingWindowLogRepository(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewSlidingWindowLogService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.SlidingWindowLog { return l.SlidingWindowLog }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.SlidingWindowLog, defaults.SlidingWindowLog))
+		}, nil
+	case config.AlgorithmSlidingWindowCounter:
+		params := orDefault(p.SlidingWindowCounter, cfg.RateLimiter.SlidingWindowCounter)
+		repo, err := repos.SlidingWindowCounterRepository(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewSlidingWindowCounterService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.SlidingWindowCounter { return l.SlidingWindowCounter }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.SlidingWindowCounter, defaults.SlidingWindowCounter))
+		}, nil
+	case config.AlgorithmGCRA:
+		params := orDefault(p.GCRA, cfg.RateLimiter.GCRA)
+		repo, err := repos.GCRARepository()
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewGCRAService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.GCRA { return l.GCRA }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.GCRA, defaults.GCRA))
+		}, nil
+	case config.AlgorithmLeakyBucket:
+		params := orDefault(p.LeakyBucket, cfg.RateLimiter.LeakyBucket)
+		repo, err := repos.LeakyBucketRepository(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := service.NewLeakyBucketService(repo, params)
+		svc.SetLimitSource(limitSource(p, set, overrides, func(l config.Limits) *config.LeakyBucket { return l.LeakyBucket }))
+		return svc, func(p config.Policy, defaults config.RateLimiter) {
+			svc.SetConfig(orDefault(p.LeakyBucket, defaults.LeakyBucket))
+		}, nil
+	default:
+		return nil, nil, domain.NewError(domain.ErrInvalidArgument, "unknown algorithm %q in policy %q", p.Algorithm, p.Name)
+	}
+}
+
+// orDefault returns the policy's own parameters, or the rate-limiter defaults
+// when the policy has none.
+func orDefault[T any](params *T, def T) T {
+	if params != nil {
+		return *params
+	}
+	return def
+}
+
+func costFunc(c config.PolicyCost) middleware.CostFunc {
+	maxCost := c.Max
+	if maxCost == 0 {
+		maxCost = middleware.DefaultMaxCost
+	}
+	switch {
+	case c.Header != "":
+		return middleware.HeaderCost(c.Header, maxCost)
+	case c.BodyBytesPerUnit > 0:
+		return middleware.BodySizeCost(c.BodyBytesPerUnit, maxCost)
+	case c.Fixed > 0:
+		return middleware.FixedCost(c.Fixed)
+	default:
+		return middleware.FixedCost(1)
+	}
+}
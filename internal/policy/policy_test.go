@@ -0,0 +1,446 @@
+package policy_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+func newConfig(policies ...config.Policy) *config.Config {
+	return &config.Config{
+		Storage: config.Storage{
+			FixedWindow:          config.StorageMemory,
+			TokenBucket:          config.StorageMemory,
+			SlidingWindowLog:     config.StorageMemory,
+			SlidingWindowCounter: config.StorageMemory,
+			GCRA:                 config.StorageMemory,
+			LeakyBucket:          config.StorageMemory,
+			Concurrency:          config.StorageMemory,
+		},
+		RateLimiter: config.RateLimiter{
+			FixedWindow: config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000},
+		},
+		Policies: policies,
+	}
+}
+
+func newRouter(t *testing.T, cfg *config.Config, routes ...string) *gin.Engine {
+	t.Helper()
+
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	for _, path := range routes {
+		handlers := append(set.Middleware(http.MethodGet, path), func(c *gin.Context) {
+			c.String(http.StatusOK, "pong")
+		})
+		r.GET(path, handlers...)
+	}
+	return r
+}
+
+func get(r *gin.Engine, path string, header http.Header) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSet_Middleware_Match(t *testing.T) {
+	cfg := newConfig(
+		config.Policy{Name: "exact", Algorithm: config.AlgorithmGCRA, Key: config.PolicyKey{Source: config.KeySourceIP},
+			Match: config.PolicyMatch{Methods: []string{"GET"}, Path: "/a/ping"}},
+		config.Policy{Name: "prefix", Algorithm: config.AlgorithmGCRA, Key: config.PolicyKey{Source: config.KeySourceIP},
+			Match: config.PolicyMatch{Path: "/a/*"}},
+		config.Policy{Name: "post", Algorithm: config.AlgorithmGCRA, Key: config.PolicyKey{Source: config.KeySourceIP},
+			Match: config.PolicyMatch{Methods: []string{"post"}}},
+		// Descriptor policies serve Envoy and match no route.
+		config.Policy{Name: "envoy", Algorithm: config.AlgorithmGCRA, Key: config.PolicyKey{Source: config.KeySourceDescriptor, Name: "remote_address"}},
+	)
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/a/ping", 2},
+		{http.MethodGet, "/a/other", 1},
+		{http.MethodGet, "/b/ping", 0},
+		{http.MethodPost, "/b/ping", 1},
+		{http.MethodPost, "/a/ping", 2},
+	}
+	for _, tt := range tests {
+		if got := len(set.Middleware(tt.method, tt.path)); got != tt.want {
+			t.Errorf("%s %s: expected %d handlers, got %d", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestSet_HeaderKey(t *testing.T) {
+	r := newRouter(t, newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"},
+	}), "/ping")
+
+	client1 := http.Header{"X-Api-Key": {"client1"}}
+	if code := get(r, "/ping", client1); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping", client1); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for second request, got %d", code)
+	}
+	if code := get(r, "/ping", http.Header{"X-Api-Key": {"client2"}}); code != http.StatusOK {
+		t.Fatalf("expected 200 for another client, got %d", code)
+	}
+	if code := get(r, "/ping", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without key, got %d", code)
+	}
+}
+
+func TestSet_QueryKey(t *testing.T) {
+	r := newRouter(t, newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceQuery, Name: "user"},
+	}), "/ping")
+
+	if code := get(r, "/ping?user=alice", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping?user=alice", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+	if code := get(r, "/ping?user=bob", nil); code != http.StatusOK {
+		t.Fatalf("expected 200 for another user, got %d", code)
+	}
+}
+
+func TestSet_PoliciesDoNotShareCounters(t *testing.T) {
+	key := config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"}
+	r := newRouter(t, newConfig(
+		config.Policy{Name: "a", Algorithm: config.AlgorithmFixedWindow, Key: key, Match: config.PolicyMatch{Path: "/a"}},
+		config.Policy{Name: "b", Algorithm: config.AlgorithmFixedWindow, Key: key, Match: config.PolicyMatch{Path: "/b"}},
+	), "/a", "/b")
+
+	client1 := http.Header{"X-Api-Key": {"client1"}}
+	if code := get(r, "/a", client1); code != http.StatusOK {
+		t.Fatalf("expected 200 on /a, got %d", code)
+	}
+	if code := get(r, "/b", client1); code != http.StatusOK {
+		t.Fatalf("expected 200 on /b, got %d", code)
+	}
+}
+
+func TestSet_PolicyParameters(t *testing.T) {
+	r := newRouter(t, newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceIP},
+		Limits:    config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 3, TimeFrameMs: 60000}},
+	}), "/ping")
+
+	for i := 0; i < 3; i++ {
+		if code := get(r, "/ping", nil); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, code)
+		}
+	}
+	if code := get(r, "/ping", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+}
+
+func token(t *testing.T, header, payload string, secret []byte) string {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestSet_JWTClaimKey(t *testing.T) {
+	secret := []byte("s3cret")
+	r := newRouter(t, newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceJWTClaim, Name: "sub", JWTSecret: string(secret)},
+	}), "/ping")
+
+	bearer := func(tok string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + tok}}
+	}
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	exp := time.Now().Add(time.Hour).Unix()
+
+	alice := token(t, hs256, `{"sub":"alice","exp":`+strconv.FormatInt(exp, 10)+`}`, secret)
+	if code := get(r, "/ping", bearer(alice)); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping", bearer(alice)); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+
+	tests := map[string]string{
+		"wrong secret": token(t, hs256, `{"sub":"bob"}`, []byte("other")),
+		"expired":      token(t, hs256, `{"sub":"bob","exp":1}`, secret),
+		"none alg":     token(t, `{"alg":"none"}`, `{"sub":"bob"}`, secret),
+		"no claim":     token(t, hs256, `{"name":"bob"}`, secret),
+		"not a jwt":    "abc",
+	}
+	for name, tok := range tests {
+		if code := get(r, "/ping", bearer(tok)); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, code)
+		}
+	}
+}
+
+func TestSet_JWTClaimKey_Unverified(t *testing.T) {
+	r := newRouter(t, newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceJWTClaim, Name: "tenant"},
+	}), "/ping")
+
+	tok := token(t, `{"alg":"HS256"}`, `{"tenant":42}`, []byte("whatever"))
+	header := http.Header{"Authorization": {"Bearer " + tok}}
+	if code := get(r, "/ping", header); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping", header); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+}
+
+func TestNew_InvalidHeaderStyle(t *testing.T) {
+	cfg := newConfig()
+	cfg.RateLimiter.HeaderStyle = "fancy"
+	if _, err := policy.New(cfg, storage.NewFactory(cfg)); err == nil {
+		t.Fatal("expected error for unknown header style")
+	}
+}
+
+func TestSet_Reload(t *testing.T) {
+	cfg := newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceIP},
+	})
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", append(set.Middleware(http.MethodGet, "/ping"), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})...)
+
+	if code := get(r, "/ping", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 with the initial limit, got %d", code)
+	}
+
+	raised := newConfig(config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceIP},
+		Limits:    config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 3, TimeFrameMs: 60000}},
+	})
+	if err := set.Reload(raised); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if code := get(r, "/ping", nil); code != http.StatusOK {
+		t.Fatalf("expected 200 after raising the limit, got %d", code)
+	}
+}
+
+func TestSet_Reload_RejectsShapeChanges(t *testing.T) {
+	p := config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceIP},
+	}
+	cfg := newConfig(p)
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	moved := p
+	moved.Match = config.PolicyMatch{Path: "/other"}
+	restyled := newConfig(p)
+	restyled.RateLimiter.HeaderStyle = "legacy"
+
+	tests := map[string]*config.Config{
+		"policy added":        newConfig(p, config.Policy{Name: "new", Algorithm: config.AlgorithmGCRA, Key: p.Key}),
+		"match changed":       newConfig(moved),
+		"header style change": restyled,
+	}
+	for name, next := range tests {
+		if err := set.Reload(next); err == nil {
+			t.Errorf("%s: expected reload to be rejected", name)
+		}
+	}
+}
+
+func TestSet_Tiers(t *testing.T) {
+	fw := func(n int) *config.FixedWindow {
+		return &config.FixedWindow{MaxRequests: n, TimeFrameMs: 60000}
+	}
+	key := config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"}
+	cfg := newConfig(
+		config.Policy{Name: "tiered", Algorithm: config.AlgorithmFixedWindow, Key: key, Tiered: true, Match: config.PolicyMatch{Path: "/tiered"}},
+		config.Policy{Name: "flat", Algorithm: config.AlgorithmFixedWindow, Key: key, Match: config.PolicyMatch{Path: "/flat"}},
+	)
+	cfg.Tiers = []config.Tier{
+		{Name: "enterprise", Limits: config.Limits{FixedWindow: fw(3)}},
+	}
+	cfg.Clients = []config.Client{
+		{Key: "big", Tier: "enterprise"},
+		{Key: "custom", Tier: "enterprise", Limits: config.Limits{FixedWindow: fw(2)}},
+	}
+	r := newRouter(t, cfg, "/tiered", "/flat")
+
+	allowed := func(path, client string) int {
+		n := 0
+		for i := 0; i < 5; i++ {
+			if get(r, path, http.Header{"X-Api-Key": {client}}) == http.StatusOK {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		path, client string
+		want         int
+	}{
+		{"/tiered", "big", 3},
+		{"/tiered", "custom", 2},
+		{"/tiered", "unknown", 1},
+		{"/flat", "big", 1},
+	}
+	for _, tt := range tests {
+		if got := allowed(tt.path, tt.client); got != tt.want {
+			t.Errorf("%s as %s: expected %d requests allowed, got %d", tt.path, tt.client, tt.want, got)
+		}
+	}
+}
+
+func TestSet_Reload_Tiers(t *testing.T) {
+	p := config.Policy{
+		Name:      "fw",
+		Algorithm: config.AlgorithmFixedWindow,
+		Key:       config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"},
+		Tiered:    true,
+	}
+	cfg := newConfig(p)
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", append(set.Middleware(http.MethodGet, "/ping"), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})...)
+	partner := http.Header{"X-Api-Key": {"partner"}}
+
+	if code := get(r, "/ping", partner); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := get(r, "/ping", partner); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 before the partner has a tier, got %d", code)
+	}
+
+	upgraded := newConfig(p)
+	upgraded.Tiers = []config.Tier{{Name: "gold", Limits: config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 5, TimeFrameMs: 60000}}}}
+	upgraded.Clients = []config.Client{{Key: "partner", Tier: "gold"}}
+	if err := set.Reload(upgraded); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if code := get(r, "/ping", partner); code != http.StatusOK {
+		t.Fatalf("expected 200 after moving the partner to gold, got %d", code)
+	}
+}
+
+func TestSet_OnError(t *testing.T) {
+	tests := map[string]struct {
+		onError string
+		want    []int
+	}{
+		"fail closed": {config.OnErrorFailClosed, []int{http.StatusInternalServerError, http.StatusInternalServerError}},
+		"fail open":   {config.OnErrorFailOpen, []int{http.StatusOK, http.StatusOK}},
+		"fallback":    {config.OnErrorFallback, []int{http.StatusOK, http.StatusTooManyRequests}},
+	}
+	for name, tt := range tests {
+		cfg := newConfig(config.Policy{
+			Name:      "fw",
+			Algorithm: config.AlgorithmFixedWindow,
+			Key:       config.PolicyKey{Source: config.KeySourceIP},
+			OnError:   tt.onError,
+		})
+		// Nothing listens on port 1, so every Redis command fails.
+		cfg.Redis = config.Redis{Host: "127.0.0.1", Port: 1}
+		cfg.Storage.FixedWindow = config.StorageRedis
+		r := newRouter(t, cfg, "/ping")
+
+		for i, want := range tt.want {
+			if got := get(r, "/ping", nil); got != want {
+				t.Errorf("%s: request %d: expected %d, got %d", name, i+1, want, got)
+			}
+		}
+	}
+}
+
+func TestSet_Critical(t *testing.T) {
+	key := config.PolicyKey{Source: config.KeySourceHeader, Name: "X-API-Key"}
+	cfg := newConfig(
+		config.Policy{Name: "fw", Algorithm: config.AlgorithmFixedWindow, Key: key},
+		config.Policy{Name: "tb", Algorithm: config.AlgorithmTokenBucket, Key: key, OnError: config.OnErrorFailOpen},
+		config.Policy{Name: "gcra", Algorithm: config.AlgorithmGCRA, Key: key, OnError: config.OnErrorFallback},
+	)
+	cfg.Redis = config.Redis{Host: "localhost", Port: 6379, FixedWindowDb: 1, TokenBucketDb: 2, GCRADb: 3}
+	cfg.Storage.FixedWindow = config.StorageRedis
+	cfg.Storage.TokenBucket = config.StorageRedis
+	cfg.Storage.GCRA = config.StorageRedis
+	cfg.RateLimiter.TokenBucket = config.TokenBucket{MaxTokens: 1, RefillRate: 1}
+	cfg.RateLimiter.GCRA = config.GCRA{Rate: 1, Burst: 1}
+	repos := storage.NewFactory(cfg)
+	defer repos.Close()
+
+	set, err := policy.New(cfg, repos)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, want := range map[string]bool{"redis/db1": true, "redis/db2": false, "redis/db3": false} {
+		if got := set.Critical(name); got != want {
+			t.Errorf("expected Critical(%s) = %v, got %v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+)
+
+// tierTable holds the limits of every client listed in the config, its own
+// blocks merged over those of its tier.
+type tierTable struct {
+	clients map[string]config.Limits
+}
+
+func newTierTable(tiers []config.Tier, clients []config.Client) *tierTable {
+	byName := make(map[string]config.Limits, len(tiers))
+	for _, t := range tiers {
+		byName[t.Name] = t.Limits
+	}
+
+	table := &tierTable{clients: make(map[string]config.Limits, len(clients))}
+	for _, c := range clients {
+		table.clients[c.Key] = merge(c.Limits, byName[c.Tier])
+	}
+	return table
+}
+
+// merge returns base with every block override sets replaced.
+func merge(override, base config.Limits) config.Limits {
+	return config.Limits{
+		FixedWindow:          firstSet(override.FixedWindow, base.FixedWindow),
+		TokenBucket:          firstSet(override.TokenBucket, base.TokenBucket),
+		SlidingWindowLog:     firstSet(override.SlidingWindowLog, base.SlidingWindowLog),
+		SlidingWindowCounter: firstSet(override.SlidingWindowCounter, base.SlidingWindowCounter),
+		GCRA:                 firstSet(override.GCRA, base.GCRA),
+		LeakyBucket:          firstSet(override.LeakyBucket, base.LeakyBucket),
+		Concurrency:          firstSet(override.Concurrency, base.Concurrency),
+	}
+}
+
+func firstSet[T any](a, b *T) *T {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+// clientSource serves one policy's per-client limits: an admin override
+// first, then for tiered policies the tier table. Client IDs reach the
+// services prefixed with the policy name, which is stripped before the tier
+// lookup.
+type clientSource[T any] struct {
+	// overrides is nil for the fallback services.
+	overrides storage.OverrideRepository
+	// tiers is nil when the policy is not tiered.
+	tiers  *atomic.Pointer[tierTable]
+	prefix string
+	pick   func(config.Limits) *T
+}
+
+func (s clientSource[T]) Limits(ctx context.Context, clientID string) (T, bool, error) {
+	var zero T
+	if s.overrides != nil {
+		limits, expiresAt, err := s.overrides.GetOverride(ctx, clientID)
+		if err != nil {
+			return zero, false, err
+		}
+		if time.Now().Before(expiresAt) {
+			if l := s.pick(limits); l != nil {
+				return *l, true, nil
+			}
+		}
+	}
+
+	if s.tiers == nil {
+		return zero, false, nil
+	}
+	key, ok := strings.CutPrefix(clientID, s.prefix)
+	if !ok {
+		return zero, false, nil
+	}
+	limits, ok := s.tiers.Load().clients[key]
+	if !ok {
+		return zero, false, nil
+	}
+	if l := s.pick(limits); l != nil {
+		return *l, true, nil
+	}
+	return zero, false, nil
+}
+
+// limitSource returns the per-client limit source of a policy. Clients
+// without an override, and for tiered policies without a tier, get the
+// policy's limits.
+func limitSource[T any](p config.Policy, set *Set, overrides storage.OverrideRepository, pick func(config.Limits) *T) service.LimitSource[T] {
+	src := clientSource[T]{overrides: overrides, prefix: p.Name + ":", pick: pick}
+	if p.Tiered {
+		src.tiers = &set.tiers
+	}
+	return src
+}
@@ -0,0 +1,141 @@
+package rdb
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen is returned instead of running a command while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("redis circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen lets commands through until one of them tells whether
+	// Redis is back.
+	breakerHalfOpen
+)
+
+// CircuitBreaker is a go-redis hook that stops sending commands to a Redis
+// that keeps failing. After threshold consecutive failures it opens and
+// every command fails at once with ErrCircuitOpen for cooldown. Then commands
+// are let through again as probes: the first success closes the breaker, a
+// failure opens it for another cooldown. Probes are not limited to one
+// because go-redis sends its own commands (HELLO, SELECT) through the hook
+// when it opens a connection. Replies from Redis, missing keys included, and
+// cancelled commands are not failures.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openUntil time.Time
+}
+
+var _ redis.Hook = (*CircuitBreaker)(nil)
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *CircuitBreaker) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (b *CircuitBreaker) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !b.allow() {
+			cmd.SetErr(ErrCircuitOpen)
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmd)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *CircuitBreaker) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if !b.allow() {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrCircuitOpen)
+			}
+			return ErrCircuitOpen
+		}
+		err := next(ctx, cmds)
+		b.record(err)
+		return err
+	}
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = breakerHalfOpen
+	}
+	return true
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case cancelled(err), errors.Is(err, ErrCircuitOpen):
+		// Tells nothing about Redis.
+	case failed(err):
+		switch b.state {
+		case breakerClosed:
+			b.failures++
+			if b.failures >= b.threshold {
+				b.open()
+				log.Printf("redis circuit breaker opened after %d failures: %v", b.failures, err)
+			}
+		case breakerHalfOpen:
+			b.open()
+		}
+	default:
+		switch b.state {
+		case breakerClosed:
+			b.failures = 0
+		case breakerHalfOpen:
+			b.state = breakerClosed
+			b.failures = 0
+			log.Printf("redis circuit breaker closed, redis is reachable again")
+		}
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = breakerOpen
+	b.openUntil = time.Now().Add(b.cooldown)
+}
+
+func cancelled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// failed reports whether err means Redis could not be reached or did not
+// answer in time, as opposed to an answer such as a missing key or NOSCRIPT.
+func failed(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	var reply redis.Error
+	return !errors.As(err, &reply)
+}
@@ -0,0 +1,70 @@
+package rdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/redis/go-redis/v9"
+)
+
+func newBreakerClient(t *testing.T, threshold int, cooldown time.Duration) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	client.AddHook(rdb.NewCircuitBreaker(threshold, cooldown))
+	t.Cleanup(func() { client.Close() })
+	return client, server
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	client, server := newBreakerClient(t, 2, 50*time.Millisecond)
+
+	if err := client.Get(ctx, "missing").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("expected redis.Nil, got %v", err)
+	}
+
+	server.Close()
+	for i := 0; i < 2; i++ {
+		if err := client.Ping(ctx).Err(); err == nil || errors.Is(err, rdb.ErrCircuitOpen) {
+			t.Fatalf("expected a connection error, got %v", err)
+		}
+	}
+	if err := client.Ping(ctx).Err(); !errors.Is(err, rdb.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to be open, got %v", err)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.Ping(ctx).Err(); !errors.Is(err, rdb.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to stay open during the cooldown, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("expected the breaker to be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_RepliesAreNotFailures(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newBreakerClient(t, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := client.EvalSha(ctx, "0000000000000000000000000000000000000000", nil).Err(); err == nil {
+			t.Fatalf("expected NOSCRIPT")
+		}
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("expected the breaker to stay closed, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package rdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireLeaseScript drops expired leases and adds a new one when the client
+// is below its limit. Leases live in a sorted set scored by their expiry in
+// unix milliseconds, so a replica that dies mid-request only holds its slot
+// until the lease runs out.
+//
+// KEYS[1] = lease set key
+// ARGV[1] = current time in unix milliseconds
+// ARGV[2] = max in-flight requests
+// ARGV[3] = lease id
+// ARGV[4] = lease expiry in unix milliseconds
+// ARGV[5] = lease TTL in milliseconds
+var acquireLeaseScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// renewLeaseScript extends a lease that has not expired yet, and the set with
+// it. An expired lease is left for the next acquire to drop, since its slot
+// may have been handed out again.
+//
+// KEYS[1] = lease set key
+// ARGV[1] = current time in unix milliseconds
+// ARGV[2] = lease id
+// ARGV[3] = new lease expiry in unix milliseconds
+// ARGV[4] = lease TTL in milliseconds
+var renewLeaseScript = redis.NewScript(`
+local expiry = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if not expiry or tonumber(expiry) <= tonumber(ARGV[1]) then
+	return 0
+end
+
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[2])
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[4]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return 1
+`)
+
+type ConcurrencyRepository struct {
+	client redis.UniversalClient
+	keys   Keys
+}
+
+func NewConcurrencyRepository(client redis.UniversalClient, opts ...Option) *ConcurrencyRepository {
+	return &ConcurrencyRepository{
+		client: client,
+		keys:   newRepoConfig(opts).keys,
+	}
+}
+
+func (r *ConcurrencyRepository) Acquire(ctx context.Context, clientID string, leaseID string, now time.Time, limit int, ttl time.Duration) (bool, error) {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+
+	acquired, err := acquireLeaseScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		toMillis(now), limit, leaseID, toMillis(now.Add(ttl)), ms).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+func (r *ConcurrencyRepository) Renew(ctx context.Context, clientID string, leaseID string, now time.Time, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+
+	return renewLeaseScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		toMillis(now), leaseID, toMillis(now.Add(ttl)), ms).Err()
+}
+
+func (r *ConcurrencyRepository) Release(ctx context.Context, clientID string, leaseID string) error {
+	return r.client.ZRem(ctx, r.keys.key(clientID), leaseID).Err()
+}
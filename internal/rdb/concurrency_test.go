@@ -0,0 +1,161 @@
+package rdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestConcurrencyRepository_Acquire(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewConcurrencyRepository(db)
+	clientID := "client1"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		score(now), 2, "lease-1", score(now.Add(time.Minute)), int64(60000)).
+		SetVal(int64(1))
+
+	ok, err := repo.Acquire(ctx, clientID, "lease-1", now, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Error("expected lease to be acquired")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestConcurrencyRepository_Acquire_Full(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewConcurrencyRepository(db)
+	clientID := "client2"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		score(now), 2, "lease-3", score(now.Add(time.Minute)), int64(60000)).
+		SetVal(int64(0))
+
+	ok, err := repo.Acquire(ctx, clientID, "lease-3", now, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Error("expected lease to be refused")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestConcurrencyRepository_Acquire_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewConcurrencyRepository(db)
+	clientID := "client-redis-error"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		score(now), 2, "lease-1", score(now.Add(time.Minute)), int64(60000)).
+		SetErr(redisErrorExample{})
+
+	if _, err := repo.Acquire(ctx, clientID, "lease-1", now, 2, time.Minute); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestConcurrencyRepository_Release(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewConcurrencyRepository(db)
+	clientID := "client3"
+
+	mock.ExpectZRem("{"+clientID+"}", "lease-1").SetVal(1)
+
+	if err := repo.Release(ctx, clientID, "lease-1"); err != nil {
+		t.Fatalf("unexpected error releasing lease: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestConcurrencyRepository_Renew_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewConcurrencyRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	now := time.Now()
+
+	if ok, err := repo.Acquire(ctx, "client", "a", now, 1, time.Second); err != nil || !ok {
+		t.Fatalf("expected lease a to be acquired, got %v, %v", ok, err)
+	}
+	if err := repo.Renew(ctx, "client", "a", now.Add(900*time.Millisecond), time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, _ := repo.Acquire(ctx, "client", "b", now.Add(1500*time.Millisecond), 1, time.Second); ok {
+		t.Error("expected the renewed lease to keep its slot")
+	}
+
+	// An expired lease is not brought back.
+	if err := repo.Renew(ctx, "client", "a", now.Add(3*time.Second), time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, _ := repo.Acquire(ctx, "client", "b", now.Add(3*time.Second), 1, time.Second); !ok {
+		t.Error("expected the expired lease to free its slot")
+	}
+
+	// Renewing a released lease does not add it again.
+	repo.Release(ctx, "client", "b")
+	repo.Renew(ctx, "client", "b", now.Add(3*time.Second), time.Second)
+	if server.Exists("{client}") {
+		if members, _ := server.ZMembers("{client}"); len(members) != 0 {
+			t.Errorf("expected no leases after release, got %v", members)
+		}
+	}
+}
+
+func TestConcurrencyRepository_Acquire_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewConcurrencyRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	now := time.Now()
+
+	for _, lease := range []string{"a", "b"} {
+		if ok, err := repo.Acquire(ctx, "client", lease, now, 2, time.Minute); err != nil || !ok {
+			t.Fatalf("expected lease %s to be acquired, got %v, %v", lease, ok, err)
+		}
+	}
+	if ok, _ := repo.Acquire(ctx, "client", "c", now, 2, time.Minute); ok {
+		t.Fatal("expected a third lease to be refused")
+	}
+
+	if err := repo.Release(ctx, "client", "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok, _ := repo.Acquire(ctx, "client", "c", now, 2, time.Minute); !ok {
+		t.Fatal("expected the released slot to be handed out again")
+	}
+	if members, _ := server.ZMembers("{client}"); len(members) != 2 {
+		t.Errorf("expected leases b and c, got %v", members)
+	}
+
+	// Leases that ran out free their slots for the next acquire.
+	if ok, _ := repo.Acquire(ctx, "client", "d", now.Add(2*time.Minute), 2, time.Minute); !ok {
+		t.Fatal("expected the expired leases to free their slots")
+	}
+	if members, _ := server.ZMembers("{client}"); len(members) != 1 || members[0] != "d" {
+		t.Errorf("expected the expired leases to be dropped, got %v", members)
+	}
+}
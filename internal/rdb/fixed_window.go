@@ -2,49 +2,157 @@ package rdb
 
 import (
 	"context"
-	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/redis/go-redis/v9"
 )
 
+// takeWindowScript checks and increments a window in one step so concurrent
+// callers on different instances cannot both read the same count. The window
+// is kept in a hash with the fields count and end, the end in unix
+// nanoseconds. The window end is tracked by the key TTL, so an expired window
+// simply disappears. A JSON window stored by an earlier version is converted
+// to a hash first, keeping its TTL.
+//
+// KEYS[1] = window key
+// ARGV[1] = max requests
+// ARGV[2] = window length in milliseconds
+// ARGV[3] = end time in unix nanoseconds for a newly opened window
+// ARGV[4] = request cost
+var takeWindowScript = redis.NewScript(parseTimeLua + `
+local max = tonumber(ARGV[1])
+local n = tonumber(ARGV[4])
+
+if redis.call('TYPE', KEYS[1]).ok == 'string' then
+	local window = cjson.decode(redis.call('GET', KEYS[1]))
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl <= 0 then
+		ttl = ARGV[2]
+	end
+	redis.call('DEL', KEYS[1])
+	redis.call('HSET', KEYS[1], 'count', window.Count, 'end', string.format('%.0f', parse_time(window.EndTime) * 1e6))
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+
+local state = redis.call('HMGET', KEYS[1], 'count', 'end')
+local count = tonumber(state[1])
+if not count then
+	if n > max then
+		return {0, 0, ARGV[3]}
+	end
+	redis.call('HSET', KEYS[1], 'count', n, 'end', ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {1, n, ARGV[3]}
+end
+
+if count + n > max then
+	return {0, count, state[2]}
+end
+return {1, redis.call('HINCRBY', KEYS[1], 'count', n), state[2]}
+`)
+
 type FixedWindowRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
+	keys   Keys
 }
 
-func NewFixedWindowRepository(client *redis.Client) *FixedWindowRepository {
+func NewFixedWindowRepository(client redis.UniversalClient, opts ...Option) *FixedWindowRepository {
 	return &FixedWindowRepository{
 		client: client,
+		keys:   newRepoConfig(opts).keys,
 	}
 }
 
 func (r *FixedWindowRepository) GetWindow(ctx context.Context, clientID string) (ratelimit.Window, error) {
-	val, err := r.client.Get(ctx, clientID).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return ratelimit.Window{}, nil
+	vals, err := r.client.HMGet(ctx, r.keys.key(clientID), "count", "end").Result()
+	if isLegacy(err) {
+		var w ratelimit.Window
+		if err := getLegacyJSON(ctx, r.client, r.keys.key(clientID), &w); err != nil && err != redis.Nil {
+			return ratelimit.Window{}, err
 		}
-		return ratelimit.Window{}, err
+		return w, nil
 	}
-
-	var w ratelimit.Window
-	if err := json.Unmarshal([]byte(val), &w); err != nil {
+	if err != nil {
 		return ratelimit.Window{}, err
 	}
-	return w, nil
+	if vals[0] == nil {
+		return ratelimit.Window{}, nil
+	}
+
+	count, _ := vals[0].(string)
+	end, _ := vals[1].(string)
+	return parseWindow(count, end)
 }
 
 func (r *FixedWindowRepository) SaveWindow(ctx context.Context, clientID string, window ratelimit.Window) error {
-	data, err := json.Marshal(window)
-	if err != nil {
-		return err
-	}
-
 	ttl := time.Until(window.EndTime)
 	if ttl <= 0 {
 		ttl = time.Millisecond
 	}
 
-	return r.client.Set(ctx, clientID, data, ttl).Err()
+	// DEL first replaces a JSON window of an earlier version, which HSET
+	// would refuse.
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, r.keys.key(clientID))
+	pipe.HSet(ctx, r.keys.key(clientID), "count", window.Count, "end", formatNanos(window.EndTime))
+	pipe.PExpire(ctx, r.keys.key(clientID), ttl)
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *FixedWindowRepository) DeleteWindow(ctx context.Context, clientID string) error {
+	return r.client.Del(ctx, r.keys.key(clientID)).Err()
+}
+
+// ListWindows returns the IDs of the clients starting with prefix that have a
+// window, sorted.
+func (r *FixedWindowRepository) ListWindows(ctx context.Context, prefix string) ([]string, error) {
+	return scanClientIDs(ctx, r.client, r.keys, prefix)
+}
+
+// TakeWindow counts a request costing n against the client's current window
+// inside Redis and reports whether it fits. The script is sent with EVALSHA and
+// reloaded with EVAL when Redis answers NOSCRIPT.
+func (r *FixedWindowRepository) TakeWindow(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.Window, bool, error) {
+	ttl := timeFrame.Milliseconds()
+	if ttl <= 0 {
+		ttl = 1
+	}
+
+	res, err := takeWindowScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		maxRequests, ttl, formatNanos(now.Add(timeFrame)), n).Slice()
+	if err != nil {
+		return ratelimit.Window{}, false, err
+	}
+	if len(res) != 3 {
+		return ratelimit.Window{}, false, errUnexpectedResult(res)
+	}
+
+	allowed, ok1 := res[0].(int64)
+	count, ok2 := res[1].(int64)
+	end, ok3 := res[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return ratelimit.Window{}, false, errUnexpectedResult(res)
+	}
+
+	endTime, err := parseNanos(end)
+	if err != nil {
+		return ratelimit.Window{}, false, err
+	}
+	return ratelimit.Window{Count: int(count), EndTime: endTime}, allowed == 1, nil
+}
+
+func parseWindow(count, end string) (ratelimit.Window, error) {
+	c, err := strconv.Atoi(count)
+	if err != nil {
+		return ratelimit.Window{}, err
+	}
+	endTime, err := parseNanos(end)
+	if err != nil {
+		return ratelimit.Window{}, err
+	}
+	return ratelimit.Window{Count: c, EndTime: endTime}, nil
 }
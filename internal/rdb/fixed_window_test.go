@@ -3,12 +3,16 @@ package rdb_test
 import (
 	"context"
 	"encoding/json"
+	"slices"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
 	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
 )
 
 type redisErrorExample struct{}
@@ -17,6 +21,40 @@ func (e redisErrorExample) Error() string {
 	return "some redis error"
 }
 
+// redisNoScriptError mimics the reply Redis sends when EVALSHA misses its
+// script cache.
+type redisNoScriptError struct{}
+
+func (e redisNoScriptError) Error() string {
+	return "NOSCRIPT No matching script. Please use EVAL."
+}
+
+func (e redisNoScriptError) RedisError() {}
+
+// redisWrongTypeError mimics the reply to a hash command on a key holding a
+// JSON string stored by an earlier version.
+type redisWrongTypeError struct{}
+
+func (e redisWrongTypeError) Error() string {
+	return "WRONGTYPE Operation against a key holding the wrong kind of value"
+}
+
+func (e redisWrongTypeError) RedisError() {}
+
+// expectSaveWindow expects the commands SaveWindow sends for window.
+func expectSaveWindow(mock redismock.ClientMock, key string, window ratelimit.Window, ttl time.Duration) {
+	mock.ExpectTxPipeline()
+	mock.ExpectDel(key).SetVal(0)
+	mock.ExpectHSet(key, "count", window.Count, "end", strconv.FormatInt(window.EndTime.UnixNano(), 10)).SetVal(2)
+	mock.ExpectPExpire(key, ttl).SetVal(true)
+	mock.ExpectTxPipelineExec()
+}
+
+// hashWindow is the reply to HMGET count end for window.
+func hashWindow(window ratelimit.Window) []interface{} {
+	return []interface{}{strconv.Itoa(window.Count), strconv.FormatInt(window.EndTime.UnixNano(), 10)}
+}
+
 func setupRepoWithWindow(ctx context.Context, clientID string, windowCount int, windowDuration time.Duration) (*rdb.FixedWindowRepository, redismock.ClientMock) {
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewFixedWindowRepository(db)
@@ -25,12 +63,11 @@ func setupRepoWithWindow(ctx context.Context, clientID string, windowCount int,
 		Count:   windowCount,
 		EndTime: time.Now().Add(windowDuration),
 	}
-	data, _ := json.Marshal(window)
 	ttl := time.Until(window.EndTime)
 	if ttl <= 0 {
 		ttl = time.Millisecond
 	}
-	mock.ExpectSet(clientID, data, ttl).SetVal("OK")
+	expectSaveWindow(mock, "{"+clientID+"}", window, ttl)
 	_ = repo.SaveWindow(ctx, clientID, window)
 
 	return repo, mock
@@ -42,7 +79,7 @@ func TestFixedWindowRepository_Get_NonExistingClient(t *testing.T) {
 	repo := rdb.NewFixedWindowRepository(db)
 	clientID := "nonexistent"
 
-	mock.ExpectGet(clientID).RedisNil()
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetVal([]interface{}{nil, nil})
 
 	got, err := repo.GetWindow(ctx, clientID)
 	if err != nil {
@@ -61,11 +98,10 @@ func TestFixedWindowRepository_Get_ExistingClient(t *testing.T) {
 	clientID := "client1"
 	repo, mock := setupRepoWithWindow(ctx, clientID, 3, time.Minute)
 
-	data, _ := json.Marshal(ratelimit.Window{
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetVal(hashWindow(ratelimit.Window{
 		Count:   3,
 		EndTime: time.Now().Add(time.Minute),
-	})
-	mock.ExpectGet(clientID).SetVal(string(data))
+	}))
 
 	got, err := repo.GetWindow(ctx, clientID)
 	if err != nil {
@@ -89,7 +125,7 @@ func TestFixedWindowRepository_Get_RedisError(t *testing.T) {
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewFixedWindowRepository(db)
 
-	mock.ExpectGet(clientID).SetErr(redisErrorExample{})
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetErr(redisErrorExample{})
 
 	_, err := repo.GetWindow(ctx, clientID)
 	if err == nil {
@@ -101,19 +137,43 @@ func TestFixedWindowRepository_Get_RedisError(t *testing.T) {
 	}
 }
 
-func TestFixedWindowRepository_Get_UnmarshalError(t *testing.T) {
+func TestFixedWindowRepository_Get_ParseError(t *testing.T) {
 	ctx := context.Background()
-	clientID := "client-unmarshal"
+	clientID := "client-parse"
 
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewFixedWindowRepository(db)
 
-	// kasih string yang bukan JSON valid
-	mock.ExpectGet(clientID).SetVal("not-a-json")
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetVal([]interface{}{"1", "not-a-number"})
 
 	_, err := repo.GetWindow(ctx, clientID)
 	if err == nil {
-		t.Errorf("expected JSON unmarshal error, got nil")
+		t.Errorf("expected parse error, got nil")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_Get_LegacyJSON(t *testing.T) {
+	ctx := context.Background()
+	clientID := "client-legacy"
+
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+
+	endTime := time.Now().Add(time.Minute)
+	data, _ := json.Marshal(ratelimit.Window{Count: 2, EndTime: endTime})
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetErr(redisWrongTypeError{})
+	mock.ExpectGet("{" + clientID + "}").SetVal(string(data))
+
+	got, err := repo.GetWindow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Count != 2 || !got.EndTime.Equal(endTime) {
+		t.Errorf("expected the JSON window, got %+v", got)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -131,18 +191,17 @@ func TestFixedWindowRepository_Save_NewClient(t *testing.T) {
 		EndTime: time.Now().Add(time.Minute),
 	}
 
-	data, _ := json.Marshal(window)
 	ttl := time.Until(window.EndTime)
 	if ttl <= 0 {
 		ttl = time.Millisecond
 	}
-	mock.ExpectSet(clientID, data, ttl).SetVal("OK")
+	expectSaveWindow(mock, "{"+clientID+"}", window, ttl)
 
 	if err := repo.SaveWindow(ctx, clientID, window); err != nil {
 		t.Fatalf("unexpected error saving window: %v", err)
 	}
 
-	mock.ExpectGet(clientID).SetVal(string(data))
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetVal(hashWindow(window))
 	got, err := repo.GetWindow(ctx, clientID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -165,18 +224,17 @@ func TestFixedWindowRepository_Save_ExistingClient(t *testing.T) {
 		Count:   5,
 		EndTime: time.Now().Add(2 * time.Minute),
 	}
-	data2, _ := json.Marshal(window2)
 	ttl2 := time.Until(window2.EndTime)
 	if ttl2 <= 0 {
 		ttl2 = time.Millisecond
 	}
-	mock.ExpectSet(clientID, data2, ttl2).SetVal("OK")
+	expectSaveWindow(mock, "{"+clientID+"}", window2, ttl2)
 
 	if err := repo.SaveWindow(ctx, clientID, window2); err != nil {
 		t.Fatalf("unexpected error saving window: %v", err)
 	}
 
-	mock.ExpectGet(clientID).SetVal(string(data2))
+	mock.ExpectHMGet("{"+clientID+"}", "count", "end").SetVal(hashWindow(window2))
 	got, err := repo.GetWindow(ctx, clientID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -203,8 +261,7 @@ func TestSaveWindow_TTLEmpty(t *testing.T) {
 		EndTime: time.Now().Add(-time.Minute),
 	}
 
-	data, _ := json.Marshal(window)
-	mock.ExpectSet("client1", data, time.Millisecond).SetVal("OK")
+	expectSaveWindow(mock, "{client1}", window, time.Millisecond)
 
 	err := repo.SaveWindow(ctx, "client1", window)
 	if err != nil {
@@ -215,3 +272,188 @@ func TestSaveWindow_TTLEmpty(t *testing.T) {
 		t.Errorf("unmet expectations: %v", err)
 	}
 }
+
+func TestFixedWindowRepository_TakeWindow_NewWindow(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+	clientID := "client-take"
+	now := time.Now().UTC()
+
+	endTime := strconv.FormatInt(now.Add(time.Minute).UnixNano(), 10)
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, 5, int64(60000), endTime, 1).
+		SetVal([]interface{}{int64(1), int64(1), endTime})
+
+	got, allowed, err := repo.TakeWindow(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if got.Count != 1 {
+		t.Errorf("expected Count=1, got %d", got.Count)
+	}
+	if !got.EndTime.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected EndTime=%v, got %v", now.Add(time.Minute), got.EndTime)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_Rejected(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+	clientID := "client-full"
+	now := time.Now().UTC()
+
+	endTime := strconv.FormatInt(now.Add(time.Minute).UnixNano(), 10)
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, 5, int64(60000), endTime, 1).
+		SetVal([]interface{}{int64(0), int64(5), endTime})
+
+	got, allowed, err := repo.TakeWindow(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be rejected")
+	}
+	if got.Count != 5 {
+		t.Errorf("expected Count=5, got %d", got.Count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_NoScriptFallback(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+	clientID := "client-noscript"
+	now := time.Now().UTC()
+
+	endTime := strconv.FormatInt(now.Add(time.Minute).UnixNano(), 10)
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, 5, int64(60000), endTime, 1).
+		SetErr(redisNoScriptError{})
+	mock.Regexp().ExpectEval("HMGET", []string{"{" + clientID + "}"}, 5, int64(60000), endTime, 1).
+		SetVal([]interface{}{int64(1), int64(1), endTime})
+
+	_, allowed, err := repo.TakeWindow(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+	clientID := "client-redis-error"
+	now := time.Now().UTC()
+
+	endTime := strconv.FormatInt(now.Add(time.Minute).UnixNano(), 10)
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, 5, int64(60000), endTime, 1).
+		SetErr(redisErrorExample{})
+
+	_, allowed, err := repo.TakeWindow(ctx, clientID, now, 5, time.Minute, 1)
+	if err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if allowed {
+		t.Error("expected request to be rejected on error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_DeleteWindow(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+
+	mock.ExpectDel("{fw:client1}").SetVal(1)
+
+	if err := repo.DeleteWindow(ctx, "fw:client1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_ListWindows(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewFixedWindowRepository(db)
+
+	mock.ExpectScan(0, `{fw\*:*}`, 100).SetVal([]string{"{fw*:b}", "{fw*:a}", "{fw*:b}"}, 0)
+
+	got, err := repo.ListWindows(ctx, "fw*:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"fw*:a", "fw*:b"}) {
+		t.Errorf("expected sorted, deduplicated client IDs, got %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewFixedWindowRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	now := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		got, allowed, err := repo.TakeWindow(ctx, "client", now, 2, time.Minute, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if allowed != (i <= 2) || got.Count != min(i, 2) || !got.EndTime.Equal(now.Add(time.Minute)) {
+			t.Errorf("take %d: got allowed=%v, %+v", i, allowed, got)
+		}
+	}
+	if got := server.HGet("{client}", "count"); got != "2" {
+		t.Errorf("expected the count in a hash field, got %q", got)
+	}
+}
+
+func TestFixedWindowRepository_TakeWindow_LegacyJSON(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewFixedWindowRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	endTime := time.Now().Add(30 * time.Second)
+	data, _ := json.Marshal(ratelimit.Window{Count: 2, EndTime: endTime})
+	server.Set("{client}", string(data))
+	server.SetTTL("{client}", 30*time.Second)
+
+	got, allowed, err := repo.TakeWindow(ctx, "client", time.Now(), 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed || got.Count != 3 {
+		t.Errorf("expected the request counted on the JSON window, got allowed=%v, %+v", allowed, got)
+	}
+	if d := got.EndTime.Sub(endTime).Abs(); d > time.Microsecond {
+		t.Errorf("expected EndTime=%v, got %v", endTime, got.EndTime)
+	}
+	if typ := server.Type("{client}"); typ != "hash" {
+		t.Errorf("expected the window converted to a hash, got %s", typ)
+	}
+	if ttl := server.TTL("{client}"); ttl != 30*time.Second {
+		t.Errorf("expected the JSON window's TTL kept, got %v", ttl)
+	}
+}
@@ -0,0 +1,108 @@
+package rdb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeTATScript tests and advances the theoretical arrival time in one step.
+// The TAT is stored as unix milliseconds with a microsecond fraction and the
+// key expires once it falls behind the clock, since a missing key and a TAT in
+// the past mean the same thing.
+//
+// KEYS[1] = TAT key
+// ARGV[1] = current time in unix milliseconds
+// ARGV[2] = emission interval in milliseconds
+// ARGV[3] = burst
+// ARGV[4] = request cost in emission intervals
+var takeTATScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local tolerance = interval * tonumber(ARGV[3])
+
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval * tonumber(ARGV[4])
+if new_tat - tolerance > now then
+	return {0, string.format('%.3f', tat)}
+end
+
+redis.call('SET', KEYS[1], string.format('%.3f', new_tat), 'PX', math.ceil(new_tat - now))
+return {1, string.format('%.3f', new_tat)}
+`)
+
+type GCRARepository struct {
+	client redis.UniversalClient
+	keys   Keys
+}
+
+func NewGCRARepository(client redis.UniversalClient, opts ...Option) *GCRARepository {
+	return &GCRARepository{
+		client: client,
+		keys:   newRepoConfig(opts).keys,
+	}
+}
+
+func (r *GCRARepository) GetTAT(ctx context.Context, clientID string) (ratelimit.GCRA, error) {
+	val, err := r.client.Get(ctx, r.keys.key(clientID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ratelimit.GCRA{}, nil
+		}
+		return ratelimit.GCRA{}, err
+	}
+
+	tat, err := parseMillis(val)
+	if err != nil {
+		return ratelimit.GCRA{}, err
+	}
+	return ratelimit.GCRA{TAT: tat}, nil
+}
+
+func (r *GCRARepository) SaveTAT(ctx context.Context, clientID string, state ratelimit.GCRA) error {
+	ttl := time.Until(state.TAT)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+	return r.client.Set(ctx, r.keys.key(clientID), formatMillis(state.TAT), ttl).Err()
+}
+
+// TakeTAT runs one GCRA check for a request costing n inside Redis.
+func (r *GCRARepository) TakeTAT(ctx context.Context, clientID string, now time.Time, emissionInterval time.Duration, burst int, n int) (ratelimit.GCRA, bool, error) {
+	res, err := takeTATScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		formatMillis(now), float64(emissionInterval.Microseconds())/1000, burst, n).Slice()
+	if err != nil {
+		return ratelimit.GCRA{}, false, err
+	}
+
+	allowed, val, err := parseScriptResult(res)
+	if err != nil {
+		return ratelimit.GCRA{}, false, err
+	}
+
+	tat, err := parseMillis(val)
+	if err != nil {
+		return ratelimit.GCRA{}, false, err
+	}
+	return ratelimit.GCRA{TAT: tat}, allowed, nil
+}
+
+// formatMillis renders t as unix milliseconds with a microsecond fraction.
+func formatMillis(t time.Time) string {
+	return strconv.FormatFloat(toMillis(t), 'f', 3, 64)
+}
+
+func parseMillis(s string) (time.Time, error) {
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromMillis(ms), nil
+}
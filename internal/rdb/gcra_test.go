@@ -0,0 +1,180 @@
+package rdb_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func millis(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMicro())/1000, 'f', 3, 64)
+}
+
+func TestGCRARepository_GetTAT_NonExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "nonexistent"
+
+	mock.ExpectGet("{" + clientID + "}").RedisNil()
+
+	got, err := repo.GetTAT(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.TAT.IsZero() {
+		t.Errorf("expected zero TAT for non-existing client, got %v", got.TAT)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_GetTAT_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "client1"
+	tat := time.Now().Add(time.Second).Truncate(time.Microsecond)
+
+	mock.ExpectGet("{" + clientID + "}").SetVal(millis(tat))
+
+	got, err := repo.GetTAT(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.TAT.Equal(tat) {
+		t.Errorf("expected TAT=%v, got %v", tat, got.TAT)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_GetTAT_ParseError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "client-parse"
+
+	mock.ExpectGet("{" + clientID + "}").SetVal("not-a-number")
+
+	if _, err := repo.GetTAT(ctx, clientID); err == nil {
+		t.Errorf("expected parse error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_SaveTAT_PastTAT(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "client2"
+	tat := time.Now().Add(-time.Second)
+
+	mock.ExpectSet("{"+clientID+"}", millis(tat), time.Millisecond).SetVal("OK")
+
+	if err := repo.SaveTAT(ctx, clientID, ratelimit.GCRA{TAT: tat}); err != nil {
+		t.Fatalf("unexpected error saving TAT: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_TakeTAT(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "client-take"
+	now := time.Now().Truncate(time.Microsecond)
+	newTAT := now.Add(100 * time.Millisecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, millis(now), 100.0, 3, 1).
+		SetVal([]interface{}{int64(1), millis(newTAT)})
+
+	got, allowed, err := repo.TakeTAT(ctx, clientID, now, 100*time.Millisecond, 3, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if !got.TAT.Equal(newTAT) {
+		t.Errorf("expected TAT=%v, got %v", newTAT, got.TAT)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_TakeTAT_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewGCRARepository(db)
+	clientID := "client-redis-error"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, millis(now), 100.0, 3, 1).
+		SetErr(redisErrorExample{})
+
+	if _, _, err := repo.TakeTAT(ctx, clientID, now, 100*time.Millisecond, 3, 1); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGCRARepository_TakeTAT_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewGCRARepository(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	now := time.Now().Truncate(time.Millisecond)
+	interval := 100 * time.Millisecond
+
+	take := func(now time.Time) (ratelimit.GCRA, bool) {
+		t.Helper()
+		got, allowed, err := repo.TakeTAT(ctx, "client", now, interval, 3, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return got, allowed
+	}
+
+	// A burst of 3 goes through at once, each request pushing the TAT one
+	// interval further.
+	for i := 1; i <= 3; i++ {
+		if got, allowed := take(now); !allowed || !got.TAT.Equal(now.Add(time.Duration(i)*interval)) {
+			t.Fatalf("take %d: expected to be allowed with TAT +%v, got allowed=%v %v", i, time.Duration(i)*interval, allowed, got.TAT.Sub(now))
+		}
+	}
+	if got, allowed := take(now); allowed || !got.TAT.Equal(now.Add(3*interval)) {
+		t.Fatalf("expected the fourth request to be rejected leaving the TAT, got allowed=%v %v", allowed, got.TAT.Sub(now))
+	}
+
+	// One interval later there is room for exactly one more.
+	if _, allowed := take(now.Add(interval)); !allowed {
+		t.Fatal("expected a request one interval later to be allowed")
+	}
+	if _, allowed := take(now.Add(interval)); allowed {
+		t.Fatal("expected the next request to be rejected")
+	}
+
+	// Once the TAT has fallen behind, the whole burst is back.
+	later := now.Add(time.Second)
+	for i := 1; i <= 3; i++ {
+		if _, allowed := take(later); !allowed {
+			t.Fatalf("take %d: expected the burst to have refilled", i)
+		}
+	}
+}
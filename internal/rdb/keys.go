@@ -0,0 +1,189 @@
+package rdb
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanBatch is how many keys SCAN is asked for per call.
+const scanBatch = 100
+
+// Placeholders of a key schema.
+const (
+	KeyPrefix    = "{prefix}"
+	KeyAlgorithm = "{algorithm}"
+	KeyPolicy    = "{policy}"
+	KeyClientID  = "{clientID}"
+)
+
+// DefaultKeySchema namespaces the keys by service, algorithm and policy, so
+// that several algorithms and services can share one database.
+const DefaultKeySchema = KeyPrefix + ":" + KeyAlgorithm + ":" + KeyPolicy + ":" + KeyClientID
+
+// Keys lays out the Redis keys of one repository. The zero Keys uses the
+// client ID alone, in braces.
+type Keys struct {
+	policy string
+	// before and after are the rendered parts of the schema around the
+	// client ID.
+	before, after string
+}
+
+// NewKeys renders schema for the repository of algorithm that serves policy.
+// The schema must contain KeyClientID once; an empty one means
+// DefaultKeySchema. Since client IDs already start with the policy name and a
+// colon, that part is dropped when the schema has a place of its own for the
+// policy.
+func NewKeys(schema, prefix, algorithm, policy string) Keys {
+	if schema == "" {
+		schema = DefaultKeySchema
+	}
+	r := strings.NewReplacer(KeyPrefix, prefix, KeyAlgorithm, algorithm, KeyPolicy, policy)
+	before, after, _ := strings.Cut(schema, KeyClientID)
+	k := Keys{before: r.Replace(before), after: r.Replace(after)}
+	if strings.Contains(schema, KeyPolicy) {
+		k.policy = policy
+	}
+	return k
+}
+
+// Option configures a Redis repository.
+type Option func(*repoConfig)
+
+type repoConfig struct {
+	keys Keys
+}
+
+// WithKeys makes the repository lay out its keys as keys says, instead of
+// using the client ID alone.
+func WithKeys(keys Keys) Option {
+	return func(c *repoConfig) {
+		c.keys = keys
+	}
+}
+
+func newRepoConfig(opts []Option) repoConfig {
+	var cfg repoConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// key returns the key of clientID. Redis Cluster only hashes the part between
+// the first braces, so the client ID is wrapped in them: every key of a client
+// lands on the same slot and a script may touch several of them.
+func (k Keys) key(clientID string) string {
+	return k.before + "{" + k.trimPolicy(clientID) + "}" + k.after
+}
+
+// clientID is the inverse of key. It reports false for a key that does not
+// follow the schema.
+func (k Keys) clientID(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, k.before+"{")
+	if !ok {
+		return "", false
+	}
+	id, ok := strings.CutSuffix(rest, "}"+k.after)
+	if !ok {
+		return "", false
+	}
+	if k.policy != "" {
+		id = k.policy + ":" + id
+	}
+	return id, true
+}
+
+func (k Keys) trimPolicy(clientID string) string {
+	if k.policy == "" {
+		return clientID
+	}
+	if id, ok := strings.CutPrefix(clientID, k.policy+":"); ok {
+		return id
+	}
+	return clientID
+}
+
+// scanClientIDs returns the IDs of the clients starting with prefix that have
+// a key, sorted. Keys that do not follow the schema, such as those written
+// under an earlier one, are not listed.
+func scanClientIDs(ctx context.Context, client redis.UniversalClient, keys Keys, prefix string) ([]string, error) {
+	if keys.policy != "" {
+		// Every client of the repository starts with the policy, so a prefix
+		// ending within it matches them all and any other matches none.
+		full := keys.policy + ":"
+		switch {
+		case strings.HasPrefix(prefix, full):
+			prefix = prefix[len(full):]
+		case strings.HasPrefix(full, prefix):
+			prefix = ""
+		default:
+			return []string{}, nil
+		}
+	}
+
+	match := escapeGlob(keys.before+"{"+prefix) + "*" + escapeGlob("}"+keys.after)
+	found, err := scanKeys(ctx, client, match)
+	if err != nil {
+		return nil, err
+	}
+
+	clientIDs := make([]string, 0, len(found))
+	for _, key := range found {
+		if clientID, ok := keys.clientID(key); ok {
+			clientIDs = append(clientIDs, clientID)
+		}
+	}
+	slices.Sort(clientIDs)
+	return clientIDs, nil
+}
+
+// scanKeys returns every key in the client's database matching the SCAN
+// pattern match, sorted. SCAN walks the keyspace in batches so a large database does not
+// block Redis the way KEYS would. A cluster is scanned on every master, since
+// each only holds its own slots.
+func scanKeys(ctx context.Context, client redis.UniversalClient, match string) ([]string, error) {
+	var keys []string
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			found, err := scan(ctx, node, match)
+			mu.Lock()
+			keys = append(keys, found...)
+			mu.Unlock()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if keys, err = scan(ctx, client, match); err != nil {
+			return nil, err
+		}
+	}
+
+	// SCAN may return a key more than once.
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+func scan(ctx context.Context, client redis.Cmdable, match string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, match, scanBatch).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// escapeGlob makes s match itself literally in a SCAN MATCH pattern.
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
@@ -0,0 +1,77 @@
+package rdb_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+)
+
+func TestKeys_DefaultSchema(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	keys := rdb.NewKeys(rdb.DefaultKeySchema, "ratelimit", "fixed-window", "api")
+	repo := rdb.NewFixedWindowRepository(db, rdb.WithKeys(keys))
+
+	mock.ExpectDel("ratelimit:fixed-window:api:{alice}").SetVal(1)
+	mock.ExpectScan(0, "ratelimit:fixed-window:api:{*}", 100).
+		SetVal([]string{"ratelimit:fixed-window:api:{bob}", "ratelimit:fixed-window:api:{alice}", "{api:carol}"}, 0)
+
+	if err := repo.DeleteWindow(ctx, "api:alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.ListWindows(ctx, "api:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"api:alice", "api:bob"}) {
+		t.Errorf("expected [api:alice api:bob] without the legacy key, got %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestKeys_ListOtherPolicy(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	keys := rdb.NewKeys(rdb.DefaultKeySchema, "ratelimit", "token-bucket", "api")
+	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0, rdb.WithKeys(keys))
+
+	got, err := repo.ListBuckets(ctx, "web:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no clients of another policy, got %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestKeys_CustomSchema(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	keys := rdb.NewKeys("{clientID}:{algorithm}", "ignored", "fixed-window", "api")
+	repo := rdb.NewFixedWindowRepository(db, rdb.WithKeys(keys))
+
+	mock.ExpectDel("{api:alice}:fixed-window").SetVal(1)
+	mock.ExpectScan(0, "{api:a*}:fixed-window", 100).SetVal([]string{"{api:alice}:fixed-window"}, 0)
+
+	if err := repo.DeleteWindow(ctx, "api:alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.ListWindows(ctx, "api:a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, []string{"api:alice"}) {
+		t.Errorf("expected [api:alice], got %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
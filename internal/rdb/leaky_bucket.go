@@ -0,0 +1,99 @@
+package rdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// reserveSlotScript hands out the next n free slots, starting one interval
+// after the last one, and records the final one unless the queue is full or
+// the wait too long. The last slot is stored as unix milliseconds with a
+// microsecond fraction and expires once it has leaked out. The first slot is
+// returned.
+//
+// KEYS[1] = bucket key
+// ARGV[1] = current time in unix milliseconds
+// ARGV[2] = leak interval in milliseconds
+// ARGV[3] = capacity
+// ARGV[4] = max wait in milliseconds
+// ARGV[5] = number of slots to take
+var reserveSlotScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local slot = now
+local last = tonumber(redis.call('GET', KEYS[1]))
+if last and last + interval > now then
+	slot = last + interval
+end
+
+local last_slot = slot + interval * (tonumber(ARGV[5]) - 1)
+local wait = last_slot - now
+if wait > tonumber(ARGV[4]) or math.ceil(wait / interval) > tonumber(ARGV[3]) then
+	return {0, string.format('%.3f', slot)}
+end
+
+redis.call('SET', KEYS[1], string.format('%.3f', last_slot), 'PX', math.ceil(wait + interval))
+return {1, string.format('%.3f', slot)}
+`)
+
+type LeakyBucketRepository struct {
+	client   redis.UniversalClient
+	keys     Keys
+	interval time.Duration
+}
+
+func NewLeakyBucketRepository(client redis.UniversalClient, leakRate float64, opts ...Option) *LeakyBucketRepository {
+	return &LeakyBucketRepository{
+		client:   client,
+		keys:     newRepoConfig(opts).keys,
+		interval: time.Duration(float64(time.Second) / leakRate),
+	}
+}
+
+func (r *LeakyBucketRepository) GetLeakyBucket(ctx context.Context, clientID string) (ratelimit.LeakyBucket, error) {
+	val, err := r.client.Get(ctx, r.keys.key(clientID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return ratelimit.LeakyBucket{}, nil
+		}
+		return ratelimit.LeakyBucket{}, err
+	}
+
+	slot, err := parseMillis(val)
+	if err != nil {
+		return ratelimit.LeakyBucket{}, err
+	}
+	return ratelimit.LeakyBucket{LastSlot: slot}, nil
+}
+
+func (r *LeakyBucketRepository) SaveLeakyBucket(ctx context.Context, clientID string, bucket ratelimit.LeakyBucket) error {
+	ttl := time.Until(bucket.LastSlot.Add(r.interval))
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+	return r.client.Set(ctx, r.keys.key(clientID), formatMillis(bucket.LastSlot), ttl).Err()
+}
+
+// ReserveSlot books the client's next n leak slots inside Redis.
+func (r *LeakyBucketRepository) ReserveSlot(ctx context.Context, clientID string, now time.Time, interval time.Duration, capacity int, maxWait time.Duration, n int) (time.Time, bool, error) {
+	res, err := reserveSlotScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		formatMillis(now), float64(interval.Microseconds())/1000, capacity, maxWait.Milliseconds(), n).Slice()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	allowed, val, err := parseScriptResult(res)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	slot, err := parseMillis(val)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return slot, allowed, nil
+}
@@ -0,0 +1,159 @@
+package rdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLeakyBucketRepository_GetLeakyBucket_NonExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewLeakyBucketRepository(db, 10)
+	clientID := "nonexistent"
+
+	mock.ExpectGet("{" + clientID + "}").RedisNil()
+
+	got, err := repo.GetLeakyBucket(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.LastSlot.IsZero() {
+		t.Errorf("expected zero slot for non-existing client, got %v", got.LastSlot)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestLeakyBucketRepository_GetLeakyBucket_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewLeakyBucketRepository(db, 10)
+	clientID := "client1"
+	slot := time.Now().Add(time.Second).Truncate(time.Microsecond)
+
+	mock.ExpectGet("{" + clientID + "}").SetVal(millis(slot))
+
+	got, err := repo.GetLeakyBucket(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.LastSlot.Equal(slot) {
+		t.Errorf("expected LastSlot=%v, got %v", slot, got.LastSlot)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestLeakyBucketRepository_SaveLeakyBucket_PastSlot(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewLeakyBucketRepository(db, 10)
+	clientID := "client2"
+	slot := time.Now().Add(-time.Second)
+
+	mock.ExpectSet("{"+clientID+"}", millis(slot), time.Millisecond).SetVal("OK")
+
+	if err := repo.SaveLeakyBucket(ctx, clientID, ratelimit.LeakyBucket{LastSlot: slot}); err != nil {
+		t.Fatalf("unexpected error saving bucket: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestLeakyBucketRepository_ReserveSlot(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewLeakyBucketRepository(db, 10)
+	clientID := "client-reserve"
+	now := time.Now().Truncate(time.Microsecond)
+	slot := now.Add(100 * time.Millisecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, millis(now), 100.0, 5, int64(1000), 1).
+		SetVal([]interface{}{int64(1), millis(slot)})
+
+	got, allowed, err := repo.ReserveSlot(ctx, clientID, now, 100*time.Millisecond, 5, time.Second, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected slot to be reserved")
+	}
+	if !got.Equal(slot) {
+		t.Errorf("expected slot=%v, got %v", slot, got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestLeakyBucketRepository_ReserveSlot_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewLeakyBucketRepository(db, 10)
+	clientID := "client-redis-error"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, millis(now), 100.0, 5, int64(1000), 1).
+		SetErr(redisErrorExample{})
+
+	if _, _, err := repo.ReserveSlot(ctx, clientID, now, 100*time.Millisecond, 5, time.Second, 1); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestLeakyBucketRepository_ReserveSlot_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewLeakyBucketRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}), 10)
+	now := time.Now().Truncate(time.Millisecond)
+	interval := 100 * time.Millisecond
+
+	reserve := func(now time.Time, maxWait time.Duration) (time.Time, bool) {
+		t.Helper()
+		slot, allowed, err := repo.ReserveSlot(ctx, "client", now, interval, 2, maxWait, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return slot, allowed
+	}
+
+	// The first request leaks out now and the next two queue one interval
+	// apart, filling the capacity of 2.
+	for i := 0; i < 3; i++ {
+		if slot, allowed := reserve(now, time.Second); !allowed || !slot.Equal(now.Add(time.Duration(i)*interval)) {
+			t.Fatalf("reserve %d: expected slot +%v, got allowed=%v +%v", i, time.Duration(i)*interval, allowed, slot.Sub(now))
+		}
+	}
+	if _, allowed := reserve(now, time.Second); allowed {
+		t.Fatal("expected a full queue to reject the request")
+	}
+
+	// Once a slot has leaked out there is room for one more, at the back.
+	if slot, allowed := reserve(now.Add(interval), time.Second); !allowed || !slot.Equal(now.Add(3*interval)) {
+		t.Fatalf("expected slot +%v after one leak, got allowed=%v +%v", 3*interval, allowed, slot.Sub(now))
+	}
+
+	// A wait longer than max wait is rejected even with room in the queue.
+	if _, allowed := reserve(now.Add(3*interval), 50*time.Millisecond); allowed {
+		t.Fatal("expected a wait above max wait to be rejected")
+	}
+
+	// A drained bucket serves the next request right away.
+	later := now.Add(time.Second)
+	if slot, allowed := reserve(later, 0); !allowed || !slot.Equal(later) {
+		t.Errorf("expected a drained bucket to leak now, got allowed=%v +%v", allowed, slot.Sub(later))
+	}
+}
@@ -0,0 +1,77 @@
+package rdb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// overrideSuffix follows the key of the client's state. Keeping the client's
+// hash tag puts both on the same slot, and the suffix keeps the override out
+// of the state keys even when the schema leaves out the algorithm.
+const overrideSuffix = ":override"
+
+type storedOverride struct {
+	Limits    config.Limits `json:"limits"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// OverrideRepository keeps the limits set through the admin API for single
+// clients in Redis, so every instance sharing the database applies them. Each
+// override is a JSON string whose TTL ends with it.
+type OverrideRepository struct {
+	client redis.UniversalClient
+	keys   Keys
+}
+
+func NewOverrideRepository(client redis.UniversalClient, opts ...Option) *OverrideRepository {
+	return &OverrideRepository{
+		client: client,
+		keys:   newRepoConfig(opts).keys,
+	}
+}
+
+// GetOverride returns the override of the client and when it expires, or a
+// zero time when it has none.
+func (r *OverrideRepository) GetOverride(ctx context.Context, clientID string) (config.Limits, time.Time, error) {
+	val, err := r.client.Get(ctx, r.key(clientID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return config.Limits{}, time.Time{}, nil
+		}
+		return config.Limits{}, time.Time{}, err
+	}
+
+	var o storedOverride
+	if err := json.Unmarshal(val, &o); err != nil {
+		return config.Limits{}, time.Time{}, err
+	}
+	return o.Limits, o.ExpiresAt, nil
+}
+
+func (r *OverrideRepository) SaveOverride(ctx context.Context, clientID string, limits config.Limits, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	data, err := json.Marshal(storedOverride{Limits: limits, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key(clientID), data, ttl).Err()
+}
+
+// DeleteOverride removes the override of the client and reports whether it
+// had one.
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, clientID string) (bool, error) {
+	n, err := r.client.Del(ctx, r.key(clientID)).Result()
+	return n > 0, err
+}
+
+func (r *OverrideRepository) key(clientID string) string {
+	return r.keys.key(clientID) + overrideSuffix
+}
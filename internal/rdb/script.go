@@ -0,0 +1,105 @@
+package rdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// parseTimeLua defines parse_time, which converts an RFC 3339 timestamp to
+// unix milliseconds. Scripts use it to read the JSON values stored before
+// state was kept in hashes.
+const parseTimeLua = `
+local function days_from_civil(y, m, d)
+	if m <= 2 then y = y - 1 end
+	local era = math.floor(y / 400)
+	local yoe = y - era * 400
+	local mp = (m + 9) % 12
+	local doy = math.floor((153 * mp + 2) / 5) + d - 1
+	local doe = yoe * 365 + math.floor(yoe / 4) - math.floor(yoe / 100) + doy
+	return era * 146097 + doe - 719468
+end
+
+local function parse_time(s)
+	local y, mo, d, h, mi, sec, frac, zone = string.match(s,
+		'^(%d+)-(%d+)-(%d+)T(%d+):(%d+):(%d+)%.?(%d*)(.*)$')
+	local days = days_from_civil(tonumber(y), tonumber(mo), tonumber(d))
+	local ms = ((days * 24 + tonumber(h)) * 60 + tonumber(mi)) * 60 + tonumber(sec)
+	ms = ms * 1000
+	if frac ~= '' then
+		ms = ms + tonumber('0.' .. frac) * 1000
+	end
+	if zone ~= 'Z' then
+		local sign, zh, zm = string.match(zone, '^([+-])(%d+):(%d+)$')
+		local offset = (tonumber(zh) * 60 + tonumber(zm)) * 60000
+		if sign == '+' then ms = ms - offset else ms = ms + offset end
+	end
+	return ms
+end
+`
+
+// parseScriptResult unpacks the {allowed, state} pair returned by the limiter
+// scripts.
+func parseScriptResult(res []interface{}) (bool, string, error) {
+	if len(res) != 2 {
+		return false, "", errUnexpectedResult(res)
+	}
+
+	allowed, ok := res[0].(int64)
+	if !ok {
+		return false, "", errUnexpectedResult(res)
+	}
+
+	state, ok := res[1].(string)
+	if !ok {
+		return false, "", errUnexpectedResult(res)
+	}
+	return allowed == 1, state, nil
+}
+
+func errUnexpectedResult(res []interface{}) error {
+	return fmt.Errorf("unexpected script result %v", res)
+}
+
+// toMillis encodes t as unix milliseconds with a microsecond fraction, which a
+// float64 (and so a Lua number or a sorted set score) holds exactly.
+func toMillis(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1000
+}
+
+func fromMillis(ms float64) time.Time {
+	return time.UnixMicro(int64(ms*1000 + 0.5))
+}
+
+// formatNanos encodes t as unix nanoseconds. Scripts only copy such a field
+// or compare it as a Lua number, which is exact to within a microsecond.
+func formatNanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func parseNanos(s string) (time.Time, error) {
+	ns, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
+
+// getLegacyJSON reads a JSON value stored under key before state was kept in
+// hashes. The hash commands fail with WRONGTYPE on such a key, which isLegacy
+// recognizes.
+func getLegacyJSON(ctx context.Context, client redis.UniversalClient, key string, v any) error {
+	val, err := client.Get(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(val), v)
+}
+
+func isLegacy(err error) bool {
+	return redis.HasErrorPrefix(err, "WRONGTYPE")
+}
@@ -0,0 +1,140 @@
+package rdb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeCounterScript rolls the counters to the current window, weighs the
+// previous window by its remaining overlap and increments the current count
+// when the estimate stays within the limit. State is kept in a hash with the
+// fields start, prev and curr.
+//
+// KEYS[1] = counter key
+// ARGV[1] = max requests
+// ARGV[2] = window length in milliseconds
+// ARGV[3] = current time in unix milliseconds
+// ARGV[4] = start of the current window in unix milliseconds
+// ARGV[5] = request cost
+var takeCounterScript = redis.NewScript(`
+local frame = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local start = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'start', 'prev', 'curr')
+local stored = tonumber(state[1])
+local prev, curr = 0, 0
+if stored == start then
+	prev = tonumber(state[2])
+	curr = tonumber(state[3])
+elseif stored == start - frame then
+	prev = tonumber(state[3])
+end
+
+local weight = 1 - (now - start) / frame
+local n = tonumber(ARGV[5])
+local allowed = 0
+if prev * weight + curr + n <= tonumber(ARGV[1]) then
+	curr = curr + n
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'start', ARGV[4], 'prev', prev, 'curr', curr)
+redis.call('PEXPIRE', KEYS[1], frame * 2)
+return {allowed, prev, curr}
+`)
+
+type SlidingWindowCounterRepository struct {
+	client    redis.UniversalClient
+	keys      Keys
+	timeFrame time.Duration
+}
+
+func NewSlidingWindowCounterRepository(client redis.UniversalClient, timeFrame time.Duration, opts ...Option) *SlidingWindowCounterRepository {
+	return &SlidingWindowCounterRepository{
+		client:    client,
+		keys:      newRepoConfig(opts).keys,
+		timeFrame: timeFrame,
+	}
+}
+
+func (r *SlidingWindowCounterRepository) GetCounter(ctx context.Context, clientID string) (ratelimit.SlidingWindowCounter, error) {
+	vals, err := r.client.HMGet(ctx, r.keys.key(clientID), "start", "prev", "curr").Result()
+	if err != nil {
+		return ratelimit.SlidingWindowCounter{}, err
+	}
+	if vals[0] == nil {
+		return ratelimit.SlidingWindowCounter{}, nil
+	}
+
+	var fields [3]int64
+	for i, v := range vals {
+		s, _ := v.(string)
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return ratelimit.SlidingWindowCounter{}, err
+		}
+		fields[i] = n
+	}
+
+	return ratelimit.SlidingWindowCounter{
+		CurrentStart:  time.UnixMilli(fields[0]),
+		PreviousCount: int(fields[1]),
+		CurrentCount:  int(fields[2]),
+	}, nil
+}
+
+func (r *SlidingWindowCounterRepository) SaveCounter(ctx context.Context, clientID string, counter ratelimit.SlidingWindowCounter) error {
+	ttl := time.Until(counter.CurrentStart.Add(2 * r.timeFrame))
+	if ttl <= 0 {
+		ttl = time.Millisecond
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, r.keys.key(clientID),
+		"start", counter.CurrentStart.UnixMilli(),
+		"prev", counter.PreviousCount,
+		"curr", counter.CurrentCount,
+	)
+	pipe.PExpire(ctx, r.keys.key(clientID), ttl)
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TakeCounter counts a request costing n against the client's sliding window
+// inside Redis and reports whether the weighted estimate still fits.
+func (r *SlidingWindowCounterRepository) TakeCounter(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.SlidingWindowCounter, bool, error) {
+	frame := timeFrame.Milliseconds()
+	if frame <= 0 {
+		frame = 1
+	}
+	ms := now.UnixMilli()
+	start := ms - ms%frame
+
+	res, err := takeCounterScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		maxRequests, frame, toMillis(now), start, n).Slice()
+	if err != nil {
+		return ratelimit.SlidingWindowCounter{}, false, err
+	}
+	if len(res) != 3 {
+		return ratelimit.SlidingWindowCounter{}, false, errUnexpectedResult(res)
+	}
+
+	allowed, ok1 := res[0].(int64)
+	prev, ok2 := res[1].(int64)
+	curr, ok3 := res[2].(int64)
+	if !ok1 || !ok2 || !ok3 {
+		return ratelimit.SlidingWindowCounter{}, false, errUnexpectedResult(res)
+	}
+
+	return ratelimit.SlidingWindowCounter{
+		PreviousCount: int(prev),
+		CurrentCount:  int(curr),
+		CurrentStart:  time.UnixMilli(start),
+	}, allowed == 1, nil
+}
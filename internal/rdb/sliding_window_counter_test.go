@@ -0,0 +1,187 @@
+package rdb_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSlidingWindowCounterRepository_GetCounter_NonExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "nonexistent"
+
+	mock.ExpectHMGet("{"+clientID+"}", "start", "prev", "curr").SetVal([]interface{}{nil, nil, nil})
+
+	got, err := repo.GetCounter(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PreviousCount != 0 || got.CurrentCount != 0 || !got.CurrentStart.IsZero() {
+		t.Errorf("expected empty counter for non-existing client, got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_GetCounter_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "client1"
+	start := time.Now().Truncate(time.Minute)
+
+	mock.ExpectHMGet("{"+clientID+"}", "start", "prev", "curr").
+		SetVal([]interface{}{strconv.FormatInt(start.UnixMilli(), 10), "4", "2"})
+
+	got, err := repo.GetCounter(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PreviousCount != 4 || got.CurrentCount != 2 {
+		t.Errorf("expected counts 4/2, got %d/%d", got.PreviousCount, got.CurrentCount)
+	}
+	if !got.CurrentStart.Equal(start) {
+		t.Errorf("expected CurrentStart=%v, got %v", start, got.CurrentStart)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_GetCounter_ParseError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "client-parse"
+
+	mock.ExpectHMGet("{"+clientID+"}", "start", "prev", "curr").SetVal([]interface{}{"not-a-number", "0", "1"})
+
+	if _, err := repo.GetCounter(ctx, clientID); err == nil {
+		t.Errorf("expected parse error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_SaveCounter(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "client2"
+	counter := ratelimit.SlidingWindowCounter{
+		PreviousCount: 3,
+		CurrentCount:  1,
+		CurrentStart:  time.Now().Add(-2 * time.Minute),
+	}
+
+	mock.ExpectTxPipeline()
+	mock.ExpectHSet("{"+clientID+"}", "start", counter.CurrentStart.UnixMilli(), "prev", 3, "curr", 1).SetVal(3)
+	mock.ExpectPExpire("{"+clientID+"}", time.Millisecond).SetVal(true)
+	mock.ExpectTxPipelineExec()
+
+	if err := repo.SaveCounter(ctx, clientID, counter); err != nil {
+		t.Fatalf("unexpected error saving counter: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_TakeCounter(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "client-take"
+	start := time.Now().Truncate(time.Minute)
+	now := start.Add(15 * time.Second)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		5, int64(60000), float64(now.UnixMicro())/1000, start.UnixMilli(), 1).
+		SetVal([]interface{}{int64(1), int64(4), int64(2)})
+
+	got, allowed, err := repo.TakeCounter(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if got.PreviousCount != 4 || got.CurrentCount != 2 || !got.CurrentStart.Equal(start) {
+		t.Errorf("unexpected counter %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_TakeCounter_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowCounterRepository(db, time.Minute)
+	clientID := "client-redis-error"
+	start := time.Now().Truncate(time.Minute)
+	now := start.Add(15 * time.Second)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		5, int64(60000), float64(now.UnixMicro())/1000, start.UnixMilli(), 1).
+		SetErr(redisErrorExample{})
+
+	if _, _, err := repo.TakeCounter(ctx, clientID, now, 5, time.Minute, 1); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowCounterRepository_TakeCounter_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewSlidingWindowCounterRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute)
+	start := time.Now().Truncate(time.Minute)
+
+	take := func(now time.Time) (ratelimit.SlidingWindowCounter, bool) {
+		t.Helper()
+		got, allowed, err := repo.TakeCounter(ctx, "client", now, 4, time.Minute, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return got, allowed
+	}
+
+	for i := 1; i <= 4; i++ {
+		if got, allowed := take(start); !allowed || got.CurrentCount != i {
+			t.Fatalf("take %d: expected to be allowed with count %d, got allowed=%v %+v", i, i, allowed, got)
+		}
+	}
+	if got, allowed := take(start.Add(time.Second)); allowed || got.CurrentCount != 4 {
+		t.Fatalf("expected a fifth request to be rejected, got allowed=%v %+v", allowed, got)
+	}
+
+	// A quarter into the next window the previous one still weighs 3 of the
+	// 4 requests, leaving room for one.
+	next := start.Add(time.Minute + 15*time.Second)
+	got, allowed := take(next)
+	if !allowed || got.PreviousCount != 4 || got.CurrentCount != 1 || !got.CurrentStart.Equal(start.Add(time.Minute)) {
+		t.Fatalf("expected the window to roll over and allow one request, got allowed=%v %+v", allowed, got)
+	}
+	if _, allowed := take(next); allowed {
+		t.Fatal("expected the weighted estimate to reject the next request")
+	}
+
+	// Two windows later nothing is left of either count.
+	if got, allowed := take(start.Add(3 * time.Minute)); !allowed || got.PreviousCount != 0 || got.CurrentCount != 1 {
+		t.Errorf("expected a fresh window, got allowed=%v %+v", allowed, got)
+	}
+}
@@ -0,0 +1,152 @@
+package rdb
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeLogScript trims entries that left the window, then appends the request
+// as n entries when there is still room. Entries live in a sorted set scored
+// by their time in unix milliseconds. For a rejected request the entry that
+// has to leave before it fits is returned in place of the oldest one.
+//
+// KEYS[1] = log key
+// ARGV[1] = max requests
+// ARGV[2] = current time score
+// ARGV[3] = newest score that already left the window
+// ARGV[4] = unique member for this request
+// ARGV[5] = log TTL in milliseconds
+// ARGV[6] = request cost
+var takeLogScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+
+local max = tonumber(ARGV[1])
+local n = tonumber(ARGV[6])
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+local blocking = 0
+if count + n <= max then
+	for i = 1, n do
+		redis.call('ZADD', KEYS[1], ARGV[2], ARGV[4] .. '-' .. i)
+	end
+	count = count + n
+	allowed = 1
+elseif count > 0 then
+	blocking = math.min(math.max(0, count + n - max - 1), count - 1)
+end
+
+if count > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], blocking, blocking, 'WITHSCORES')
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+return {allowed, count, oldest[2] or '', newest[2] or ''}
+`)
+
+type SlidingWindowLogRepository struct {
+	client    redis.UniversalClient
+	keys      Keys
+	timeFrame time.Duration
+}
+
+func NewSlidingWindowLogRepository(client redis.UniversalClient, timeFrame time.Duration, opts ...Option) *SlidingWindowLogRepository {
+	return &SlidingWindowLogRepository{
+		client:    client,
+		keys:      newRepoConfig(opts).keys,
+		timeFrame: timeFrame,
+	}
+}
+
+func (r *SlidingWindowLogRepository) GetLog(ctx context.Context, clientID string) (ratelimit.SlidingLog, error) {
+	entries, err := r.client.ZRangeWithScores(ctx, r.keys.key(clientID), 0, -1).Result()
+	if err != nil {
+		return ratelimit.SlidingLog{}, err
+	}
+
+	var log ratelimit.SlidingLog
+	for _, e := range entries {
+		log.Timestamps = append(log.Timestamps, fromMillis(e.Score))
+	}
+	return log, nil
+}
+
+func (r *SlidingWindowLogRepository) SaveLog(ctx context.Context, clientID string, log ratelimit.SlidingLog) error {
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, r.keys.key(clientID))
+	if len(log.Timestamps) > 0 {
+		members := make([]redis.Z, 0, len(log.Timestamps))
+		for _, ts := range log.Timestamps {
+			members = append(members, redis.Z{Score: toMillis(ts), Member: logMember(ts)})
+		}
+		pipe.ZAdd(ctx, r.keys.key(clientID), members...)
+
+		ttl := time.Until(log.Timestamps[len(log.Timestamps)-1].Add(r.timeFrame))
+		if ttl <= 0 {
+			ttl = time.Millisecond
+		}
+		pipe.PExpire(ctx, r.keys.key(clientID), ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TakeLog records a request costing n in the client's log inside Redis when
+// it still fits into maxRequests over the last timeFrame.
+func (r *SlidingWindowLogRepository) TakeLog(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (int, time.Time, time.Time, bool, error) {
+	ttl := timeFrame.Milliseconds()
+	if ttl <= 0 {
+		ttl = 1
+	}
+
+	res, err := takeLogScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		maxRequests, toMillis(now), toMillis(now.Add(-timeFrame)), logMember(now), ttl, n).Slice()
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, false, err
+	}
+	return parseLogResult(res)
+}
+
+func parseLogResult(res []interface{}) (int, time.Time, time.Time, bool, error) {
+	if len(res) != 4 {
+		return 0, time.Time{}, time.Time{}, false, errUnexpectedResult(res)
+	}
+
+	allowed, ok := res[0].(int64)
+	if !ok {
+		return 0, time.Time{}, time.Time{}, false, errUnexpectedResult(res)
+	}
+	count, ok := res[1].(int64)
+	if !ok {
+		return 0, time.Time{}, time.Time{}, false, errUnexpectedResult(res)
+	}
+
+	var bounds [2]time.Time
+	for i, v := range res[2:] {
+		raw, ok := v.(string)
+		if !ok {
+			return 0, time.Time{}, time.Time{}, false, errUnexpectedResult(res)
+		}
+		if raw == "" {
+			continue
+		}
+		score, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, time.Time{}, time.Time{}, false, err
+		}
+		bounds[i] = fromMillis(score)
+	}
+	return int(count), bounds[0], bounds[1], allowed == 1, nil
+}
+
+// logMember builds a sorted set member that stays unique when two instances
+// log a request in the same nanosecond.
+func logMember(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+}
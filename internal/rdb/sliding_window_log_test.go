@@ -0,0 +1,226 @@
+package rdb_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func score(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1000
+}
+
+func TestSlidingWindowLogRepository_GetLog_NonExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "nonexistent"
+
+	mock.ExpectZRangeWithScores("{"+clientID+"}", 0, -1).SetVal([]redis.Z{})
+
+	got, err := repo.GetLog(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Timestamps) != 0 {
+		t.Errorf("expected empty log for non-existing client, got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_GetLog_ExistingClient(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client1"
+	first := time.Now().Add(-time.Second).Truncate(time.Microsecond)
+	second := time.Now().Truncate(time.Microsecond)
+
+	mock.ExpectZRangeWithScores("{"+clientID+"}", 0, -1).SetVal([]redis.Z{
+		{Score: score(first), Member: "a"},
+		{Score: score(second), Member: "b"},
+	})
+
+	got, err := repo.GetLog(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Timestamps) != 2 {
+		t.Fatalf("expected 2 timestamps, got %d", len(got.Timestamps))
+	}
+	if !got.Timestamps[0].Equal(first) || !got.Timestamps[1].Equal(second) {
+		t.Errorf("expected timestamps [%v %v], got %v", first, second, got.Timestamps)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_GetLog_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client-redis-error"
+
+	mock.ExpectZRangeWithScores("{"+clientID+"}", 0, -1).SetErr(redisErrorExample{})
+
+	if _, err := repo.GetLog(ctx, clientID); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_SaveLog_EmptyLog(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client2"
+
+	mock.ExpectTxPipeline()
+	mock.ExpectDel("{" + clientID + "}").SetVal(1)
+	mock.ExpectTxPipelineExec()
+
+	if err := repo.SaveLog(ctx, clientID, ratelimit.SlidingLog{}); err != nil {
+		t.Fatalf("unexpected error saving log: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_TakeLog_Allowed(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client-take"
+	now := time.Now().Truncate(time.Microsecond)
+	oldest := now.Add(-10 * time.Second)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		5, score(now), score(now.Add(-time.Minute)), `^\d+-[0-9a-z]+$`, int64(60000), 1).
+		SetVal([]interface{}{int64(1), int64(3),
+			strconv.FormatFloat(score(oldest), 'f', -1, 64), strconv.FormatFloat(score(now), 'f', -1, 64)})
+
+	count, gotOldest, gotNewest, allowed, err := repo.TakeLog(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if count != 3 {
+		t.Errorf("expected count=3, got %d", count)
+	}
+	if !gotOldest.Equal(oldest) {
+		t.Errorf("expected oldest=%v, got %v", oldest, gotOldest)
+	}
+	if !gotNewest.Equal(now) {
+		t.Errorf("expected newest=%v, got %v", now, gotNewest)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_TakeLog_NoScriptFallback(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client-noscript"
+	now := time.Now().Truncate(time.Microsecond)
+	args := []interface{}{5, score(now), score(now.Add(-time.Minute)), `^\d+-[0-9a-z]+$`, int64(60000), 1}
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, args...).
+		SetErr(redisNoScriptError{})
+	mock.Regexp().ExpectEval("ZREMRANGEBYSCORE", []string{"{" + clientID + "}"}, args...).
+		SetVal([]interface{}{int64(0), int64(5),
+			strconv.FormatFloat(score(now), 'f', -1, 64), strconv.FormatFloat(score(now), 'f', -1, 64)})
+
+	count, _, _, allowed, err := repo.TakeLog(ctx, clientID, now, 5, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be rejected")
+	}
+	if count != 5 {
+		t.Errorf("expected count=5, got %d", count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_TakeLog_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewSlidingWindowLogRepository(db, time.Minute)
+	clientID := "client-redis-error"
+	now := time.Now().Truncate(time.Microsecond)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		5, score(now), score(now.Add(-time.Minute)), `^\d+-[0-9a-z]+$`, int64(60000), 1).
+		SetErr(redisErrorExample{})
+
+	if _, _, _, _, err := repo.TakeLog(ctx, clientID, now, 5, time.Minute, 1); err == nil {
+		t.Errorf("expected Redis error, got nil")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestSlidingWindowLogRepository_TakeLog_Script(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewSlidingWindowLogRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute)
+	start := time.Now().Truncate(time.Millisecond)
+
+	take := func(now time.Time, n int) (int, time.Time, bool) {
+		t.Helper()
+		count, oldest, _, allowed, err := repo.TakeLog(ctx, "client", now, 3, time.Minute, n)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return count, oldest, allowed
+	}
+
+	if count, oldest, allowed := take(start, 2); !allowed || count != 2 || !oldest.Equal(start) {
+		t.Fatalf("expected two entries to be admitted, got allowed=%v count=%d oldest=%v", allowed, count, oldest)
+	}
+	if ttl := server.TTL("{client}"); ttl != time.Minute {
+		t.Errorf("expected the log to live for the time frame, got %v", ttl)
+	}
+	second := start.Add(20 * time.Second)
+	if count, _, allowed := take(second, 1); !allowed || count != 3 {
+		t.Fatalf("expected the third entry to be admitted, got allowed=%v count=%d", allowed, count)
+	}
+
+	// At the limit the request is rejected, leaving the log alone and
+	// pointing at the entry that has to leave first.
+	if count, oldest, allowed := take(start.Add(30*time.Second), 1); allowed || count != 3 || !oldest.Equal(start) {
+		t.Fatalf("expected rejection blocked by the first entry, got allowed=%v count=%d oldest=%v", allowed, count, oldest)
+	}
+	if members, _ := server.ZMembers("{client}"); len(members) != 3 {
+		t.Errorf("expected a rejection to add nothing, got %v", members)
+	}
+
+	// Once the first two entries slide out of the window there is room again.
+	if count, oldest, allowed := take(start.Add(time.Minute), 2); !allowed || count != 3 || !oldest.Equal(second) {
+		t.Fatalf("expected re-admission after the window slid, got allowed=%v count=%d oldest=%v", allowed, count, oldest)
+	}
+	if ttl := server.TTL("{client}"); ttl != time.Minute {
+		t.Errorf("expected the TTL to be refreshed, got %v", ttl)
+	}
+}
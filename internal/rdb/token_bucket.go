@@ -2,49 +2,171 @@ package rdb
 
 import (
 	"context"
-	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/redis/go-redis/v9"
 )
 
+// takeTokenScript refills and consumes a bucket in one step so concurrent
+// callers on different instances cannot spend the same token twice. The
+// bucket is kept in a hash with the fields tokens and last, the last refill in
+// unix nanoseconds, and is rewritten as one whichever version stored it.
+//
+// KEYS[1] = bucket key
+// ARGV[1] = max tokens
+// ARGV[2] = refill rate in tokens per second
+// ARGV[3] = current time in unix nanoseconds
+// ARGV[4] = bucket TTL in milliseconds
+// ARGV[5] = tokens to consume
+var takeTokenScript = redis.NewScript(parseTimeLua + `
+local max_tokens = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local tokens = max_tokens
+local last = ARGV[3]
+
+if redis.call('TYPE', KEYS[1]).ok == 'string' then
+	local bucket = cjson.decode(redis.call('GET', KEYS[1]))
+	tokens = bucket.Tokens
+	last = string.format('%.0f', parse_time(bucket.LastRefill) * 1e6)
+	redis.call('DEL', KEYS[1])
+else
+	local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+	if state[1] then
+		tokens = tonumber(state[1])
+		last = state[2]
+	end
+end
+
+local elapsed = (now - tonumber(last)) / 1e9
+if elapsed > 0 then
+	tokens = math.min(max_tokens, tokens + elapsed * rate)
+	last = ARGV[3]
+end
+
+local n = tonumber(ARGV[5])
+local allowed = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+end
+
+-- Tokens are fractional, which a script reply would truncate.
+tokens = string.format('%.17g', tokens)
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'last', last)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, tokens, last}
+`)
+
 type TokenBucketRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
+	keys   Keys
 	ttl    time.Duration
 }
 
-func NewTokenBucketRepository(client *redis.Client, maxTokens float64, refillRate float64) *TokenBucketRepository {
-	refillTime := time.Duration(maxTokens/refillRate) * time.Second
-	ttl := (refillTime * 2) + (30 * time.Second)
-
+func NewTokenBucketRepository(client redis.UniversalClient, maxTokens float64, refillRate float64, opts ...Option) *TokenBucketRepository {
 	return &TokenBucketRepository{
 		client: client,
-		ttl:    ttl,
+		keys:   newRepoConfig(opts).keys,
+		ttl:    tokenBucketTTL(maxTokens, refillRate),
 	}
 }
 
+// tokenBucketTTL keeps a bucket around for twice the time it takes to refill
+// completely, so an expired key always stands for a full bucket.
+func tokenBucketTTL(maxTokens float64, refillRate float64) time.Duration {
+	refillTime := time.Duration(maxTokens/refillRate) * time.Second
+	return (refillTime * 2) + (30 * time.Second)
+}
+
 func (r *TokenBucketRepository) GetBucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error) {
-	val, err := r.client.Get(ctx, clientID).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return ratelimit.TokenBucket{}, nil
+	vals, err := r.client.HMGet(ctx, r.keys.key(clientID), "tokens", "last").Result()
+	if isLegacy(err) {
+		var bucket ratelimit.TokenBucket
+		if err := getLegacyJSON(ctx, r.client, r.keys.key(clientID), &bucket); err != nil && err != redis.Nil {
+			return ratelimit.TokenBucket{}, err
 		}
-		return ratelimit.TokenBucket{}, err
+		return bucket, nil
 	}
-
-	var bucket ratelimit.TokenBucket
-	if err := json.Unmarshal([]byte(val), &bucket); err != nil {
+	if err != nil {
 		return ratelimit.TokenBucket{}, err
 	}
+	if vals[0] == nil {
+		return ratelimit.TokenBucket{}, nil
+	}
 
-	return bucket, nil
+	tokens, _ := vals[0].(string)
+	last, _ := vals[1].(string)
+	return parseBucket(tokens, last)
 }
 
 func (r *TokenBucketRepository) SaveBucket(ctx context.Context, clientID string, bucket ratelimit.TokenBucket) error {
-	data, err := json.Marshal(bucket)
+	// DEL first replaces a JSON bucket of an earlier version, which HSET
+	// would refuse.
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, r.keys.key(clientID))
+	pipe.HSet(ctx, r.keys.key(clientID), "tokens", formatTokens(bucket.Tokens), "last", formatNanos(bucket.LastRefill))
+	pipe.PExpire(ctx, r.keys.key(clientID), r.ttl)
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *TokenBucketRepository) DeleteBucket(ctx context.Context, clientID string) error {
+	return r.client.Del(ctx, r.keys.key(clientID)).Err()
+}
+
+// ListBuckets returns the IDs of the clients starting with prefix that have a
+// bucket, sorted.
+func (r *TokenBucketRepository) ListBuckets(ctx context.Context, prefix string) ([]string, error) {
+	return scanClientIDs(ctx, r.client, r.keys, prefix)
+}
+
+// TakeToken refills the client's bucket up to now and consumes n tokens inside
+// Redis. The script is sent with EVALSHA and reloaded with EVAL when
+// Redis answers NOSCRIPT. The key TTL follows the limits passed in, which may
+// differ from the ones the repository was created with after a reload.
+func (r *TokenBucketRepository) TakeToken(ctx context.Context, clientID string, now time.Time, maxTokens float64, refillRate float64, n int) (ratelimit.TokenBucket, bool, error) {
+	res, err := takeTokenScript.Run(ctx, r.client, []string{r.keys.key(clientID)},
+		maxTokens, refillRate, formatNanos(now), tokenBucketTTL(maxTokens, refillRate).Milliseconds(), n).Slice()
+	if err != nil {
+		return ratelimit.TokenBucket{}, false, err
+	}
+	if len(res) != 3 {
+		return ratelimit.TokenBucket{}, false, errUnexpectedResult(res)
+	}
+
+	allowed, ok1 := res[0].(int64)
+	tokens, ok2 := res[1].(string)
+	last, ok3 := res[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return ratelimit.TokenBucket{}, false, errUnexpectedResult(res)
+	}
+
+	bucket, err := parseBucket(tokens, last)
 	if err != nil {
-		return err
+		return ratelimit.TokenBucket{}, false, err
+	}
+	return bucket, allowed == 1, nil
+}
+
+// formatTokens writes tokens with enough digits to read the same float64
+// back, as the script does.
+func formatTokens(tokens float64) string {
+	return strconv.FormatFloat(tokens, 'g', -1, 64)
+}
+
+func parseBucket(tokens, last string) (ratelimit.TokenBucket, error) {
+	t, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return ratelimit.TokenBucket{}, err
+	}
+	lastRefill, err := parseNanos(last)
+	if err != nil {
+		return ratelimit.TokenBucket{}, err
 	}
-	return r.client.Set(ctx, clientID, data, r.ttl).Err()
+	return ratelimit.TokenBucket{Tokens: t, LastRefill: lastRefill}, nil
 }
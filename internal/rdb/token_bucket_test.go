@@ -3,12 +3,16 @@ package rdb_test
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
 	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
 )
 
 func setupTokenBucketRepoWithBucket(ctx context.Context, clientID string, tokens float64, lastRefill time.Time, maxTokens, refillRate float64) (*rdb.TokenBucketRepository, redismock.ClientMock) {
@@ -19,23 +23,41 @@ func setupTokenBucketRepoWithBucket(ctx context.Context, clientID string, tokens
 		Tokens:     tokens,
 		LastRefill: lastRefill,
 	}
-	data, _ := json.Marshal(bucket)
 	refillTime := time.Duration(maxTokens/refillRate) * time.Second
 	expectedTTL := (refillTime * 2) + (30 * time.Second)
 
-	mock.ExpectSet(clientID, data, expectedTTL).SetVal("OK")
+	expectSaveBucket(mock, "{"+clientID+"}", bucket, expectedTTL)
 	_ = repo.SaveBucket(ctx, clientID, bucket)
 
 	return repo, mock
 }
 
+// expectSaveBucket expects the commands SaveBucket sends for bucket.
+func expectSaveBucket(mock redismock.ClientMock, key string, bucket ratelimit.TokenBucket, ttl time.Duration) {
+	mock.ExpectTxPipeline()
+	mock.ExpectDel(key).SetVal(0)
+	mock.ExpectHSet(key, hashBucketFields(bucket)...).SetVal(2)
+	mock.ExpectPExpire(key, ttl).SetVal(true)
+	mock.ExpectTxPipelineExec()
+}
+
+func hashBucketFields(bucket ratelimit.TokenBucket) []interface{} {
+	return []interface{}{"tokens", strconv.FormatFloat(bucket.Tokens, 'g', -1, 64), "last", strconv.FormatInt(bucket.LastRefill.UnixNano(), 10)}
+}
+
+// hashBucket is the reply to HMGET tokens last for bucket.
+func hashBucket(bucket ratelimit.TokenBucket) []interface{} {
+	fields := hashBucketFields(bucket)
+	return []interface{}{fields[1], fields[3]}
+}
+
 func TestTokenBucketRepository_GetBucket_NonExistingClient(t *testing.T) {
 	ctx := context.Background()
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
 	clientID := "nonexistent"
 
-	mock.ExpectGet(clientID).RedisNil()
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetVal([]interface{}{nil, nil})
 
 	got, err := repo.GetBucket(ctx, clientID)
 	if err != nil {
@@ -57,11 +79,10 @@ func TestTokenBucketRepository_GetBucket_ExistingClient(t *testing.T) {
 
 	repo, mock := setupTokenBucketRepoWithBucket(ctx, clientID, expectedTokens, expectedLastRefill, 100.0, 10.0)
 
-	data, _ := json.Marshal(ratelimit.TokenBucket{
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetVal(hashBucket(ratelimit.TokenBucket{
 		Tokens:     expectedTokens,
 		LastRefill: expectedLastRefill,
-	})
-	mock.ExpectGet(clientID).SetVal(string(data))
+	}))
 
 	got, err := repo.GetBucket(ctx, clientID)
 	if err != nil {
@@ -85,7 +106,7 @@ func TestTokenBucketRepository_GetBucket_RedisError(t *testing.T) {
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
 
-	mock.ExpectGet(clientID).SetErr(redisErrorExample{})
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetErr(redisErrorExample{})
 
 	_, err := repo.GetBucket(ctx, clientID)
 	if err == nil {
@@ -97,18 +118,43 @@ func TestTokenBucketRepository_GetBucket_RedisError(t *testing.T) {
 	}
 }
 
-func TestTokenBucketRepository_GetBucket_UnmarshalError(t *testing.T) {
+func TestTokenBucketRepository_GetBucket_ParseError(t *testing.T) {
 	ctx := context.Background()
-	clientID := "client-unmarshal"
+	clientID := "client-parse"
 
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
 
-	mock.ExpectGet(clientID).SetVal("not-a-json")
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetVal([]interface{}{"not-a-number", "0"})
 
 	_, err := repo.GetBucket(ctx, clientID)
 	if err == nil {
-		t.Errorf("expected JSON unmarshal error, got nil")
+		t.Errorf("expected parse error, got nil")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestTokenBucketRepository_GetBucket_LegacyJSON(t *testing.T) {
+	ctx := context.Background()
+	clientID := "client-legacy"
+
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
+
+	lastRefill := time.Now().Add(-time.Second)
+	data, _ := json.Marshal(ratelimit.TokenBucket{Tokens: 42.5, LastRefill: lastRefill})
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetErr(redisWrongTypeError{})
+	mock.ExpectGet("{" + clientID + "}").SetVal(string(data))
+
+	got, err := repo.GetBucket(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Tokens != 42.5 || !got.LastRefill.Equal(lastRefill) {
+		t.Errorf("expected the JSON bucket, got %+v", got)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -128,18 +174,16 @@ func TestTokenBucketRepository_SaveBucket_NewClient(t *testing.T) {
 		LastRefill: time.Now(),
 	}
 
-	data, _ := json.Marshal(bucket)
-
 	refillTime := time.Duration(maxTokens/refillRate) * time.Second
 	expectedTTL := (refillTime * 2) + (30 * time.Second)
 
-	mock.ExpectSet(clientID, data, expectedTTL).SetVal("OK")
+	expectSaveBucket(mock, "{"+clientID+"}", bucket, expectedTTL)
 
 	if err := repo.SaveBucket(ctx, clientID, bucket); err != nil {
 		t.Fatalf("unexpected error saving bucket: %v", err)
 	}
 
-	mock.ExpectGet(clientID).SetVal(string(data))
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetVal(hashBucket(bucket))
 	got, err := repo.GetBucket(ctx, clientID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -165,18 +209,16 @@ func TestTokenBucketRepository_SaveBucket_ExistingClient(t *testing.T) {
 		LastRefill: time.Now(),
 	}
 
-	data2, _ := json.Marshal(updatedBucket)
-
 	refillTime := time.Duration(maxTokens/refillRate) * time.Second
 	expectedTTL := (refillTime * 2) + (30 * time.Second)
 
-	mock.ExpectSet(clientID, data2, expectedTTL).SetVal("OK")
+	expectSaveBucket(mock, "{"+clientID+"}", updatedBucket, expectedTTL)
 
 	if err := repo.SaveBucket(ctx, clientID, updatedBucket); err != nil {
 		t.Fatalf("unexpected error saving bucket: %v", err)
 	}
 
-	mock.ExpectGet(clientID).SetVal(string(data2))
+	mock.ExpectHMGet("{"+clientID+"}", "tokens", "last").SetVal(hashBucket(updatedBucket))
 	got, err := repo.GetBucket(ctx, clientID)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -193,7 +235,7 @@ func TestTokenBucketRepository_SaveBucket_ExistingClient(t *testing.T) {
 	}
 }
 
-func TestTokenBucketRepository_SaveBucket_RedisSetError(t *testing.T) {
+func TestTokenBucketRepository_SaveBucket_RedisError(t *testing.T) {
 	ctx := context.Background()
 	db, mock := redismock.NewClientMock()
 	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
@@ -204,19 +246,164 @@ func TestTokenBucketRepository_SaveBucket_RedisSetError(t *testing.T) {
 		LastRefill: time.Now(),
 	}
 
-	data, _ := json.Marshal(bucket)
+	mock.ExpectTxPipeline()
+	mock.ExpectDel("{" + clientID + "}").SetVal(0)
+	mock.ExpectHSet("{"+clientID+"}", hashBucketFields(bucket)...).SetErr(redisErrorExample{})
+
+	err := repo.SaveBucket(ctx, clientID, bucket)
+	if err == nil {
+		t.Errorf("expected Redis HSET error, got nil")
+	}
 
-	refillTime := time.Duration(100.0/10.0) * time.Second
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestTokenBucketRepository_TakeToken_Allowed(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	maxTokens, refillRate := 100.0, 10.0
+	repo := rdb.NewTokenBucketRepository(db, maxTokens, refillRate)
+	clientID := "client-take"
+	now := time.Now().UTC()
+
+	nowNanos := strconv.FormatInt(now.UnixNano(), 10)
+	refillTime := time.Duration(maxTokens/refillRate) * time.Second
 	expectedTTL := (refillTime * 2) + (30 * time.Second)
 
-	mock.ExpectSet(clientID, data, expectedTTL).SetErr(redisErrorExample{})
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		maxTokens, refillRate, nowNanos, expectedTTL.Milliseconds(), 1).
+		SetVal([]interface{}{int64(1), "99", nowNanos})
 
-	err := repo.SaveBucket(ctx, clientID, bucket)
+	got, allowed, err := repo.TakeToken(ctx, clientID, now, maxTokens, refillRate, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if got.Tokens != 99 {
+		t.Errorf("expected Tokens=99, got %.2f", got.Tokens)
+	}
+	if !got.LastRefill.Equal(now) {
+		t.Errorf("expected LastRefill=%v, got %v", now, got.LastRefill)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestTokenBucketRepository_TakeToken_NoScriptFallback(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	maxTokens, refillRate := 100.0, 10.0
+	repo := rdb.NewTokenBucketRepository(db, maxTokens, refillRate)
+	clientID := "client-noscript"
+	now := time.Now().UTC()
+
+	nowNanos := strconv.FormatInt(now.UnixNano(), 10)
+	refillTime := time.Duration(maxTokens/refillRate) * time.Second
+	expectedTTL := (refillTime * 2) + (30 * time.Second)
+	args := []interface{}{maxTokens, refillRate, nowNanos, expectedTTL.Milliseconds(), 1}
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"}, args...).
+		SetErr(redisNoScriptError{})
+	mock.Regexp().ExpectEval("HMGET", []string{"{" + clientID + "}"}, args...).
+		SetVal([]interface{}{int64(0), "0.5", nowNanos})
+
+	got, allowed, err := repo.TakeToken(ctx, clientID, now, maxTokens, refillRate, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be rejected")
+	}
+	if got.Tokens != 0.5 {
+		t.Errorf("expected Tokens=0.5, got %.2f", got.Tokens)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestTokenBucketRepository_TakeToken_RedisError(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	maxTokens, refillRate := 100.0, 10.0
+	repo := rdb.NewTokenBucketRepository(db, maxTokens, refillRate)
+	clientID := "client-redis-error"
+	now := time.Now().UTC()
+
+	nowNanos := strconv.FormatInt(now.UnixNano(), 10)
+	refillTime := time.Duration(maxTokens/refillRate) * time.Second
+	expectedTTL := (refillTime * 2) + (30 * time.Second)
+
+	mock.Regexp().ExpectEvalSha("^[0-9a-f]{40}$", []string{"{" + clientID + "}"},
+		maxTokens, refillRate, nowNanos, expectedTTL.Milliseconds(), 1).
+		SetErr(redisErrorExample{})
+
+	_, allowed, err := repo.TakeToken(ctx, clientID, now, maxTokens, refillRate, 1)
 	if err == nil {
-		t.Errorf("expected Redis SET error, got nil")
+		t.Errorf("expected Redis error, got nil")
+	}
+	if allowed {
+		t.Error("expected request to be rejected on error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
 	}
+}
+
+func TestTokenBucketRepository_DeleteAndListBuckets(t *testing.T) {
+	ctx := context.Background()
+	db, mock := redismock.NewClientMock()
+	repo := rdb.NewTokenBucketRepository(db, 100.0, 10.0)
+
+	mock.ExpectDel("{tb:client1}").SetVal(1)
+	mock.ExpectScan(0, "{tb:*}", 100).SetVal([]string{"{tb:client2}", "tb:legacy"}, 0)
 
+	if err := repo.DeleteBucket(ctx, "tb:client1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := repo.ListBuckets(ctx, "tb:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != "tb:client2" {
+		t.Errorf("expected [tb:client2], got %v", got)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unmet expectations: %v", err)
 	}
 }
+
+func TestTokenBucketRepository_TakeToken_LegacyJSON(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	repo := rdb.NewTokenBucketRepository(redis.NewClient(&redis.Options{Addr: server.Addr()}), 100.0, 10.0)
+
+	now := time.Now()
+	data, _ := json.Marshal(ratelimit.TokenBucket{Tokens: 5, LastRefill: now.Add(-time.Second)})
+	server.Set("{client}", string(data))
+
+	got, allowed, err := repo.TakeToken(ctx, "client", now, 100.0, 10.0, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// One second at 10 tokens per second refills 10 on top of the 5 left.
+	if !allowed || math.Abs(got.Tokens-14) > 1e-3 || !got.LastRefill.Equal(now) {
+		t.Errorf("expected 14 tokens left refilled up to now, got allowed=%v, %+v", allowed, got)
+	}
+	if typ := server.Type("{client}"); typ != "hash" {
+		t.Errorf("expected the bucket converted to a hash, got %s", typ)
+	}
+
+	got, allowed, err = repo.TakeToken(ctx, "client", now, 100.0, 10.0, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed || math.Abs(got.Tokens-10) > 1e-3 {
+		t.Errorf("expected 10 tokens left from the hash, got allowed=%v, %+v", allowed, got)
+	}
+}
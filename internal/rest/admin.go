@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminPolicies gives the admin API access to the running policies.
+type AdminPolicies interface {
+	Clients(ctx context.Context, policy string) ([]string, error)
+	State(ctx context.Context, policy, key string) (policy.ClientState, error)
+	Reset(ctx context.Context, policy, key string) error
+	Override(ctx context.Context, policy, key string, limits config.Limits, ttl time.Duration) (policy.Override, error)
+	ClearOverride(ctx context.Context, policy, key string) error
+}
+
+// AdminHandler serves the admin API, which inspects and resets the state of
+// clients and overrides their limits for a while.
+type AdminHandler struct {
+	policies AdminPolicies
+}
+
+func NewAdminHandler(policies AdminPolicies) *AdminHandler {
+	return &AdminHandler{policies: policies}
+}
+
+// overrideRequest is the body of an override: the limits block of the
+// policy's algorithm and how long it lasts.
+type overrideRequest struct {
+	config.Limits
+	TTLSeconds int `json:"ttl-seconds"`
+}
+
+func (h *AdminHandler) Clients(c *gin.Context) {
+	clients, err := h.policies.Clients(c.Request.Context(), c.Param("policy"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+func (h *AdminHandler) State(c *gin.Context) {
+	state, err := h.policies.State(c.Request.Context(), c.Param("policy"), c.Param("key"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+func (h *AdminHandler) Reset(c *gin.Context) {
+	if err := h.policies.Reset(c.Request.Context(), c.Param("policy"), c.Param("key")); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) Override(c *gin.Context) {
+	var req overrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid override body"})
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	override, err := h.policies.Override(c.Request.Context(), c.Param("policy"), c.Param("key"), req.Limits, ttl)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, override)
+}
+
+func (h *AdminHandler) ClearOverride(c *gin.Context) {
+	if err := h.policies.ClearOverride(c.Request.Context(), c.Param("policy"), c.Param("key")); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// writeError answers with the status matching the code of a domain error.
+// Other errors are reported as internal without their details.
+func writeError(c *gin.Context, err error) {
+	var e *domain.Error
+	if !errors.As(err, &e) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		return
+	}
+
+	switch e.Code() {
+	case domain.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": e.Message()})
+	case domain.ErrInvalidArgument:
+		c.JSON(http.StatusBadRequest, gin.H{"error": e.Message()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
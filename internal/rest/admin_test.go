@@ -0,0 +1,113 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rest"
+	"github.com/gin-gonic/gin"
+)
+
+type stubPolicies struct {
+	err    error
+	limits config.Limits
+	ttl    time.Duration
+}
+
+func (s *stubPolicies) Clients(ctx context.Context, p string) ([]string, error) {
+	return []string{"alice"}, s.err
+}
+
+func (s *stubPolicies) State(ctx context.Context, p, key string) (policy.ClientState, error) {
+	return policy.ClientState{Policy: p, Key: key}, s.err
+}
+
+func (s *stubPolicies) Reset(ctx context.Context, p, key string) error {
+	return s.err
+}
+
+func (s *stubPolicies) Override(_ context.Context, p, key string, limits config.Limits, ttl time.Duration) (policy.Override, error) {
+	s.limits, s.ttl = limits, ttl
+	return policy.Override{Limits: limits}, s.err
+}
+
+func (s *stubPolicies) ClearOverride(_ context.Context, p, key string) error {
+	return s.err
+}
+
+func serveAdmin(policies rest.AdminPolicies, method, path, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := rest.NewAdminHandler(policies)
+	r := gin.New()
+	r.GET("/policies/:policy/clients", h.Clients)
+	r.GET("/policies/:policy/clients/:key", h.State)
+	r.DELETE("/policies/:policy/clients/:key", h.Reset)
+	r.PUT("/policies/:policy/clients/:key/override", h.Override)
+	r.DELETE("/policies/:policy/clients/:key/override", h.ClearOverride)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestAdminHandler(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/policies/fw/clients", http.StatusOK},
+		{http.MethodGet, "/policies/fw/clients/alice", http.StatusOK},
+		{http.MethodDelete, "/policies/fw/clients/alice", http.StatusNoContent},
+		{http.MethodDelete, "/policies/fw/clients/alice/override", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if w := serveAdmin(&stubPolicies{}, tt.method, tt.path, ""); w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestAdminHandler_Override(t *testing.T) {
+	policies := &stubPolicies{}
+	body := `{"fixed-window": {"max-requests": 100, "time-frame-ms": 60000}, "ttl-seconds": 300}`
+	w := serveAdmin(policies, http.MethodPut, "/policies/fw/clients/alice/override", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if fw := policies.limits.FixedWindow; fw == nil || fw.MaxRequests != 100 || fw.TimeFrameMs != 60000 {
+		t.Errorf("expected fixed-window limits 100/60000, got %+v", fw)
+	}
+	if policies.ttl != 5*time.Minute {
+		t.Errorf("expected a 5m ttl, got %v", policies.ttl)
+	}
+
+	w = serveAdmin(policies, http.MethodPut, "/policies/fw/clients/alice/override", "{")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed body, got %d", w.Code)
+	}
+}
+
+func TestAdminHandler_Errors(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"not found":        {domain.NewError(domain.ErrNotFound, "unknown policy"), http.StatusNotFound},
+		"invalid argument": {domain.NewError(domain.ErrInvalidArgument, "no state"), http.StatusBadRequest},
+		"store failure":    {errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for name, tt := range tests {
+		w := serveAdmin(&stubPolicies{err: tt.err}, http.MethodGet, "/policies/fw/clients/alice", "")
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", name, tt.want, w.Code)
+		}
+	}
+}
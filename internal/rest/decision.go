@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+	"github.com/gin-gonic/gin"
+)
+
+// DecisionChecker decides on requests under the configured policies.
+type DecisionChecker interface {
+	Check(ctx context.Context, policy, key string, cost int) (ratelimit.Decision, error)
+}
+
+// DecisionHandler serves the decision API, which lets services that cannot
+// run the middleware ask whether a request is within its limit.
+type DecisionHandler struct {
+	checker DecisionChecker
+}
+
+func NewDecisionHandler(checker DecisionChecker) *DecisionHandler {
+	return &DecisionHandler{checker: checker}
+}
+
+// checkRequest asks for a decision on a request costing Cost units, one when
+// left out, from Key under Policy. Cost is capped like the middleware's
+// weighted requests, at middleware.DefaultMaxCost.
+type checkRequest struct {
+	Policy string `json:"policy" binding:"required"`
+	Key    string `json:"key" binding:"required"`
+	Cost   int    `json:"cost"`
+}
+
+// checkResponse is the decision. Durations are in milliseconds from now so
+// callers do not depend on their clock agreeing with this server's.
+type checkResponse struct {
+	Allowed      bool  `json:"allowed"`
+	Limit        int   `json:"limit"`
+	Remaining    int   `json:"remaining"`
+	ResetAfterMs int64 `json:"reset_after_ms"`
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// Check answers 200 with the decision whether or not the request is allowed;
+// other statuses mean no decision could be made.
+func (h *DecisionHandler) Check(c *gin.Context) {
+	var req checkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request needs a policy and a key"})
+		return
+	}
+	if req.Cost == 0 {
+		req.Cost = 1
+	}
+	if req.Cost > middleware.DefaultMaxCost {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cost must not exceed %d", middleware.DefaultMaxCost)})
+		return
+	}
+
+	decision, err := h.checker.Check(c.Request.Context(), req.Policy, req.Key, req.Cost)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "request cancelled while waiting for rate limiter"})
+		return
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	resp := checkResponse{
+		Allowed:      decision.Allowed,
+		Limit:        decision.Limit,
+		Remaining:    decision.Remaining,
+		RetryAfterMs: decision.RetryAfter.Milliseconds(),
+	}
+	if !decision.ResetAt.IsZero() {
+		resp.ResetAfterMs = max(time.Until(decision.ResetAt).Milliseconds(), 0)
+	}
+	c.JSON(http.StatusOK, resp)
+}
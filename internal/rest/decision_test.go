@@ -0,0 +1,102 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rest"
+	"github.com/gin-gonic/gin"
+)
+
+type stubDecider struct {
+	decision ratelimit.Decision
+	err      error
+	policy   string
+	key      string
+	cost     int
+}
+
+func (s *stubDecider) Check(ctx context.Context, policy, key string, cost int) (ratelimit.Decision, error) {
+	s.policy, s.key, s.cost = policy, key, cost
+	return s.decision, s.err
+}
+
+func serveCheck(checker rest.DecisionChecker, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/ratelimit/check", rest.NewDecisionHandler(checker).Check)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/ratelimit/check", strings.NewReader(body)))
+	return w
+}
+
+func TestDecisionHandler_Check(t *testing.T) {
+	checker := &stubDecider{decision: ratelimit.Decision{
+		Allowed:    false,
+		Limit:      5,
+		Remaining:  0,
+		ResetAt:    time.Now().Add(10 * time.Second),
+		RetryAfter: 2 * time.Second,
+	}}
+	w := serveCheck(checker, `{"policy": "fw-apikey", "key": "alice", "cost": 3}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if checker.policy != "fw-apikey" || checker.key != "alice" || checker.cost != 3 {
+		t.Errorf("expected fw-apikey/alice/3, got %s/%s/%d", checker.policy, checker.key, checker.cost)
+	}
+
+	var got struct {
+		Allowed      bool  `json:"allowed"`
+		Limit        int   `json:"limit"`
+		Remaining    int   `json:"remaining"`
+		ResetAfterMs int64 `json:"reset_after_ms"`
+		RetryAfterMs int64 `json:"retry_after_ms"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Allowed || got.Limit != 5 || got.Remaining != 0 || got.RetryAfterMs != 2000 {
+		t.Errorf("unexpected decision %+v", got)
+	}
+	if got.ResetAfterMs < 9000 || got.ResetAfterMs > 10000 {
+		t.Errorf("expected reset in about 10s, got %dms", got.ResetAfterMs)
+	}
+}
+
+func TestDecisionHandler_Check_DefaultCost(t *testing.T) {
+	checker := &stubDecider{decision: ratelimit.Decision{Allowed: true}}
+	serveCheck(checker, `{"policy": "fw-apikey", "key": "alice"}`)
+	if checker.cost != 1 {
+		t.Errorf("expected a cost of 1, got %d", checker.cost)
+	}
+}
+
+func TestDecisionHandler_Check_Errors(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		err  error
+		want int
+	}{
+		"missing key":    {`{"policy": "fw-apikey"}`, nil, http.StatusBadRequest},
+		"unknown policy": {`{"policy": "nope", "key": "a"}`, domain.NewError(domain.ErrNotFound, "unknown policy"), http.StatusNotFound},
+		"invalid cost":   {`{"policy": "fw-apikey", "key": "a", "cost": -1}`, domain.NewError(domain.ErrInvalidArgument, "bad cost"), http.StatusBadRequest},
+		"cost above max": {`{"policy": "fw-apikey", "key": "a", "cost": 1001}`, nil, http.StatusBadRequest},
+		"store failure":  {`{"policy": "fw-apikey", "key": "a"}`, errors.New("redis down"), http.StatusInternalServerError},
+		"cancelled":      {`{"policy": "lb-apikey", "key": "a"}`, context.Canceled, http.StatusServiceUnavailable},
+	}
+	for name, tt := range tests {
+		if w := serveCheck(&stubDecider{err: tt.err}, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", name, tt.want, w.Code)
+		}
+	}
+}
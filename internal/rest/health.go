@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds how long a readiness check waits for its dependencies.
+const readyTimeout = 2 * time.Second
+
+// DependencyChecker checks the dependencies the server needs to serve
+// requests and returns the outcome of each by name.
+type DependencyChecker interface {
+	Ping(ctx context.Context) map[string]error
+}
+
+// CriticalChecker tells the dependencies without which requests fail from
+// those whose failure the limiters work around.
+type CriticalChecker interface {
+	Critical(name string) bool
+}
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	deps     DependencyChecker
+	critical CriticalChecker
+}
+
+func NewHealthHandler(deps DependencyChecker, critical CriticalChecker) *HealthHandler {
+	return &HealthHandler{deps: deps, critical: critical}
+}
+
+// Healthz reports that the process is up. It checks nothing else, so a store
+// outage does not get the server restarted.
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz checks every dependency and answers 503 when a critical one fails,
+// so the instance is taken out of rotation until it recovers. Other failures
+// answer 200 as degraded: taking every instance out for an outage they serve
+// through would turn it into a full one.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	status, code := "ready", http.StatusOK
+	checks := make(map[string]string)
+	for name, err := range h.deps.Ping(ctx) {
+		if err == nil {
+			checks[name] = "ok"
+			continue
+		}
+		checks[name] = err.Error()
+		if h.critical.Critical(name) {
+			status, code = "not ready", http.StatusServiceUnavailable
+		} else if code == http.StatusOK {
+			status = "degraded"
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
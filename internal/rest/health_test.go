@@ -0,0 +1,86 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rest"
+	"github.com/gin-gonic/gin"
+)
+
+type stubChecker map[string]error
+
+func (s stubChecker) Ping(ctx context.Context) map[string]error {
+	return s
+}
+
+// stubCritical names the critical dependencies.
+type stubCritical map[string]bool
+
+func (s stubCritical) Critical(name string) bool {
+	return s[name]
+}
+
+func serveHealth(deps rest.DependencyChecker, path string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := rest.NewHealthHandler(deps, stubCritical{"redis/db1": true})
+	r := gin.New()
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHealthHandler_Healthz(t *testing.T) {
+	w := serveHealth(stubChecker{"redis/db0": errors.New("connection refused")}, "/healthz")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 regardless of dependencies, got %d", w.Code)
+	}
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	down := errors.New("connection refused")
+	tests := map[string]struct {
+		deps   stubChecker
+		want   int
+		status string
+	}{
+		"no dependencies":          {stubChecker{}, http.StatusOK, "ready"},
+		"all reachable":            {stubChecker{"redis/db0": nil, "redis/db1": nil}, http.StatusOK, "ready"},
+		"critical unreachable":     {stubChecker{"redis/db0": nil, "redis/db1": down}, http.StatusServiceUnavailable, "not ready"},
+		"non-critical unreachable": {stubChecker{"redis/db0": down, "redis/db1": nil}, http.StatusOK, "degraded"},
+		"both unreachable":         {stubChecker{"redis/db0": down, "redis/db1": down}, http.StatusServiceUnavailable, "not ready"},
+	}
+	for name, tt := range tests {
+		w := serveHealth(tt.deps, "/readyz")
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", name, tt.want, w.Code)
+		}
+
+		var body struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if body.Status != tt.status {
+			t.Errorf("%s: expected status %q, got %q", name, tt.status, body.Status)
+		}
+		for dep, err := range tt.deps {
+			want := "ok"
+			if err != nil {
+				want = err.Error()
+			}
+			if body.Checks[dep] != want {
+				t.Errorf("%s: expected %s to report %q, got %q", name, dep, want, body.Checks[dep])
+			}
+		}
+	}
+}
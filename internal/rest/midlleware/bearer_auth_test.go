@@ -0,0 +1,39 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBearerAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin", middleware.BearerAuth("secret"), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	tests := map[string]struct {
+		authorization string
+		want          int
+	}{
+		"valid token":   {"Bearer secret", http.StatusOK},
+		"wrong token":   {"Bearer guess", http.StatusUnauthorized},
+		"not a bearer":  {"Basic secret", http.StatusUnauthorized},
+		"missing token": {"", http.StatusUnauthorized},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", name, tt.want, w.Code)
+		}
+	}
+}
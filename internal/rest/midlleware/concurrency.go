@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context, clientID string) (release func(context.Context) error, acquired bool, err error)
+}
+
+// ConcurrencyLimit holds one of the client's slots while the request runs.
+// Of the options, only WithFailOpen and WithConcurrencyFallback apply.
+func ConcurrencyLimit(limiter ConcurrencyLimiter, keyFunc func(*gin.Context) string, opts ...Option) gin.HandlerFunc {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(c *gin.Context) {
+		clientID := keyFunc(c)
+		if clientID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing key"})
+			c.Abort()
+			return
+		}
+
+		release, acquired, err := limiter.Acquire(c.Request.Context(), clientID)
+		if err != nil && !cancelled(err) && o.concurrencyFallback != nil {
+			release, acquired, err = o.concurrencyFallback.Acquire(c.Request.Context(), clientID)
+		}
+		if cancelled(err) {
+			// The client went away; that is no reason to fall back or let
+			// anything through.
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "request cancelled while acquiring concurrency slot"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			if o.failOpen {
+				log.Printf("concurrency limiter failed for %q, letting the request through: %v", clientID, err)
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal concurrency limiter error"})
+			c.Abort()
+			return
+		}
+
+		if !acquired {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many concurrent requests"})
+			c.Abort()
+			return
+		}
+
+		defer func() {
+			// The request context may already be cancelled, but the slot still
+			// has to be given back.
+			if err := release(context.WithoutCancel(c.Request.Context())); err != nil {
+				log.Printf("failed to release concurrency slot for %q: %v", clientID, err)
+			}
+		}()
+
+		c.Next()
+	}
+}
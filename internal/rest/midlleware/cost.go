@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CostFunc returns how many units of the limit a request uses. A result below
+// one is answered with 400 Bad Request.
+type CostFunc func(*gin.Context) int
+
+// WithCost makes RateLimit charge each request what cost returns instead of a
+// single unit.
+func WithCost(cost CostFunc) Option {
+	return func(o *options) {
+		o.cost = cost
+	}
+}
+
+// FixedCost charges every request on the route n units, for endpoints that are
+// always more expensive than the rest.
+func FixedCost(n int) CostFunc {
+	return func(*gin.Context) int {
+		return n
+	}
+}
+
+// DefaultMaxCost caps the costs a client states itself, through a header or
+// the size of the body, when no other cap is configured.
+const DefaultMaxCost = 1000
+
+// HeaderCost reads the cost from the named request header. Requests without
+// the header cost one unit; values that are not positive integers, or that
+// exceed maxCost, are invalid.
+func HeaderCost(header string, maxCost int) CostFunc {
+	return func(c *gin.Context) int {
+		raw := c.GetHeader(header)
+		if raw == "" {
+			return 1
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n > maxCost {
+			return 0
+		}
+		return n
+	}
+}
+
+// BodySizeCost charges one unit per started bytesPerUnit of request body, and
+// at least one unit. Bodies costing more than maxCost are invalid. When the
+// client does not send Content-Length the body is read into memory to measure
+// it, up to the size maxCost allows, and then handed on unchanged.
+func BodySizeCost(bytesPerUnit int64, maxCost int) CostFunc {
+	maxSize := bytesPerUnit * int64(maxCost)
+	return func(c *gin.Context) int {
+		size := c.Request.ContentLength
+		if size < 0 {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSize+1))
+			if err != nil || int64(len(body)) > maxSize {
+				return 0
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			size = int64(len(body))
+		}
+		if size <= 0 {
+			return 1
+		}
+		if size > maxSize {
+			return 0
+		}
+		return int((size + bytesPerUnit - 1) / bytesPerUnit)
+	}
+}
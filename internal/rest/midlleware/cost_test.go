@@ -0,0 +1,137 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+)
+
+func TestRateLimit_DefaultCostIsOne(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+
+	serve(limiter)
+	if limiter.cost != 1 {
+		t.Errorf("expected cost 1, got %d", limiter.cost)
+	}
+}
+
+func TestRateLimit_FixedCost(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+
+	serve(limiter, middleware.WithCost(middleware.FixedCost(10)))
+	if limiter.cost != 10 {
+		t.Errorf("expected cost 10, got %d", limiter.cost)
+	}
+}
+
+func TestRateLimit_HeaderCost(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+	cost := middleware.WithCost(middleware.HeaderCost("X-Request-Cost", middleware.DefaultMaxCost))
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("X-Request-Cost", "4")
+	serveRequest(limiter, req, cost)
+	if limiter.cost != 4 {
+		t.Errorf("expected cost 4 from header, got %d", limiter.cost)
+	}
+
+	serve(limiter, cost)
+	if limiter.cost != 1 {
+		t.Errorf("expected cost 1 without header, got %d", limiter.cost)
+	}
+}
+
+func TestRateLimit_InvalidCost(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("X-Request-Cost", "lots")
+	w := serveRequest(limiter, req, middleware.WithCost(middleware.HeaderCost("X-Request-Cost", middleware.DefaultMaxCost)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if limiter.calls != 0 {
+		t.Error("expected the limiter not to be consulted")
+	}
+}
+
+func TestRateLimit_BodySizeCost(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+	cost := middleware.WithCost(middleware.BodySizeCost(1024, middleware.DefaultMaxCost))
+
+	req := httptest.NewRequest(http.MethodPost, "/ping", strings.NewReader(strings.Repeat("x", 2500)))
+	serveRequest(limiter, req, cost)
+	if limiter.cost != 3 {
+		t.Errorf("expected 2500 bytes to cost 3, got %d", limiter.cost)
+	}
+
+	serveRequest(limiter, httptest.NewRequest(http.MethodPost, "/ping", nil), cost)
+	if limiter.cost != 1 {
+		t.Errorf("expected an empty body to cost 1, got %d", limiter.cost)
+	}
+}
+
+func TestRateLimit_BodySizeCost_UnknownLength(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+
+	req := httptest.NewRequest(http.MethodPost, "/ping", io.NopCloser(strings.NewReader(strings.Repeat("x", 2048))))
+	req.ContentLength = -1
+	serveRequest(limiter, req, middleware.WithCost(middleware.BodySizeCost(1024, middleware.DefaultMaxCost)))
+	if limiter.cost != 2 {
+		t.Errorf("expected streamed body to cost 2, got %d", limiter.cost)
+	}
+}
+
+func TestRateLimit_HeaderCostAboveMax(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("X-Request-Cost", "9223372036854775807")
+	w := serveRequest(limiter, req, middleware.WithCost(middleware.HeaderCost("X-Request-Cost", 10)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if limiter.calls != 0 {
+		t.Error("expected the limiter not to be consulted")
+	}
+}
+
+func TestRateLimit_BodySizeCostAboveMax(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+	cost := middleware.WithCost(middleware.BodySizeCost(1024, 2))
+
+	req := httptest.NewRequest(http.MethodPost, "/ping", strings.NewReader(strings.Repeat("x", 2049)))
+	if w := serveRequest(limiter, req, cost); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a body above the max, got %d", w.Code)
+	}
+
+	body := &countingReader{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+	req = httptest.NewRequest(http.MethodPost, "/ping", io.NopCloser(body))
+	req.ContentLength = -1
+	if w := serveRequest(limiter, req, cost); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a streamed body above the max, got %d", w.Code)
+	}
+	if body.n > 2049 {
+		t.Errorf("expected at most 2049 bytes read from the streamed body, read %d", body.n)
+	}
+	if limiter.calls != 0 {
+		t.Error("expected the limiter not to be consulted")
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
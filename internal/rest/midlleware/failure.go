@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+)
+
+// By default a limiter error is answered with 500 and the request is not
+// served, so a broken store blocks every route it guards. The options below
+// pick another behaviour per route.
+
+// WithFailOpen makes RateLimit and ConcurrencyLimit serve the request, and log
+// the error, when the limiter fails. It applies after any fallback.
+func WithFailOpen() Option {
+	return func(o *options) {
+		o.failOpen = true
+	}
+}
+
+// WithFallback makes RateLimit decide with fallback, typically a limiter with
+// the same limits kept in memory, when the limiter fails.
+func WithFallback(fallback RateLimiter) Option {
+	return func(o *options) {
+		o.fallback = fallback
+	}
+}
+
+// WithConcurrencyFallback is WithFallback for ConcurrencyLimit.
+func WithConcurrencyFallback(fallback ConcurrencyLimiter) Option {
+	return func(o *options) {
+		o.concurrencyFallback = fallback
+	}
+}
+
+// cancelled reports whether err comes from the request giving up rather than
+// from the limiter failing.
+func cancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimit_FailOpen(t *testing.T) {
+	w := serve(&stubRateLimiter{err: errors.New("redis down")}, middleware.WithFailOpen())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("expected no rate limit headers without a decision, got %q", got)
+	}
+}
+
+func TestRateLimit_FailOpen_KeepsCancellation(t *testing.T) {
+	w := serve(&stubRateLimiter{err: context.Canceled}, middleware.WithFailOpen())
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_Fallback(t *testing.T) {
+	fallback := &stubRateLimiter{decision: ratelimit.Decision{Allowed: false, Limit: 5}}
+	w := serve(&stubRateLimiter{err: errors.New("redis down")}, middleware.WithFallback(fallback))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the fallback's 429, got %d", w.Code)
+	}
+	if fallback.calls != 1 {
+		t.Errorf("expected the fallback to be asked once, got %d", fallback.calls)
+	}
+
+	fallback = &stubRateLimiter{}
+	serve(&stubRateLimiter{decision: ratelimit.Decision{Allowed: true}}, middleware.WithFallback(fallback))
+	if fallback.calls != 0 {
+		t.Errorf("expected the fallback not to be asked while the limiter works")
+	}
+}
+
+func TestRateLimit_FallbackFails(t *testing.T) {
+	fallback := &stubRateLimiter{err: errors.New("also down")}
+	w := serve(&stubRateLimiter{err: errors.New("redis down")}, middleware.WithFallback(fallback))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
+
+type stubConcurrencyLimiter struct {
+	acquired bool
+	err      error
+}
+
+func (s stubConcurrencyLimiter) Acquire(ctx context.Context, clientID string) (func(context.Context) error, bool, error) {
+	release := func(context.Context) error { return nil }
+	return release, s.acquired, s.err
+}
+
+func serveConcurrency(limiter middleware.ConcurrencyLimiter, opts ...middleware.Option) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", middleware.ConcurrencyLimit(limiter, func(c *gin.Context) string {
+		return "client1"
+	}, opts...), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	return w.Code
+}
+
+func TestConcurrencyLimit_FailureModes(t *testing.T) {
+	down := stubConcurrencyLimiter{err: errors.New("redis down")}
+	tests := map[string]struct {
+		opts []middleware.Option
+		want int
+	}{
+		"fail closed": {nil, http.StatusInternalServerError},
+		"fail open":   {[]middleware.Option{middleware.WithFailOpen()}, http.StatusOK},
+		"fallback":    {[]middleware.Option{middleware.WithConcurrencyFallback(stubConcurrencyLimiter{})}, http.StatusTooManyRequests},
+	}
+	for name, tt := range tests {
+		if got := serveConcurrency(down, tt.opts...); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", name, tt.want, got)
+		}
+	}
+}
+
+func TestConcurrencyLimit_KeepsCancellation(t *testing.T) {
+	// Neither the fallback, which would admit the request, nor fail-open may
+	// serve a request whose context is gone.
+	got := serveConcurrency(stubConcurrencyLimiter{err: context.Canceled},
+		middleware.WithFailOpen(), middleware.WithConcurrencyFallback(stubConcurrencyLimiter{acquired: true}))
+	if got != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", got)
+	}
+}
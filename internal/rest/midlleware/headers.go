@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderStyle selects how the quota of a decision is reported to clients.
+type HeaderStyle string
+
+const (
+	// HeaderStyleIETF writes RateLimit-Limit, RateLimit-Remaining and
+	// RateLimit-Reset, the reset being in seconds from now.
+	HeaderStyleIETF HeaderStyle = "ietf"
+	// HeaderStyleCombined writes the structured RateLimit and RateLimit-Policy
+	// fields from the later IETF drafts.
+	HeaderStyleCombined HeaderStyle = "combined"
+	// HeaderStyleLegacy writes X-RateLimit-Limit, X-RateLimit-Remaining and
+	// X-RateLimit-Reset, the reset being a unix timestamp in seconds.
+	HeaderStyleLegacy HeaderStyle = "legacy"
+)
+
+// defaultPolicyName names the quota in the combined style when the route was
+// not given a policy name with WithPolicyName.
+const defaultPolicyName = "default"
+
+// ParseHeaderStyle validates a header style read from configuration. An empty
+// value selects HeaderStyleIETF.
+func ParseHeaderStyle(s string) (HeaderStyle, error) {
+	switch style := HeaderStyle(s); style {
+	case "":
+		return HeaderStyleIETF, nil
+	case HeaderStyleIETF, HeaderStyleCombined, HeaderStyleLegacy:
+		return style, nil
+	default:
+		return "", domain.NewError(domain.ErrInvalidArgument, "unknown rate limit header style %q", s)
+	}
+}
+
+// writeRateLimitHeaders reports the client's quota in the given style and, when
+// the request was rejected, adds Retry-After. The policy name is only part of
+// the combined style.
+func writeRateLimitHeaders(c *gin.Context, style HeaderStyle, policy string, decision ratelimit.Decision, now time.Time) {
+	limit := strconv.Itoa(decision.Limit)
+	remaining := strconv.Itoa(decision.Remaining)
+	reset := ceilSeconds(decision.ResetAt.Sub(now))
+
+	switch style {
+	case HeaderStyleCombined:
+		c.Header("RateLimit-Policy", fmt.Sprintf("%q;q=%d", policy, decision.Limit))
+		c.Header("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, decision.Remaining, reset))
+	case HeaderStyleLegacy:
+		c.Header("X-RateLimit-Limit", limit)
+		c.Header("X-RateLimit-Remaining", remaining)
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(now.Unix()+reset, 10))
+	default:
+		c.Header("RateLimit-Limit", limit)
+		c.Header("RateLimit-Remaining", remaining)
+		c.Header("RateLimit-Reset", strconv.FormatInt(reset, 10))
+	}
+
+	if !decision.Allowed {
+		// Retry-After only takes whole seconds; rounding down would send the
+		// client back too early, so never advertise less than one second.
+		c.Header("Retry-After", strconv.FormatInt(max(1, ceilSeconds(decision.RetryAfter)), 10))
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, treating negative durations as zero.
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
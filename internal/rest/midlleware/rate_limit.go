@@ -2,16 +2,52 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
 type RateLimiter interface {
-	Allow(ctx context.Context, clientID string) (bool, error)
+	DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error)
 }
 
-func RateLimit(rateLimiter RateLimiter, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+// Option customises the RateLimit middleware.
+type Option func(*options)
+
+type options struct {
+	headerStyle         HeaderStyle
+	policyName          string
+	cost                CostFunc
+	failOpen            bool
+	fallback            RateLimiter
+	concurrencyFallback ConcurrencyLimiter
+}
+
+// WithHeaderStyle picks the headers used to report the client's quota. The
+// default is HeaderStyleIETF.
+func WithHeaderStyle(style HeaderStyle) Option {
+	return func(o *options) {
+		o.headerStyle = style
+	}
+}
+
+// WithPolicyName names the quota reported in the combined header style. The
+// default is "default".
+func WithPolicyName(name string) Option {
+	return func(o *options) {
+		o.policyName = name
+	}
+}
+
+func RateLimit(rateLimiter RateLimiter, keyFunc func(*gin.Context) string, opts ...Option) gin.HandlerFunc {
+	o := options{headerStyle: HeaderStyleIETF, policyName: defaultPolicyName, cost: FixedCost(1)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return func(c *gin.Context) {
 		clientID := keyFunc(c)
 		if clientID == "" {
@@ -20,14 +56,37 @@ func RateLimit(rateLimiter RateLimiter, keyFunc func(*gin.Context) string) gin.H
 			return
 		}
 
-		allowed, err := rateLimiter.Allow(c.Request.Context(), clientID)
+		cost := o.cost(c)
+		if cost < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request cost"})
+			c.Abort()
+			return
+		}
+
+		decision, err := rateLimiter.DecideN(c.Request.Context(), clientID, cost)
+		if err != nil && !cancelled(err) && o.fallback != nil {
+			decision, err = o.fallback.DecideN(c.Request.Context(), clientID, cost)
+		}
+		if cancelled(err) {
+			// Queueing limiters give up when the request is cancelled while waiting.
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "request cancelled while waiting for rate limiter"})
+			c.Abort()
+			return
+		}
 		if err != nil {
+			if o.failOpen {
+				log.Printf("rate limiter failed for %q, letting the request through: %v", clientID, err)
+				c.Next()
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal rate limiter error"})
 			c.Abort()
 			return
 		}
 
-		if !allowed {
+		writeRateLimitHeaders(c, o.headerStyle, o.policyName, decision, time.Now())
+
+		if !decision.Allowed {
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
 			c.Abort()
 			return
@@ -0,0 +1,185 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	middleware "github.com/daverussell13/rate-limiter-doitpay-project/internal/rest/midlleware"
+	"github.com/gin-gonic/gin"
+)
+
+type stubRateLimiter struct {
+	decision ratelimit.Decision
+	err      error
+	calls    int
+	cost     int
+}
+
+func (s *stubRateLimiter) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	s.calls++
+	s.cost = n
+	return s.decision, s.err
+}
+
+func serve(limiter middleware.RateLimiter, opts ...middleware.Option) *httptest.ResponseRecorder {
+	return serveRequest(limiter, httptest.NewRequest(http.MethodGet, "/ping", nil), opts...)
+}
+
+func serveRequest(limiter middleware.RateLimiter, req *http.Request, opts ...middleware.Option) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Any("/ping", middleware.RateLimit(limiter, func(c *gin.Context) string {
+		return c.GetHeader("X-API-Key")
+	}, opts...), func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	req.Header.Set("X-API-Key", "client1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_Allowed_WritesIETFHeaders(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{
+		Allowed:   true,
+		Limit:     5,
+		Remaining: 3,
+		ResetAt:   time.Now().Add(30 * time.Second),
+	}}
+
+	w := serve(limiter)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "5" {
+		t.Errorf("expected RateLimit-Limit=5, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "3" {
+		t.Errorf("expected RateLimit-Remaining=3, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit-Reset"); got != "30" {
+		t.Errorf("expected RateLimit-Reset=30, got %q", got)
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("expected no Retry-After on success, got %q", got)
+	}
+}
+
+func TestRateLimit_Rejected_WritesRetryAfter(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{
+		Limit:      5,
+		ResetAt:    time.Now().Add(10 * time.Second),
+		RetryAfter: 1500 * time.Millisecond,
+	}}
+
+	w := serve(limiter)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After rounded up to 2, got %q", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("expected RateLimit-Remaining=0, got %q", got)
+	}
+}
+
+func TestRateLimit_Rejected_RetryAfterAtLeastOneSecond(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{Limit: 5, RetryAfter: 10 * time.Millisecond}}
+
+	w := serve(limiter)
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After=1, got %q", got)
+	}
+}
+
+func TestRateLimit_CombinedHeaderStyle(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{
+		Allowed:   true,
+		Limit:     5,
+		Remaining: 4,
+		ResetAt:   time.Now().Add(60 * time.Second),
+	}}
+
+	w := serve(limiter, middleware.WithHeaderStyle(middleware.HeaderStyleCombined))
+	if got := w.Header().Get("RateLimit-Policy"); got != `"default";q=5` {
+		t.Errorf("unexpected RateLimit-Policy %q", got)
+	}
+	if got := w.Header().Get("RateLimit"); got != `"default";r=4;t=60` {
+		t.Errorf("unexpected RateLimit %q", got)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("expected no RateLimit-Limit in combined style, got %q", got)
+	}
+}
+
+func TestRateLimit_CombinedHeaderStyle_PolicyName(t *testing.T) {
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{
+		Allowed:   true,
+		Limit:     5,
+		Remaining: 4,
+		ResetAt:   time.Now().Add(60 * time.Second),
+	}}
+
+	w := serve(limiter, middleware.WithHeaderStyle(middleware.HeaderStyleCombined), middleware.WithPolicyName("fw-apikey"))
+	if got := w.Header().Get("RateLimit-Policy"); got != `"fw-apikey";q=5` {
+		t.Errorf("unexpected RateLimit-Policy %q", got)
+	}
+	if got := w.Header().Get("RateLimit"); got != `"fw-apikey";r=4;t=60` {
+		t.Errorf("unexpected RateLimit %q", got)
+	}
+}
+
+func TestRateLimit_LegacyHeaderStyle(t *testing.T) {
+	reset := time.Now().Add(45 * time.Second)
+	limiter := &stubRateLimiter{decision: ratelimit.Decision{
+		Allowed:   true,
+		Limit:     5,
+		Remaining: 2,
+		ResetAt:   reset,
+	}}
+
+	w := serve(limiter, middleware.WithHeaderStyle(middleware.HeaderStyleLegacy))
+	if got := w.Header().Get("X-RateLimit-Limit"); got != "5" {
+		t.Errorf("expected X-RateLimit-Limit=5, got %q", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "2" {
+		t.Errorf("expected X-RateLimit-Remaining=2, got %q", got)
+	}
+	got, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || got < reset.Unix() || got > reset.Unix()+1 {
+		t.Errorf("expected X-RateLimit-Reset near %d, got %q", reset.Unix(), w.Header().Get("X-RateLimit-Reset"))
+	}
+	if w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("expected no IETF headers in legacy style")
+	}
+}
+
+func TestRateLimit_Error_NoHeaders(t *testing.T) {
+	w := serve(&stubRateLimiter{err: errors.New("boom")})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("expected no rate limit headers on error, got %q", got)
+	}
+}
+
+func TestParseHeaderStyle(t *testing.T) {
+	if style, err := middleware.ParseHeaderStyle(""); err != nil || style != middleware.HeaderStyleIETF {
+		t.Errorf("expected empty style to default to ietf, got %q, %v", style, err)
+	}
+	if style, err := middleware.ParseHeaderStyle("legacy"); err != nil || style != middleware.HeaderStyleLegacy {
+		t.Errorf("expected legacy, got %q, %v", style, err)
+	}
+	if _, err := middleware.ParseHeaderStyle("fancy"); err == nil {
+		t.Error("expected error for unknown style")
+	}
+}
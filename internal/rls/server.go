@@ -0,0 +1,149 @@
+// Package rls serves the policies to Envoy over its global rate limit service
+// API, envoy.service.ratelimit.v3.RateLimitService.
+package rls
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// DecisionChecker decides on requests under the configured policies.
+type DecisionChecker interface {
+	Check(ctx context.Context, policy, key string, cost int) (ratelimit.Decision, error)
+}
+
+// Server answers ShouldRateLimit by sending each descriptor through the
+// policy taking its entry keys.
+type Server struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+
+	domain  string
+	checker DecisionChecker
+	// policies maps the entry keys of a descriptor, joined with dots, to the
+	// policy limiting it.
+	policies map[string]string
+}
+
+func NewServer(cfg config.RLS, policies []config.Policy, checker DecisionChecker) *Server {
+	s := &Server{
+		domain:   cfg.Domain,
+		checker:  checker,
+		policies: make(map[string]string),
+	}
+	for _, p := range policies {
+		if p.Key.Source == config.KeySourceDescriptor {
+			s.policies[p.Key.Name] = p.Name
+		}
+	}
+	return s
+}
+
+// ShouldRateLimit is over limit when any descriptor is. Descriptors no policy
+// takes are left unlimited, like lyft/ratelimit does. A descriptor's limit
+// override is ignored: limits only come from the config. When a store fails
+// under a fail-closed policy the call fails with Unavailable, leaving the
+// outcome to Envoy's failure_mode_deny.
+func (s *Server) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if s.domain != "" && req.GetDomain() != s.domain {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown domain %q", req.GetDomain())
+	}
+	if len(req.GetDescriptors()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no descriptors")
+	}
+
+	hits := max(int(req.GetHitsAddend()), 1)
+	resp := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+		Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors())),
+	}
+	for _, d := range req.GetDescriptors() {
+		policy, key, ok := s.match(d)
+		if !ok {
+			resp.Statuses = append(resp.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK})
+			continue
+		}
+
+		cost := hits
+		if v := d.GetHitsAddend().GetValue(); v > 0 {
+			cost = int(min(v, math.MaxInt32))
+		}
+		decision, err := s.checker.Check(ctx, policy, key, cost)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+
+		st := descriptorStatus(policy, decision)
+		if st.Code == rlsv3.RateLimitResponse_OVER_LIMIT {
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		resp.Statuses = append(resp.Statuses, st)
+	}
+	return resp, nil
+}
+
+// match returns the policy taking a descriptor and the client key it carries,
+// the values of its entries joined with colons.
+func (s *Server) match(d *ratelimitv3.RateLimitDescriptor) (policy, key string, ok bool) {
+	entries := d.GetEntries()
+	if len(entries) == 0 {
+		return "", "", false
+	}
+	keys := make([]string, len(entries))
+	values := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i], values[i] = e.GetKey(), e.GetValue()
+	}
+	policy, ok = s.policies[strings.Join(keys, ".")]
+	return policy, strings.Join(values, ":"), ok
+}
+
+// descriptorStatus reports a decision. The unit of the limit is left unknown
+// because Limit is a burst size rather than a count per time unit for most
+// algorithms.
+func descriptorStatus(policy string, d ratelimit.Decision) *rlsv3.RateLimitResponse_DescriptorStatus {
+	st := &rlsv3.RateLimitResponse_DescriptorStatus{
+		Code: rlsv3.RateLimitResponse_OK,
+		CurrentLimit: &rlsv3.RateLimitResponse_RateLimit{
+			Name:            policy,
+			RequestsPerUnit: uint32(max(d.Limit, 0)),
+			Unit:            rlsv3.RateLimitResponse_RateLimit_UNKNOWN,
+		},
+		LimitRemaining: uint32(max(d.Remaining, 0)),
+	}
+	if !d.Allowed {
+		st.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+	}
+	if !d.ResetAt.IsZero() {
+		st.DurationUntilReset = durationpb.New(max(time.Until(d.ResetAt), 0))
+	}
+	return st
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	var e *domain.Error
+	if errors.As(err, &e) {
+		switch e.Code() {
+		case domain.ErrNotFound:
+			return status.Error(codes.NotFound, e.Message())
+		case domain.ErrInvalidArgument:
+			return status.Error(codes.InvalidArgument, e.Message())
+		}
+	}
+	return status.Errorf(codes.Unavailable, "rate limiter failed: %v", err)
+}
@@ -0,0 +1,162 @@
+package rls_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/policy"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rls"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var descriptorPolicies = []config.Policy{
+	{Name: "per-ip", Algorithm: config.AlgorithmFixedWindow, Key: config.PolicyKey{Source: config.KeySourceDescriptor, Name: "remote_address"}},
+	{Name: "per-route-ip", Algorithm: config.AlgorithmFixedWindow, Key: config.PolicyKey{Source: config.KeySourceDescriptor, Name: "generic_key.remote_address"}},
+}
+
+// newClient serves s on an in-memory listener and returns a client for it.
+func newClient(t *testing.T, s *rls.Server) rlsv3.RateLimitServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rlsv3.NewRateLimitServiceClient(conn)
+}
+
+func newPolicyClient(t *testing.T) rlsv3.RateLimitServiceClient {
+	t.Helper()
+
+	cfg := &config.Config{
+		Storage: config.Storage{FixedWindow: config.StorageMemory},
+		RateLimiter: config.RateLimiter{
+			FixedWindow: config.FixedWindow{MaxRequests: 2, TimeFrameMs: 60000},
+		},
+		Policies: descriptorPolicies,
+	}
+	set, err := policy.New(cfg, storage.NewFactory(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return newClient(t, rls.NewServer(config.RLS{Domain: "edge"}, cfg.Policies, set))
+}
+
+func descriptor(kv ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i < len(kv); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: kv[i], Value: kv[i+1]})
+	}
+	return d
+}
+
+func TestServer_ShouldRateLimit(t *testing.T) {
+	client := newPolicyClient(t)
+	ctx := context.Background()
+	req := &rlsv3.RateLimitRequest{
+		Domain:      "edge",
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", "10.0.0.1")},
+	}
+
+	resp, err := client.ShouldRateLimit(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.OverallCode != rlsv3.RateLimitResponse_OK || len(resp.Statuses) != 1 {
+		t.Fatalf("expected OK with one status, got %v", resp)
+	}
+	st := resp.Statuses[0]
+	if st.CurrentLimit.GetRequestsPerUnit() != 2 || st.CurrentLimit.GetName() != "per-ip" || st.LimitRemaining != 1 {
+		t.Errorf("expected 1 of 2 left under per-ip, got %v", st)
+	}
+	if d := st.DurationUntilReset.AsDuration(); d <= 0 || d > 60e9 {
+		t.Errorf("expected a reset within the window, got %s", d)
+	}
+
+	client.ShouldRateLimit(ctx, req)
+	resp, err = client.ShouldRateLimit(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT || resp.Statuses[0].Code != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Errorf("expected the third request over limit, got %v", resp)
+	}
+}
+
+func TestServer_ShouldRateLimit_Descriptors(t *testing.T) {
+	client := newPolicyClient(t)
+
+	// The request is over limit as a whole when one descriptor is, and
+	// descriptors no policy takes are not limited.
+	resp, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+		Domain:     "edge",
+		HitsAddend: 3,
+		Descriptors: []*ratelimitv3.RateLimitDescriptor{
+			descriptor("header_match", "internal"),
+			descriptor("generic_key", "checkout", "remote_address", "10.0.0.1"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT || len(resp.Statuses) != 2 {
+		t.Fatalf("expected OVER_LIMIT with two statuses, got %v", resp)
+	}
+	if st := resp.Statuses[0]; st.Code != rlsv3.RateLimitResponse_OK || st.CurrentLimit != nil {
+		t.Errorf("expected the unmatched descriptor to be unlimited, got %v", st)
+	}
+	if st := resp.Statuses[1]; st.Code != rlsv3.RateLimitResponse_OVER_LIMIT || st.CurrentLimit.GetName() != "per-route-ip" {
+		t.Errorf("expected per-route-ip to reject 3 hits, got %v", st)
+	}
+}
+
+type stubDecider struct {
+	err error
+}
+
+func (s stubDecider) Check(ctx context.Context, policy, key string, cost int) (ratelimit.Decision, error) {
+	return ratelimit.Decision{}, s.err
+}
+
+func TestServer_ShouldRateLimit_Errors(t *testing.T) {
+	tests := map[string]struct {
+		domain string
+		err    error
+		want   codes.Code
+	}{
+		"unknown domain": {"other", nil, codes.InvalidArgument},
+		"store failure":  {"edge", errors.New("redis down"), codes.Unavailable},
+		"cancelled":      {"edge", context.Canceled, codes.Canceled},
+	}
+	for name, tt := range tests {
+		client := newClient(t, rls.NewServer(config.RLS{Domain: "edge"}, descriptorPolicies, stubDecider{err: tt.err}))
+		_, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+			Domain:      tt.domain,
+			Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", "10.0.0.1")},
+		})
+		if code := status.Code(err); code != tt.want {
+			t.Errorf("%s: expected %v, got %v", name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+)
+
+// ConcurrencyRepository tracks the leases a client currently holds. Leases
+// expire on their own after ttl so slots held by a crashed instance come back.
+// Renew pushes the expiry of a lease still held to now plus ttl.
+type ConcurrencyRepository interface {
+	Acquire(ctx context.Context, clientID string, leaseID string, now time.Time, limit int, ttl time.Duration) (bool, error)
+	Renew(ctx context.Context, clientID string, leaseID string, now time.Time, ttl time.Duration) error
+	Release(ctx context.Context, clientID string, leaseID string) error
+}
+
+// ConcurrencyService caps how many requests per client run at the same time.
+type ConcurrencyService struct {
+	repo   ConcurrencyRepository
+	cfg    atomic.Pointer[config.Concurrency]
+	limits LimitSource[config.Concurrency]
+}
+
+func NewConcurrencyService(repo ConcurrencyRepository, cfg config.Concurrency) *ConcurrencyService {
+	s := &ConcurrencyService{
+		repo: repo,
+	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *ConcurrencyService) SetConfig(cfg config.Concurrency) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *ConcurrencyService) SetLimitSource(src LimitSource[config.Concurrency]) {
+	s.limits = src
+}
+
+// Acquire takes one of the client's MaxInFlight slots. When it succeeds the
+// caller must call release once the request is done. Until then the lease is
+// renewed every third of its TTL, so a request running longer than the TTL
+// keeps its slot; only a crashed instance stops renewing.
+func (s *ConcurrencyService) Acquire(ctx context.Context, clientID string) (release func(context.Context) error, acquired bool, err error) {
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return nil, false, err
+	}
+
+	leaseID := strconv.FormatUint(rand.Uint64(), 36)
+	ttl := time.Duration(cfg.LeaseTTLMs) * time.Millisecond
+
+	acquired, err = s.repo.Acquire(ctx, clientID, leaseID, time.Now(), cfg.MaxInFlight, ttl)
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+
+	// The lease outlives the context of the decision, which may end before
+	// the request does.
+	renewCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	go s.renew(renewCtx, clientID, leaseID, ttl)
+
+	release = func(ctx context.Context) error {
+		stop()
+		return s.repo.Release(ctx, clientID, leaseID)
+	}
+	return release, true, nil
+}
+
+// renew keeps a lease alive until ctx is cancelled. A failed renewal is
+// retried on the next tick; meanwhile the lease may run out.
+func (s *ConcurrencyService) renew(ctx context.Context, clientID, leaseID string, ttl time.Duration) {
+	ticker := time.NewTicker(max(ttl/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.repo.Renew(ctx, clientID, leaseID, time.Now(), ttl)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type mockConcurrencyRepo struct {
+	leases map[string]map[string]bool
+	ttl    time.Duration
+	renews atomic.Int32
+}
+
+func newConcurrencyMockRepo() *mockConcurrencyRepo {
+	return &mockConcurrencyRepo{leases: make(map[string]map[string]bool)}
+}
+
+func (m *mockConcurrencyRepo) Acquire(ctx context.Context, clientID string, leaseID string, now time.Time, limit int, ttl time.Duration) (bool, error) {
+	m.ttl = ttl
+	if len(m.leases[clientID]) >= limit {
+		return false, nil
+	}
+	if m.leases[clientID] == nil {
+		m.leases[clientID] = make(map[string]bool)
+	}
+	m.leases[clientID][leaseID] = true
+	return true, nil
+}
+
+func (m *mockConcurrencyRepo) Renew(ctx context.Context, clientID string, leaseID string, now time.Time, ttl time.Duration) error {
+	m.renews.Add(1)
+	return nil
+}
+
+func (m *mockConcurrencyRepo) Release(ctx context.Context, clientID string, leaseID string) error {
+	delete(m.leases[clientID], leaseID)
+	return nil
+}
+
+func TestConcurrencyService_Acquire(t *testing.T) {
+	repo := newConcurrencyMockRepo()
+	cfg := config.Concurrency{MaxInFlight: 2, LeaseTTLMs: 30000}
+	svc := service.NewConcurrencyService(repo, cfg)
+	clientID := "client1"
+	ctx := context.Background()
+
+	release1, ok, err := svc.Acquire(ctx, clientID)
+	if err != nil || !ok {
+		t.Fatal("expected first slot to be acquired")
+	}
+	if _, ok, _ := svc.Acquire(ctx, clientID); !ok {
+		t.Fatal("expected second slot to be acquired")
+	}
+	if repo.ttl != 30*time.Second {
+		t.Errorf("expected lease TTL 30s, got %v", repo.ttl)
+	}
+
+	release, ok, err := svc.Acquire(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok || release != nil {
+		t.Fatal("expected third slot to be refused")
+	}
+
+	if err := release1(ctx); err != nil {
+		t.Fatalf("unexpected error releasing slot: %v", err)
+	}
+	if _, ok, _ := svc.Acquire(ctx, clientID); !ok {
+		t.Error("expected slot to be free after release")
+	}
+}
+
+func TestConcurrencyService_RenewsLease(t *testing.T) {
+	repo := newConcurrencyMockRepo()
+	svc := service.NewConcurrencyService(repo, config.Concurrency{MaxInFlight: 1, LeaseTTLMs: 30})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release, ok, err := svc.Acquire(ctx, "client1")
+	if err != nil || !ok {
+		t.Fatal("expected the slot to be acquired")
+	}
+	// The lease outlives the context it was acquired with.
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if n := repo.renews.Load(); n < 3 {
+		t.Errorf("expected the lease to be renewed every 10ms while held, got %d renewals", n)
+	}
+
+	if err := release(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Let a renewal already past the check finish.
+	time.Sleep(20 * time.Millisecond)
+	n := repo.renews.Load()
+	time.Sleep(50 * time.Millisecond)
+	if got := repo.renews.Load(); got != n {
+		t.Errorf("expected no renewals after release, got %d more", got-n)
+	}
+}
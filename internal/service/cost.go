@@ -0,0 +1,23 @@
+package service
+
+import (
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+)
+
+// validateCost rejects request costs below one unit; a zero or negative cost
+// would let a request through without counting it.
+func validateCost(n int) error {
+	if n < 1 {
+		return domain.NewError(domain.ErrInvalidArgument, "request cost must be at least 1, got %d", n)
+	}
+	return nil
+}
+
+// tooExpensive is the decision for a request costing more than the client's
+// whole limit, which no amount of waiting lets through. Such requests are
+// rejected before the store is read, which also keeps a huge cost out of the
+// arithmetic on the stored state, where it would overflow.
+func tooExpensive(limit int) ratelimit.Decision {
+	return ratelimit.Decision{Allowed: false, Limit: limit}
+}
@@ -0,0 +1,66 @@
+package service_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type decider interface {
+	DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error)
+}
+
+func TestDecideN_CostAboveLimit(t *testing.T) {
+	tests := map[string]struct {
+		limiter decider
+		limit   int
+	}{
+		"fixed window": {
+			service.NewFixedWindowService(memory.NewFixedWindowRepository(), config.FixedWindow{MaxRequests: 5, TimeFrameMs: 60000}), 5,
+		},
+		"token bucket": {
+			service.NewTokenBucketService(memory.NewTokenBucketRepository(5, 1), config.TokenBucket{MaxTokens: 5, RefillRate: 1}), 5,
+		},
+		"sliding window log": {
+			service.NewSlidingWindowLogService(memory.NewSlidingWindowLogRepository(), config.SlidingWindowLog{MaxRequests: 5, TimeFrameMs: 60000}), 5,
+		},
+		"sliding window counter": {
+			service.NewSlidingWindowCounterService(memory.NewSlidingWindowCounterRepository(), config.SlidingWindowCounter{MaxRequests: 5, TimeFrameMs: 60000}), 5,
+		},
+		"gcra": {
+			service.NewGCRAService(memory.NewGCRARepository(), config.GCRA{Rate: 1, Burst: 5}), 5,
+		},
+		"leaky bucket": {
+			service.NewLeakyBucketService(memory.NewLeakyBucketRepository(), config.LeakyBucket{LeakRate: 1, Capacity: 5}), 5,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, n := range []int{tt.limit + 2, math.MaxInt / 2, math.MaxInt} {
+				d, err := tt.limiter.DecideN(ctx, "client", n)
+				if err != nil {
+					t.Fatalf("cost %d: unexpected error: %v", n, err)
+				}
+				if d.Allowed || d.Limit != tt.limit {
+					t.Errorf("cost %d: expected a rejection reporting limit %d, got %+v", n, tt.limit, d)
+				}
+			}
+
+			// The rejected costs must not have touched the client's quota.
+			d, err := tt.limiter.DecideN(ctx, "client", 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !d.Allowed {
+				t.Errorf("expected the next request to be allowed, got %+v", d)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
@@ -12,51 +13,164 @@ import (
 type FixedWindowRepository interface {
 	GetWindow(ctx context.Context, clientID string) (ratelimit.Window, error)
 	SaveWindow(ctx context.Context, clientID string, window ratelimit.Window) error
+	DeleteWindow(ctx context.Context, clientID string) error
+	// ListWindows returns the IDs of the clients starting with prefix that
+	// have a window.
+	ListWindows(ctx context.Context, prefix string) ([]string, error)
+}
+
+// AtomicFixedWindowRepository is implemented by repositories that can check and
+// increment a window as one operation on the store itself. The service prefers
+// it over GetWindow/SaveWindow because the striped mutex only guards a single
+// process.
+type AtomicFixedWindowRepository interface {
+	TakeWindow(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.Window, bool, error)
 }
 
 type FixedWindowService struct {
-	repo  FixedWindowRepository
-	cfg   config.FixedWindow
-	locks *util.StripedMutex
+	repo   FixedWindowRepository
+	atomic AtomicFixedWindowRepository
+	cfg    atomic.Pointer[config.FixedWindow]
+	limits LimitSource[config.FixedWindow]
+	locks  *util.StripedMutex
 }
 
 func NewFixedWindowService(repo FixedWindowRepository, cfg config.FixedWindow) *FixedWindowService {
-	return &FixedWindowService{
-		repo:  repo,
-		cfg:   cfg,
-		locks: util.NewStripedMutex(256),
+	atomicRepo, _ := repo.(AtomicFixedWindowRepository)
+	s := &FixedWindowService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
 	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *FixedWindowService) SetConfig(cfg config.FixedWindow) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *FixedWindowService) SetLimitSource(src LimitSource[config.FixedWindow]) {
+	s.limits = src
 }
 
 func (s *FixedWindowService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *FixedWindowService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide runs the check for clientID and reports what is left of the current
+// window and when it ends.
+func (s *FixedWindowService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that adds n to the window count.
+func (s *FixedWindowService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	if n > cfg.MaxRequests {
+		return tooExpensive(cfg.MaxRequests), nil
+	}
+
+	if s.atomic != nil {
+		now := time.Now()
+		window, allowed, err := s.atomic.TakeWindow(ctx, clientID, now, cfg.MaxRequests, s.timeFrame(cfg), n)
+		if err != nil {
+			return ratelimit.Decision{}, err
+		}
+		return s.decision(cfg, now, window, allowed), nil
+	}
+
 	unlock := s.locks.Lock(clientID)
 	defer unlock()
 
 	window, err := s.repo.GetWindow(ctx, clientID)
 	if err != nil {
-		return false, err
+		return ratelimit.Decision{}, err
 	}
 
 	now := time.Now()
 
 	if window.EndTime.IsZero() || now.After(window.EndTime) {
-		newWindow := ratelimit.Window{
-			Count:   1,
-			EndTime: now.Add(time.Duration(s.cfg.TimeFrameMs) * time.Millisecond),
-		}
-		if err := s.repo.SaveWindow(ctx, clientID, newWindow); err != nil {
-			return false, err
+		window = ratelimit.Window{Count: n, EndTime: now.Add(s.timeFrame(cfg))}
+		if err := s.repo.SaveWindow(ctx, clientID, window); err != nil {
+			return ratelimit.Decision{}, err
 		}
-		return true, nil
+		return s.decision(cfg, now, window, true), nil
 	}
 
-	if window.Count < s.cfg.MaxRequests {
-		window.Count++
+	if n <= cfg.MaxRequests-window.Count {
+		window.Count += n
 		if err := s.repo.SaveWindow(ctx, clientID, window); err != nil {
-			return false, err
+			return ratelimit.Decision{}, err
 		}
-		return true, nil
+		return s.decision(cfg, now, window, true), nil
+	}
+
+	return s.decision(cfg, now, window, false), nil
+}
+
+// Window returns the client's current window, or an empty one when its last
+// window has ended.
+func (s *FixedWindowService) Window(ctx context.Context, clientID string) (ratelimit.Window, error) {
+	window, err := s.repo.GetWindow(ctx, clientID)
+	if err != nil {
+		return ratelimit.Window{}, err
+	}
+	if !window.EndTime.IsZero() && time.Now().After(window.EndTime) {
+		return ratelimit.Window{}, nil
 	}
+	return window, nil
+}
+
+// Reset forgets the client's window, so its next request opens a new one.
+func (s *FixedWindowService) Reset(ctx context.Context, clientID string) error {
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	return s.repo.DeleteWindow(ctx, clientID)
+}
+
+// Clients returns the IDs of the clients starting with prefix that have a
+// window.
+func (s *FixedWindowService) Clients(ctx context.Context, prefix string) ([]string, error) {
+	return s.repo.ListWindows(ctx, prefix)
+}
+
+func (s *FixedWindowService) decision(cfg *config.FixedWindow, now time.Time, window ratelimit.Window, allowed bool) ratelimit.Decision {
+	d := ratelimit.Decision{
+		Allowed:   allowed,
+		Limit:     cfg.MaxRequests,
+		Remaining: max(0, cfg.MaxRequests-window.Count),
+		ResetAt:   window.EndTime,
+	}
+	if !allowed {
+		d.RetryAfter = window.EndTime.Sub(now)
+	}
+	return d
+}
 
-	return false, nil
+func (s *FixedWindowService) timeFrame(cfg *config.FixedWindow) time.Duration {
+	return time.Duration(cfg.TimeFrameMs) * time.Millisecond
 }
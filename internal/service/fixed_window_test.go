@@ -2,10 +2,14 @@ package service_test
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
 )
@@ -33,6 +37,22 @@ func (m *mockFixedWindowRepo) SaveWindow(ctx context.Context, clientID string, w
 	return nil
 }
 
+func (m *mockFixedWindowRepo) DeleteWindow(ctx context.Context, clientID string) error {
+	delete(m.storage, clientID)
+	return nil
+}
+
+func (m *mockFixedWindowRepo) ListWindows(ctx context.Context, prefix string) ([]string, error) {
+	var ids []string
+	for id := range m.storage {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
 func TestFixedWindowService_Allow(t *testing.T) {
 	repo := newFixedWindowMockRepo()
 	cfg := config.FixedWindow{MaxRequests: 2, TimeFrameMs: 1000}
@@ -96,3 +116,218 @@ func TestFixedWindowService_Allow_WindowExpired(t *testing.T) {
 		t.Error("expected request to be allowed after window expired")
 	}
 }
+
+type mockAtomicFixedWindowRepo struct {
+	*mockFixedWindowRepo
+	calls       int
+	maxRequests int
+	timeFrame   time.Duration
+	allowed     bool
+}
+
+func (m *mockAtomicFixedWindowRepo) TakeWindow(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.Window, bool, error) {
+	m.calls++
+	m.maxRequests = maxRequests
+	m.timeFrame = timeFrame
+	return ratelimit.Window{Count: 1, EndTime: now.Add(timeFrame)}, m.allowed, nil
+}
+
+func TestFixedWindowService_Allow_AtomicRepository(t *testing.T) {
+	repo := &mockAtomicFixedWindowRepo{mockFixedWindowRepo: newFixedWindowMockRepo(), allowed: true}
+	cfg := config.FixedWindow{MaxRequests: 3, TimeFrameMs: 1000}
+	svc := service.NewFixedWindowService(repo, cfg)
+
+	allowed, err := svc.Allow(context.Background(), "client4")
+	if err != nil || !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if repo.calls != 1 {
+		t.Errorf("expected TakeWindow to be called once, got %d", repo.calls)
+	}
+	if repo.maxRequests != 3 || repo.timeFrame != time.Second {
+		t.Errorf("expected limits 3/1s, got %d/%v", repo.maxRequests, repo.timeFrame)
+	}
+	if len(repo.storage) != 0 {
+		t.Error("expected GetWindow/SaveWindow not to be used")
+	}
+
+	repo.allowed = false
+	allowed, err = svc.Allow(context.Background(), "client4")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be denied")
+	}
+}
+
+func TestFixedWindowService_Decide_ReportsRemainingAndReset(t *testing.T) {
+	repo := newFixedWindowMockRepo()
+	cfg := config.FixedWindow{MaxRequests: 2, TimeFrameMs: 1000}
+	svc := service.NewFixedWindowService(repo, cfg)
+	clientID := "client-decide"
+	ctx := context.Background()
+
+	d, err := svc.Decide(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.Allowed || d.Limit != 2 || d.Remaining != 1 {
+		t.Fatalf("expected allowed with 1 of 2 remaining, got %+v", d)
+	}
+	if end := repo.storage[clientID].EndTime; !d.ResetAt.Equal(end) {
+		t.Errorf("expected reset at window end %v, got %v", end, d.ResetAt)
+	}
+
+	svc.Decide(ctx, clientID)
+	d, _ = svc.Decide(ctx, clientID)
+	if d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected third request to be denied with 0 remaining, got %+v", d)
+	}
+	if d.RetryAfter <= 0 || d.RetryAfter > time.Second {
+		t.Errorf("expected retry-after within the window, got %v", d.RetryAfter)
+	}
+}
+
+func TestFixedWindowService_AllowN(t *testing.T) {
+	repo := newFixedWindowMockRepo()
+	cfg := config.FixedWindow{MaxRequests: 5, TimeFrameMs: 1000}
+	svc := service.NewFixedWindowService(repo, cfg)
+	clientID := "client-weighted"
+	ctx := context.Background()
+
+	allowed, err := svc.AllowN(ctx, clientID, 3)
+	if err != nil || !allowed {
+		t.Fatal("expected request costing 3 to be allowed")
+	}
+	if got := repo.storage[clientID].Count; got != 3 {
+		t.Errorf("expected count 3, got %d", got)
+	}
+
+	allowed, _ = svc.AllowN(ctx, clientID, 3)
+	if allowed {
+		t.Error("expected second request costing 3 to be denied")
+	}
+	if got := repo.storage[clientID].Count; got != 3 {
+		t.Errorf("expected denied request not to be counted, got %d", got)
+	}
+
+	allowed, _ = svc.AllowN(ctx, clientID, 2)
+	if !allowed {
+		t.Error("expected request costing 2 to fill the window")
+	}
+}
+
+func TestFixedWindowService_AllowN_InvalidCost(t *testing.T) {
+	svc := service.NewFixedWindowService(newFixedWindowMockRepo(), config.FixedWindow{MaxRequests: 5, TimeFrameMs: 1000})
+
+	var domainErr *domain.Error
+	_, err := svc.AllowN(context.Background(), "client", 0)
+	if !errors.As(err, &domainErr) || domainErr.Code() != domain.ErrInvalidArgument {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
+
+func TestFixedWindowService_SetConfig(t *testing.T) {
+	repo := newFixedWindowMockRepo()
+	svc := service.NewFixedWindowService(repo, config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000})
+	ctx := context.Background()
+
+	if allowed, err := svc.Allow(ctx, "client1"); err != nil || !allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	if allowed, _ := svc.Allow(ctx, "client1"); allowed {
+		t.Fatal("expected second request to be denied")
+	}
+
+	svc.SetConfig(config.FixedWindow{MaxRequests: 3, TimeFrameMs: 60000})
+
+	decision, err := svc.Decide(ctx, "client1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decision.Allowed {
+		t.Error("expected request to be allowed after raising the limit")
+	}
+	if decision.Limit != 3 {
+		t.Errorf("expected limit 3, got %d", decision.Limit)
+	}
+}
+
+type stubFixedWindowLimits map[string]config.FixedWindow
+
+func (s stubFixedWindowLimits) Limits(ctx context.Context, clientID string) (config.FixedWindow, bool, error) {
+	if clientID == "broken" {
+		return config.FixedWindow{}, false, errors.New("lookup failed")
+	}
+	cfg, ok := s[clientID]
+	return cfg, ok, nil
+}
+
+func TestFixedWindowService_LimitSource(t *testing.T) {
+	repo := newFixedWindowMockRepo()
+	svc := service.NewFixedWindowService(repo, config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000})
+	svc.SetLimitSource(stubFixedWindowLimits{
+		"enterprise": {MaxRequests: 3, TimeFrameMs: 60000},
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		decision, err := svc.Decide(ctx, "enterprise")
+		if err != nil || !decision.Allowed {
+			t.Fatalf("request %d: expected enterprise client to be allowed, got %+v, %v", i+1, decision, err)
+		}
+		if decision.Limit != 3 {
+			t.Errorf("expected limit 3, got %d", decision.Limit)
+		}
+	}
+
+	if allowed, _ := svc.Allow(ctx, "free"); !allowed {
+		t.Fatal("expected first request of unknown client to be allowed")
+	}
+	if allowed, _ := svc.Allow(ctx, "free"); allowed {
+		t.Error("expected unknown client to get the service config")
+	}
+
+	if _, err := svc.Allow(ctx, "broken"); err == nil {
+		t.Error("expected lookup error to be returned")
+	}
+}
+
+func TestFixedWindowService_WindowAndReset(t *testing.T) {
+	repo := newFixedWindowMockRepo()
+	svc := service.NewFixedWindowService(repo, config.FixedWindow{MaxRequests: 5, TimeFrameMs: 60000})
+	ctx := context.Background()
+
+	for range 2 {
+		svc.Allow(ctx, "p:a")
+	}
+	svc.Allow(ctx, "p:b")
+	repo.storage["q:c"] = ratelimit.Window{Count: 5, EndTime: time.Now().Add(-time.Second)}
+
+	window, err := svc.Window(ctx, "p:a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if window.Count != 2 {
+		t.Fatalf("expected count 2, got %d", window.Count)
+	}
+	if window, _ := svc.Window(ctx, "q:c"); window.Count != 0 {
+		t.Fatalf("expected an ended window to read as empty, got %+v", window)
+	}
+
+	clients, err := svc.Clients(ctx, "p:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(clients, []string{"p:a", "p:b"}) {
+		t.Fatalf("expected clients [p:a p:b], got %v", clients)
+	}
+
+	if err := svc.Reset(ctx, "p:a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := repo.storage["p:a"]; ok {
+		t.Fatalf("expected window to be deleted")
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/util"
+)
+
+type GCRARepository interface {
+	GetTAT(ctx context.Context, clientID string) (ratelimit.GCRA, error)
+	SaveTAT(ctx context.Context, clientID string, state ratelimit.GCRA) error
+}
+
+// AtomicGCRARepository is implemented by repositories that can test and advance
+// the theoretical arrival time as one operation on the store itself. It returns
+// the new TAT when the request was allowed and the current one otherwise.
+type AtomicGCRARepository interface {
+	TakeTAT(ctx context.Context, clientID string, now time.Time, emissionInterval time.Duration, burst int, n int) (ratelimit.GCRA, bool, error)
+}
+
+// GCRAService implements the generic cell rate algorithm. Every request pushes
+// the client's theoretical arrival time (TAT) forward by one emission interval
+// (1/Rate), and a request is rejected while that would put the TAT more than
+// Burst intervals ahead of now.
+type GCRAService struct {
+	repo   GCRARepository
+	atomic AtomicGCRARepository
+	cfg    atomic.Pointer[config.GCRA]
+	limits LimitSource[config.GCRA]
+	locks  *util.StripedMutex
+}
+
+func NewGCRAService(repo GCRARepository, cfg config.GCRA) *GCRAService {
+	atomicRepo, _ := repo.(AtomicGCRARepository)
+	s := &GCRAService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
+	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *GCRAService) SetConfig(cfg config.GCRA) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *GCRAService) SetLimitSource(src LimitSource[config.GCRA]) {
+	s.limits = src
+}
+
+func (s *GCRAService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *GCRAService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide runs the check for clientID and reports the remaining burst together
+// with the exact reset and retry-after times derived from the TAT.
+func (s *GCRAService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that advances the TAT by n emission
+// intervals at once.
+func (s *GCRAService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	// A full burst of tolerance is all a request can ever spend at once.
+	if n > cfg.Burst {
+		return tooExpensive(cfg.Burst), nil
+	}
+
+	interval := s.emissionInterval(cfg)
+
+	if s.atomic != nil {
+		now := time.Now()
+		state, allowed, err := s.atomic.TakeTAT(ctx, clientID, now, interval, cfg.Burst, n)
+		if err != nil {
+			return ratelimit.Decision{}, err
+		}
+		return s.decision(cfg, now, state.TAT, allowed, n), nil
+	}
+
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	state, err := s.repo.GetTAT(ctx, clientID)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	now := time.Now()
+	tat := state.TAT
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(interval * time.Duration(n))
+	if newTAT.Add(-s.tolerance(cfg)).After(now) {
+		return s.decision(cfg, now, tat, false, n), nil
+	}
+
+	if err := s.repo.SaveTAT(ctx, clientID, ratelimit.GCRA{TAT: newTAT}); err != nil {
+		return ratelimit.Decision{}, err
+	}
+	return s.decision(cfg, now, newTAT, true, n), nil
+}
+
+func (s *GCRAService) decision(cfg *config.GCRA, now, tat time.Time, allowed bool, n int) ratelimit.Decision {
+	interval := s.emissionInterval(cfg)
+	d := ratelimit.Decision{
+		Allowed: allowed,
+		Limit:   cfg.Burst,
+		ResetAt: tat,
+	}
+
+	if allowed {
+		d.Remaining = int((now.Sub(tat) + s.tolerance(cfg)) / interval)
+		return d
+	}
+
+	d.RetryAfter = tat.Add(interval * time.Duration(n)).Add(-s.tolerance(cfg)).Sub(now)
+	return d
+}
+
+func (s *GCRAService) emissionInterval(cfg *config.GCRA) time.Duration {
+	return time.Duration(float64(time.Second) / cfg.Rate)
+}
+
+func (s *GCRAService) tolerance(cfg *config.GCRA) time.Duration {
+	return s.emissionInterval(cfg) * time.Duration(cfg.Burst)
+}
@@ -0,0 +1,168 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type mockGCRARepo struct {
+	storage map[string]ratelimit.GCRA
+}
+
+func newGCRAMockRepo() *mockGCRARepo {
+	return &mockGCRARepo{storage: make(map[string]ratelimit.GCRA)}
+}
+
+func (m *mockGCRARepo) GetTAT(ctx context.Context, clientID string) (ratelimit.GCRA, error) {
+	return m.storage[clientID], nil
+}
+
+func (m *mockGCRARepo) SaveTAT(ctx context.Context, clientID string, state ratelimit.GCRA) error {
+	m.storage[clientID] = state
+	return nil
+}
+
+func TestGCRAService_Allow_Burst(t *testing.T) {
+	repo := newGCRAMockRepo()
+	cfg := config.GCRA{Rate: 1, Burst: 3}
+	svc := service.NewGCRAService(repo, cfg)
+	clientID := "client1"
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, err := svc.Allow(ctx, clientID)
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d within burst to be allowed", i+1)
+		}
+	}
+
+	allowed, err := svc.Allow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request beyond burst to be denied")
+	}
+}
+
+func TestGCRAService_Decide_ReportsRemainingAndReset(t *testing.T) {
+	repo := newGCRAMockRepo()
+	cfg := config.GCRA{Rate: 10, Burst: 2}
+	svc := service.NewGCRAService(repo, cfg)
+	clientID := "client2"
+	ctx := context.Background()
+
+	before := time.Now()
+	d, err := svc.Decide(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.Allowed || d.Limit != 2 || d.Remaining != 1 {
+		t.Fatalf("expected allowed with 1 of 2 remaining, got %+v", d)
+	}
+	if d.RetryAfter != 0 {
+		t.Errorf("expected no retry-after when allowed, got %v", d.RetryAfter)
+	}
+	if reset := d.ResetAt.Sub(before); reset < 100*time.Millisecond || reset > 110*time.Millisecond {
+		t.Errorf("expected reset about one interval ahead, got %v", reset)
+	}
+
+	d, _ = svc.Decide(ctx, clientID)
+	if !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected allowed with 0 remaining, got %+v", d)
+	}
+
+	d, _ = svc.Decide(ctx, clientID)
+	if d.Allowed {
+		t.Fatal("expected third request to be denied")
+	}
+	if d.RetryAfter <= 0 || d.RetryAfter > 100*time.Millisecond {
+		t.Errorf("expected retry-after within one interval, got %v", d.RetryAfter)
+	}
+	if stored := repo.storage[clientID].TAT; !d.ResetAt.Equal(stored) {
+		t.Errorf("expected reset at stored TAT %v, got %v", stored, d.ResetAt)
+	}
+}
+
+func TestGCRAService_Allow_AfterEmissionInterval(t *testing.T) {
+	repo := newGCRAMockRepo()
+	cfg := config.GCRA{Rate: 1, Burst: 1}
+	svc := service.NewGCRAService(repo, cfg)
+	clientID := "client3"
+	ctx := context.Background()
+
+	if allowed, _ := svc.Allow(ctx, clientID); !allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	if allowed, _ := svc.Allow(ctx, clientID); allowed {
+		t.Fatal("expected second request to be denied")
+	}
+
+	state := repo.storage[clientID]
+	state.TAT = state.TAT.Add(-time.Second)
+	repo.storage[clientID] = state
+
+	if allowed, _ := svc.Allow(ctx, clientID); !allowed {
+		t.Error("expected request to be allowed after one emission interval")
+	}
+}
+
+type mockAtomicGCRARepo struct {
+	*mockGCRARepo
+	calls    int
+	interval time.Duration
+	burst    int
+}
+
+func (m *mockAtomicGCRARepo) TakeTAT(ctx context.Context, clientID string, now time.Time, emissionInterval time.Duration, burst int, n int) (ratelimit.GCRA, bool, error) {
+	m.calls++
+	m.interval = emissionInterval
+	m.burst = burst
+	return ratelimit.GCRA{TAT: now.Add(emissionInterval)}, true, nil
+}
+
+func TestGCRAService_Decide_AtomicRepository(t *testing.T) {
+	repo := &mockAtomicGCRARepo{mockGCRARepo: newGCRAMockRepo()}
+	cfg := config.GCRA{Rate: 4, Burst: 5}
+	svc := service.NewGCRAService(repo, cfg)
+
+	d, err := svc.Decide(context.Background(), "client4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.Allowed || d.Remaining != 4 {
+		t.Errorf("expected allowed with 4 remaining, got %+v", d)
+	}
+	if repo.calls != 1 || repo.interval != 250*time.Millisecond || repo.burst != 5 {
+		t.Errorf("expected one TakeTAT call with 250ms/5, got %d calls with %v/%d", repo.calls, repo.interval, repo.burst)
+	}
+	if len(repo.storage) != 0 {
+		t.Error("expected GetTAT/SaveTAT not to be used")
+	}
+}
+
+func TestGCRAService_DecideN(t *testing.T) {
+	repo := newGCRAMockRepo()
+	cfg := config.GCRA{Rate: 10, Burst: 4}
+	svc := service.NewGCRAService(repo, cfg)
+	clientID := "client-weighted"
+	ctx := context.Background()
+
+	d, err := svc.DecideN(ctx, clientID, 3)
+	if err != nil || !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("expected request costing 3 to leave 1, got %+v, %v", d, err)
+	}
+
+	d, _ = svc.DecideN(ctx, clientID, 3)
+	if d.Allowed {
+		t.Fatal("expected second request costing 3 to be denied")
+	}
+	if d.RetryAfter <= 190*time.Millisecond || d.RetryAfter > 200*time.Millisecond {
+		t.Errorf("expected retry-after of two intervals, got %v", d.RetryAfter)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/util"
+)
+
+type LeakyBucketRepository interface {
+	GetLeakyBucket(ctx context.Context, clientID string) (ratelimit.LeakyBucket, error)
+	SaveLeakyBucket(ctx context.Context, clientID string, bucket ratelimit.LeakyBucket) error
+}
+
+// AtomicLeakyBucketRepository is implemented by repositories that can find and
+// reserve the next n free slots as one operation on the store itself. It
+// returns the first slot the request was given, or would have been given when
+// rejected.
+type AtomicLeakyBucketRepository interface {
+	ReserveSlot(ctx context.Context, clientID string, now time.Time, interval time.Duration, capacity int, maxWait time.Duration, n int) (time.Time, bool, error)
+}
+
+// LeakyBucketService smooths traffic instead of rejecting bursts. Requests are
+// handed time slots one leak interval (1/LeakRate) apart and Allow blocks until
+// the slot comes up. A request is only rejected when more than Capacity
+// requests are already waiting or its slot is more than MaxWaitMs away.
+type LeakyBucketService struct {
+	repo   LeakyBucketRepository
+	atomic AtomicLeakyBucketRepository
+	cfg    atomic.Pointer[config.LeakyBucket]
+	limits LimitSource[config.LeakyBucket]
+	locks  *util.StripedMutex
+}
+
+func NewLeakyBucketService(repo LeakyBucketRepository, cfg config.LeakyBucket) *LeakyBucketService {
+	atomicRepo, _ := repo.(AtomicLeakyBucketRepository)
+	s := &LeakyBucketService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
+	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *LeakyBucketService) SetConfig(cfg config.LeakyBucket) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *LeakyBucketService) SetLimitSource(src LimitSource[config.LeakyBucket]) {
+	s.limits = src
+}
+
+func (s *LeakyBucketService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *LeakyBucketService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide reserves a slot for clientID and waits for it. It returns ctx.Err()
+// when ctx is done first; the reserved slot is not handed back, so a request
+// abandoned while queued still counts against the rate. The decision reflects
+// the queue as it was when the slot was reserved.
+func (s *LeakyBucketService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that takes n consecutive slots. It goes out
+// at the first of them and the queue only moves on after the last.
+func (s *LeakyBucketService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	// An idle bucket serves one slot at once and queues up to capacity more.
+	if n > cfg.Capacity+1 {
+		return tooExpensive(cfg.Capacity), nil
+	}
+
+	now := time.Now()
+	slot, allowed, err := s.reserve(ctx, cfg, clientID, now, n)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	decision := s.decision(cfg, now, slot, allowed, n)
+	wait := slot.Sub(now)
+	if !allowed || wait <= 0 {
+		return decision, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ratelimit.Decision{}, ctx.Err()
+	case <-timer.C:
+		return decision, nil
+	}
+}
+
+// decision reports the room left in the queue behind the last reserved slot.
+// slot is the first slot the request got, or would have got when rejected.
+func (s *LeakyBucketService) decision(cfg *config.LeakyBucket, now, slot time.Time, allowed bool, n int) ratelimit.Decision {
+	interval := s.interval(cfg)
+	maxWait := time.Duration(cfg.MaxWaitMs) * time.Millisecond
+	end := slot.Add(interval * time.Duration(n-1))
+
+	last := end
+	if !allowed {
+		last = slot.Add(-interval)
+	}
+	next := max(0, last.Add(interval).Sub(now))
+
+	remaining := 0
+	if next <= maxWait {
+		remaining = min(cfg.Capacity-queuePosition(next, interval), int((maxWait-next)/interval)) + 1
+	}
+	d := ratelimit.Decision{
+		Allowed:   allowed,
+		Limit:     cfg.Capacity,
+		Remaining: max(0, remaining),
+		ResetAt:   last.Add(interval),
+	}
+	if !allowed {
+		d.RetryAfter = max(0, end.Sub(now)-min(maxWait, interval*time.Duration(cfg.Capacity)))
+	}
+	return d
+}
+
+func (s *LeakyBucketService) reserve(ctx context.Context, cfg *config.LeakyBucket, clientID string, now time.Time, n int) (time.Time, bool, error) {
+	interval := s.interval(cfg)
+	maxWait := time.Duration(cfg.MaxWaitMs) * time.Millisecond
+
+	if s.atomic != nil {
+		return s.atomic.ReserveSlot(ctx, clientID, now, interval, cfg.Capacity, maxWait, n)
+	}
+
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	bucket, err := s.repo.GetLeakyBucket(ctx, clientID)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	slot := now
+	if next := bucket.LastSlot.Add(interval); next.After(now) {
+		slot = next
+	}
+
+	// The queue has to hold every slot the request takes, so the limits apply
+	// to the last one.
+	end := slot.Add(interval * time.Duration(n-1))
+	wait := end.Sub(now)
+	if wait > maxWait || queuePosition(wait, interval) > cfg.Capacity {
+		return slot, false, nil
+	}
+
+	if err := s.repo.SaveLeakyBucket(ctx, clientID, ratelimit.LeakyBucket{LastSlot: end}); err != nil {
+		return time.Time{}, false, err
+	}
+	return slot, true, nil
+}
+
+func (s *LeakyBucketService) interval(cfg *config.LeakyBucket) time.Duration {
+	return time.Duration(float64(time.Second) / cfg.LeakRate)
+}
+
+// queuePosition returns how many slots a request waiting for wait sits behind,
+// rounding up so that any wait at all takes a place in the queue.
+func queuePosition(wait, interval time.Duration) int {
+	if wait <= 0 {
+		return 0
+	}
+	return int((wait + interval - 1) / interval)
+}
@@ -0,0 +1,185 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type mockLeakyBucketRepo struct {
+	storage map[string]ratelimit.LeakyBucket
+}
+
+func newLeakyBucketMockRepo() *mockLeakyBucketRepo {
+	return &mockLeakyBucketRepo{storage: make(map[string]ratelimit.LeakyBucket)}
+}
+
+func (m *mockLeakyBucketRepo) GetLeakyBucket(ctx context.Context, clientID string) (ratelimit.LeakyBucket, error) {
+	return m.storage[clientID], nil
+}
+
+func (m *mockLeakyBucketRepo) SaveLeakyBucket(ctx context.Context, clientID string, bucket ratelimit.LeakyBucket) error {
+	m.storage[clientID] = bucket
+	return nil
+}
+
+func TestLeakyBucketService_Allow_WaitsForSlot(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 20, Capacity: 5, MaxWaitMs: 1000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client1"
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		allowed, err := svc.Allow(ctx, clientID)
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	// The first request goes out at once, the next two wait one 50ms interval each.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected requests to be spaced out, took %v", elapsed)
+	}
+}
+
+func TestLeakyBucketService_Allow_QueueFull(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 2, MaxWaitMs: 60000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client2"
+
+	// Two requests are already queued behind the one being served.
+	repo.storage[clientID] = ratelimit.LeakyBucket{LastSlot: time.Now().Add(2 * time.Second)}
+
+	allowed, err := svc.Allow(context.Background(), clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be rejected when the queue is full")
+	}
+}
+
+func TestLeakyBucketService_Allow_WaitTooLong(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 10, MaxWaitMs: 500}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client3"
+
+	repo.storage[clientID] = ratelimit.LeakyBucket{LastSlot: time.Now()}
+
+	allowed, err := svc.Allow(context.Background(), clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be rejected when its slot is beyond max wait")
+	}
+}
+
+func TestLeakyBucketService_Allow_ContextCancelled(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 10, MaxWaitMs: 60000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client4"
+
+	repo.storage[clientID] = ratelimit.LeakyBucket{LastSlot: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	allowed, err := svc.Allow(ctx, clientID)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if allowed {
+		t.Error("expected cancelled request not to be allowed")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected Allow to return on cancellation, took %v", elapsed)
+	}
+}
+
+type mockAtomicLeakyBucketRepo struct {
+	*mockLeakyBucketRepo
+	calls int
+}
+
+func (m *mockAtomicLeakyBucketRepo) ReserveSlot(ctx context.Context, clientID string, now time.Time, interval time.Duration, capacity int, maxWait time.Duration, n int) (time.Time, bool, error) {
+	m.calls++
+	return now, true, nil
+}
+
+func TestLeakyBucketService_Allow_AtomicRepository(t *testing.T) {
+	repo := &mockAtomicLeakyBucketRepo{mockLeakyBucketRepo: newLeakyBucketMockRepo()}
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 1, MaxWaitMs: 1000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+
+	allowed, err := svc.Allow(context.Background(), "client5")
+	if err != nil || !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if repo.calls != 1 {
+		t.Errorf("expected ReserveSlot to be called once, got %d", repo.calls)
+	}
+	if len(repo.storage) != 0 {
+		t.Error("expected GetLeakyBucket/SaveLeakyBucket not to be used")
+	}
+}
+
+func TestLeakyBucketService_Decide_ReportsQueueRoom(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 2, MaxWaitMs: 60000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client-decide"
+
+	last := time.Now().Add(2 * time.Second)
+	repo.storage[clientID] = ratelimit.LeakyBucket{LastSlot: last}
+
+	d, err := svc.Decide(context.Background(), clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed || d.Limit != 2 || d.Remaining != 0 {
+		t.Fatalf("expected denied with 0 of 2 remaining, got %+v", d)
+	}
+	if !d.ResetAt.Equal(last.Add(time.Second)) {
+		t.Errorf("expected reset once the queue drains, got %v", d.ResetAt)
+	}
+	if d.RetryAfter <= 900*time.Millisecond || d.RetryAfter > time.Second {
+		t.Errorf("expected retry-after of about one interval, got %v", d.RetryAfter)
+	}
+}
+
+func TestLeakyBucketService_AllowN_TakesConsecutiveSlots(t *testing.T) {
+	repo := newLeakyBucketMockRepo()
+	cfg := config.LeakyBucket{LeakRate: 1, Capacity: 3, MaxWaitMs: 60000}
+	svc := service.NewLeakyBucketService(repo, cfg)
+	clientID := "client-weighted"
+	ctx := context.Background()
+
+	start := time.Now()
+	allowed, err := svc.AllowN(ctx, clientID, 3)
+	if err != nil || !allowed {
+		t.Fatal("expected request costing 3 to be allowed straight away")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("expected the request to go out at its first slot, waited %v", elapsed)
+	}
+	if last := repo.storage[clientID].LastSlot.Sub(start); last < 2*time.Second || last > 2100*time.Millisecond {
+		t.Errorf("expected the last slot two intervals ahead, got %v", last)
+	}
+
+	allowed, _ = svc.AllowN(ctx, clientID, 2)
+	if allowed {
+		t.Error("expected request costing 2 to overflow the queue")
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import "context"
+
+// LimitSource looks up the limits of a single client, for clients whose plan
+// gives them limits of their own. ok is false when the client has none and
+// the service config applies.
+type LimitSource[T any] interface {
+	Limits(ctx context.Context, clientID string) (limits T, ok bool, err error)
+}
+
+// clientLimits returns the limits of clientID from src, or def when src is nil
+// or has nothing for the client.
+func clientLimits[T any](ctx context.Context, src LimitSource[T], clientID string, def *T) (*T, error) {
+	if src == nil {
+		return def, nil
+	}
+	limits, ok, err := src.Limits(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return def, nil
+	}
+	return &limits, nil
+}
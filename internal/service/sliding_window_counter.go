@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/util"
+)
+
+type SlidingWindowCounterRepository interface {
+	GetCounter(ctx context.Context, clientID string) (ratelimit.SlidingWindowCounter, error)
+	SaveCounter(ctx context.Context, clientID string, counter ratelimit.SlidingWindowCounter) error
+}
+
+// AtomicSlidingWindowCounterRepository is implemented by repositories that can
+// roll, weigh and increment the counters as one operation on the store itself.
+type AtomicSlidingWindowCounterRepository interface {
+	TakeCounter(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.SlidingWindowCounter, bool, error)
+}
+
+// SlidingWindowCounterService approximates a sliding window with two fixed
+// window counts. The previous window is weighted by how much of it still
+// overlaps the rolling time frame, so only two integers are stored per key.
+type SlidingWindowCounterService struct {
+	repo   SlidingWindowCounterRepository
+	atomic AtomicSlidingWindowCounterRepository
+	cfg    atomic.Pointer[config.SlidingWindowCounter]
+	limits LimitSource[config.SlidingWindowCounter]
+	locks  *util.StripedMutex
+}
+
+func NewSlidingWindowCounterService(repo SlidingWindowCounterRepository, cfg config.SlidingWindowCounter) *SlidingWindowCounterService {
+	atomicRepo, _ := repo.(AtomicSlidingWindowCounterRepository)
+	s := &SlidingWindowCounterService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
+	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *SlidingWindowCounterService) SetConfig(cfg config.SlidingWindowCounter) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *SlidingWindowCounterService) SetLimitSource(src LimitSource[config.SlidingWindowCounter]) {
+	s.limits = src
+}
+
+func (s *SlidingWindowCounterService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *SlidingWindowCounterService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide runs the check for clientID and derives the remaining quota, reset
+// and retry-after times from the weighted estimate.
+func (s *SlidingWindowCounterService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that adds n to the current count.
+func (s *SlidingWindowCounterService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	if n > cfg.MaxRequests {
+		return tooExpensive(cfg.MaxRequests), nil
+	}
+
+	if s.atomic != nil {
+		now := time.Now()
+		counter, allowed, err := s.atomic.TakeCounter(ctx, clientID, now, cfg.MaxRequests, s.timeFrame(cfg), n)
+		if err != nil {
+			return ratelimit.Decision{}, err
+		}
+		return s.decision(cfg, now, counter, allowed, n), nil
+	}
+
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	counter, err := s.repo.GetCounter(ctx, clientID)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	now := time.Now()
+	counter = rollSlidingWindowCounter(counter, now, s.timeFrame(cfg))
+
+	allowed := false
+	if estimateSlidingWindowCount(counter, now, s.timeFrame(cfg))+float64(n) <= float64(cfg.MaxRequests) {
+		counter.CurrentCount += n
+		allowed = true
+	}
+
+	if err := s.repo.SaveCounter(ctx, clientID, counter); err != nil {
+		return ratelimit.Decision{}, err
+	}
+	return s.decision(cfg, now, counter, allowed, n), nil
+}
+
+func (s *SlidingWindowCounterService) decision(cfg *config.SlidingWindowCounter, now time.Time, counter ratelimit.SlidingWindowCounter, allowed bool, n int) ratelimit.Decision {
+	frame := s.timeFrame(cfg)
+	estimate := estimateSlidingWindowCount(counter, now, frame)
+	d := ratelimit.Decision{
+		Allowed:   allowed,
+		Limit:     cfg.MaxRequests,
+		Remaining: max(0, int(float64(cfg.MaxRequests)-estimate)),
+		ResetAt:   now,
+	}
+
+	// The estimate only reaches zero once every counted request has been
+	// weighted out, which is the end of the window after the newest one.
+	switch {
+	case counter.CurrentCount > 0:
+		d.ResetAt = counter.CurrentStart.Add(2 * frame)
+	case counter.PreviousCount > 0:
+		d.ResetAt = counter.CurrentStart.Add(frame)
+	}
+
+	if !allowed {
+		d.RetryAfter = max(0, slidingWindowRetryAt(counter, cfg.MaxRequests, frame, n).Sub(now))
+	}
+	return d
+}
+
+func (s *SlidingWindowCounterService) timeFrame(cfg *config.SlidingWindowCounter) time.Duration {
+	return time.Duration(cfg.TimeFrameMs) * time.Millisecond
+}
+
+// slidingWindowStart returns the start of the fixed window containing now.
+// Windows are aligned to the unix epoch so every instance and store agrees on
+// the boundaries.
+func slidingWindowStart(now time.Time, timeFrame time.Duration) time.Time {
+	frame := timeFrame.Milliseconds()
+	if frame <= 0 {
+		return now
+	}
+	ms := now.UnixMilli()
+	return time.UnixMilli(ms - ms%frame)
+}
+
+// rollSlidingWindowCounter moves counter forward to the window containing now.
+// The current count becomes the previous one when exactly one window passed;
+// after a longer gap both counts start over.
+func rollSlidingWindowCounter(counter ratelimit.SlidingWindowCounter, now time.Time, timeFrame time.Duration) ratelimit.SlidingWindowCounter {
+	start := slidingWindowStart(now, timeFrame)
+	if counter.CurrentStart.Equal(start) {
+		return counter
+	}
+
+	rolled := ratelimit.SlidingWindowCounter{CurrentStart: start}
+	if counter.CurrentStart.Equal(start.Add(-timeFrame)) {
+		rolled.PreviousCount = counter.CurrentCount
+	}
+	return rolled
+}
+
+// estimateSlidingWindowCount returns the weighted number of requests seen in
+// the time frame ending at now.
+func estimateSlidingWindowCount(counter ratelimit.SlidingWindowCounter, now time.Time, timeFrame time.Duration) float64 {
+	weight := 1 - float64(now.Sub(counter.CurrentStart))/float64(timeFrame)
+	if weight < 0 {
+		weight = 0
+	}
+	return float64(counter.PreviousCount)*weight + float64(counter.CurrentCount)
+}
+
+// slidingWindowRetryAt returns the first moment the estimate leaves room for
+// a request costing n. While the current count leaves room, that happens once
+// the previous window has been weighted down far enough; otherwise the current
+// count has to become the previous one and decay in the next window.
+func slidingWindowRetryAt(counter ratelimit.SlidingWindowCounter, maxRequests int, timeFrame time.Duration, n int) time.Time {
+	start, prev := counter.CurrentStart, counter.PreviousCount
+	room := float64(maxRequests - counter.CurrentCount - n)
+	if room < 0 {
+		start, prev = start.Add(timeFrame), counter.CurrentCount
+		room = float64(maxRequests - n)
+	}
+	if prev == 0 {
+		return start
+	}
+
+	weight := min(1, max(0, room/float64(prev)))
+	return start.Add(time.Duration((1 - weight) * float64(timeFrame)))
+}
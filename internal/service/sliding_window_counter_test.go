@@ -0,0 +1,161 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type mockSlidingWindowCounterRepo struct {
+	storage map[string]ratelimit.SlidingWindowCounter
+}
+
+func newSlidingWindowCounterMockRepo() *mockSlidingWindowCounterRepo {
+	return &mockSlidingWindowCounterRepo{
+		storage: make(map[string]ratelimit.SlidingWindowCounter),
+	}
+}
+
+func (m *mockSlidingWindowCounterRepo) GetCounter(ctx context.Context, clientID string) (ratelimit.SlidingWindowCounter, error) {
+	return m.storage[clientID], nil
+}
+
+func (m *mockSlidingWindowCounterRepo) SaveCounter(ctx context.Context, clientID string, counter ratelimit.SlidingWindowCounter) error {
+	m.storage[clientID] = counter
+	return nil
+}
+
+func TestSlidingWindowCounterService_Allow_HitMaxRequests(t *testing.T) {
+	repo := newSlidingWindowCounterMockRepo()
+	cfg := config.SlidingWindowCounter{MaxRequests: 2, TimeFrameMs: 60000}
+	svc := service.NewSlidingWindowCounterService(repo, cfg)
+	clientID := "client1"
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, err := svc.Allow(ctx, clientID)
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, err := svc.Allow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected third request to be denied")
+	}
+}
+
+func TestSlidingWindowCounterService_Allow_WeighsPreviousWindow(t *testing.T) {
+	repo := newSlidingWindowCounterMockRepo()
+	cfg := config.SlidingWindowCounter{MaxRequests: 10, TimeFrameMs: 60000}
+	svc := service.NewSlidingWindowCounterService(repo, cfg)
+	clientID := "client2"
+	ctx := context.Background()
+
+	// A full previous window right behind the current one keeps the estimate
+	// at the limit for almost the whole current window.
+	ms := time.Now().UnixMilli()
+	start := time.UnixMilli(ms - ms%60000)
+	repo.storage[clientID] = ratelimit.SlidingWindowCounter{
+		CurrentCount: 10,
+		CurrentStart: start.Add(-time.Minute),
+	}
+
+	allowed, err := svc.Allow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := repo.storage[clientID]
+	if got.PreviousCount != 10 || !got.CurrentStart.Equal(start) {
+		t.Fatalf("expected counter rolled to current window, got %+v", got)
+	}
+
+	weight := 1 - float64(time.Since(start))/float64(time.Minute)
+	if expected := 10*weight+1 <= 10; allowed != expected {
+		t.Errorf("expected allowed=%v with previous weight %.2f, got %v", expected, weight, allowed)
+	}
+}
+
+func TestSlidingWindowCounterService_Allow_StaleWindowResets(t *testing.T) {
+	repo := newSlidingWindowCounterMockRepo()
+	cfg := config.SlidingWindowCounter{MaxRequests: 1, TimeFrameMs: 1000}
+	svc := service.NewSlidingWindowCounterService(repo, cfg)
+	clientID := "client3"
+
+	repo.storage[clientID] = ratelimit.SlidingWindowCounter{
+		PreviousCount: 5,
+		CurrentCount:  5,
+		CurrentStart:  time.Now().Add(-time.Hour),
+	}
+
+	allowed, err := svc.Allow(context.Background(), clientID)
+	if err != nil || !allowed {
+		t.Fatal("expected request to be allowed after a long gap")
+	}
+	if got := repo.storage[clientID]; got.PreviousCount != 0 || got.CurrentCount != 1 {
+		t.Errorf("expected counts 0/1, got %d/%d", got.PreviousCount, got.CurrentCount)
+	}
+}
+
+type mockAtomicSlidingWindowCounterRepo struct {
+	*mockSlidingWindowCounterRepo
+	calls int
+}
+
+func (m *mockAtomicSlidingWindowCounterRepo) TakeCounter(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (ratelimit.SlidingWindowCounter, bool, error) {
+	m.calls++
+	return ratelimit.SlidingWindowCounter{CurrentCount: 1}, true, nil
+}
+
+func TestSlidingWindowCounterService_Allow_AtomicRepository(t *testing.T) {
+	repo := &mockAtomicSlidingWindowCounterRepo{mockSlidingWindowCounterRepo: newSlidingWindowCounterMockRepo()}
+	cfg := config.SlidingWindowCounter{MaxRequests: 2, TimeFrameMs: 1000}
+	svc := service.NewSlidingWindowCounterService(repo, cfg)
+
+	allowed, err := svc.Allow(context.Background(), "client4")
+	if err != nil || !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if repo.calls != 1 {
+		t.Errorf("expected TakeCounter to be called once, got %d", repo.calls)
+	}
+	if len(repo.storage) != 0 {
+		t.Error("expected GetCounter/SaveCounter not to be used")
+	}
+}
+
+func TestSlidingWindowCounterService_Decide_RetryAfterNextWindow(t *testing.T) {
+	repo := newSlidingWindowCounterMockRepo()
+	cfg := config.SlidingWindowCounter{MaxRequests: 4, TimeFrameMs: 10000}
+	svc := service.NewSlidingWindowCounterService(repo, cfg)
+	clientID := "client-decide"
+
+	ms := time.Now().UnixMilli()
+	start := time.UnixMilli(ms - ms%10000)
+	repo.storage[clientID] = ratelimit.SlidingWindowCounter{CurrentStart: start, CurrentCount: 4}
+
+	d, err := svc.Decide(context.Background(), clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed || d.Limit != 4 || d.Remaining != 0 {
+		t.Fatalf("expected denied with 0 of 4 remaining, got %+v", d)
+	}
+	if !d.ResetAt.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("expected reset at the end of the next window, got %v", d.ResetAt)
+	}
+
+	// The four requests only weigh 3 once a quarter of the next window passed.
+	retryAt := start.Add(12500 * time.Millisecond)
+	if got := time.Now().Add(d.RetryAfter); got.Sub(retryAt).Abs() > 10*time.Millisecond {
+		t.Errorf("expected retry at %v, got %v", retryAt, got)
+	}
+}
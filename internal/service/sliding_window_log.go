@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/util"
+)
+
+type SlidingWindowLogRepository interface {
+	GetLog(ctx context.Context, clientID string) (ratelimit.SlidingLog, error)
+	SaveLog(ctx context.Context, clientID string, log ratelimit.SlidingLog) error
+}
+
+// AtomicSlidingWindowLogRepository is implemented by repositories that can
+// trim, count and append to a log as one operation on the store itself. It
+// reports the number of entries left in the window and the oldest and newest
+// of them. For a rejected request oldest is instead the last entry that has to
+// leave the window before the request fits, which only differs when n > 1.
+type AtomicSlidingWindowLogRepository interface {
+	TakeLog(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (count int, oldest, newest time.Time, allowed bool, err error)
+}
+
+// SlidingWindowLogService remembers the time of every allowed request and only
+// allows a new one when fewer than MaxRequests happened in the last
+// TimeFrameMs, so clients cannot double up across a window boundary.
+type SlidingWindowLogService struct {
+	repo   SlidingWindowLogRepository
+	atomic AtomicSlidingWindowLogRepository
+	cfg    atomic.Pointer[config.SlidingWindowLog]
+	limits LimitSource[config.SlidingWindowLog]
+	locks  *util.StripedMutex
+}
+
+func NewSlidingWindowLogService(repo SlidingWindowLogRepository, cfg config.SlidingWindowLog) *SlidingWindowLogService {
+	atomicRepo, _ := repo.(AtomicSlidingWindowLogRepository)
+	s := &SlidingWindowLogService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
+	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *SlidingWindowLogService) SetConfig(cfg config.SlidingWindowLog) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *SlidingWindowLogService) SetLimitSource(src LimitSource[config.SlidingWindowLog]) {
+	s.limits = src
+}
+
+func (s *SlidingWindowLogService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *SlidingWindowLogService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide runs the check for clientID. A rejected client may retry once the
+// oldest entry leaves the window and is back to its full limit once the newest
+// one has.
+func (s *SlidingWindowLogService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that is logged as n entries.
+func (s *SlidingWindowLogService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	if n > cfg.MaxRequests {
+		return tooExpensive(cfg.MaxRequests), nil
+	}
+
+	if s.atomic != nil {
+		now := time.Now()
+		count, oldest, newest, allowed, err := s.atomic.TakeLog(ctx, clientID, now, cfg.MaxRequests, s.timeFrame(cfg), n)
+		if err != nil {
+			return ratelimit.Decision{}, err
+		}
+		return s.decision(cfg, now, count, oldest, newest, allowed), nil
+	}
+
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	log, err := s.repo.GetLog(ctx, clientID)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-s.timeFrame(cfg))
+
+	kept := log.Timestamps[:0]
+	for _, ts := range log.Timestamps {
+		if ts.After(cutoff) {
+			kept = append(kept, ts)
+		}
+	}
+	log.Timestamps = kept
+
+	allowed := false
+	if n <= cfg.MaxRequests-len(log.Timestamps) {
+		for range n {
+			log.Timestamps = append(log.Timestamps, now)
+		}
+		allowed = true
+	}
+
+	if err := s.repo.SaveLog(ctx, clientID, log); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	count := len(log.Timestamps)
+	if count == 0 {
+		return s.decision(cfg, now, 0, time.Time{}, time.Time{}, allowed), nil
+	}
+
+	// A rejected request fits once every entry up to blocking has left.
+	blocking := 0
+	if !allowed {
+		blocking = min(max(0, count+n-cfg.MaxRequests-1), count-1)
+	}
+	return s.decision(cfg, now, count, log.Timestamps[blocking], log.Timestamps[count-1], allowed), nil
+}
+
+func (s *SlidingWindowLogService) decision(cfg *config.SlidingWindowLog, now time.Time, count int, oldest, newest time.Time, allowed bool) ratelimit.Decision {
+	d := ratelimit.Decision{
+		Allowed:   allowed,
+		Limit:     cfg.MaxRequests,
+		Remaining: max(0, cfg.MaxRequests-count),
+		ResetAt:   now,
+	}
+	if !newest.IsZero() {
+		d.ResetAt = newest.Add(s.timeFrame(cfg))
+	}
+	if !allowed && !oldest.IsZero() {
+		d.RetryAfter = max(0, oldest.Add(s.timeFrame(cfg)).Sub(now))
+	}
+	return d
+}
+
+func (s *SlidingWindowLogService) timeFrame(cfg *config.SlidingWindowLog) time.Duration {
+	return time.Duration(cfg.TimeFrameMs) * time.Millisecond
+}
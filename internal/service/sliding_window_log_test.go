@@ -0,0 +1,176 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain/ratelimit"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+)
+
+type mockSlidingWindowLogRepo struct {
+	storage map[string]ratelimit.SlidingLog
+}
+
+func newSlidingWindowLogMockRepo() *mockSlidingWindowLogRepo {
+	return &mockSlidingWindowLogRepo{
+		storage: make(map[string]ratelimit.SlidingLog),
+	}
+}
+
+func (m *mockSlidingWindowLogRepo) GetLog(ctx context.Context, clientID string) (ratelimit.SlidingLog, error) {
+	l, ok := m.storage[clientID]
+	if !ok {
+		return ratelimit.SlidingLog{}, nil
+	}
+	return ratelimit.SlidingLog{Timestamps: append([]time.Time(nil), l.Timestamps...)}, nil
+}
+
+func (m *mockSlidingWindowLogRepo) SaveLog(ctx context.Context, clientID string, log ratelimit.SlidingLog) error {
+	m.storage[clientID] = log
+	return nil
+}
+
+func TestSlidingWindowLogService_Allow_HitMaxRequests(t *testing.T) {
+	repo := newSlidingWindowLogMockRepo()
+	cfg := config.SlidingWindowLog{MaxRequests: 2, TimeFrameMs: 1000}
+	svc := service.NewSlidingWindowLogService(repo, cfg)
+	clientID := "client1"
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, err := svc.Allow(ctx, clientID)
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, err := svc.Allow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected third request to be denied")
+	}
+	if n := len(repo.storage[clientID].Timestamps); n != 2 {
+		t.Errorf("expected rejected request not to be logged, got %d entries", n)
+	}
+}
+
+func TestSlidingWindowLogService_Allow_EntriesSlideOut(t *testing.T) {
+	repo := newSlidingWindowLogMockRepo()
+	cfg := config.SlidingWindowLog{MaxRequests: 2, TimeFrameMs: 1000}
+	svc := service.NewSlidingWindowLogService(repo, cfg)
+	clientID := "client2"
+	ctx := context.Background()
+
+	now := time.Now()
+	repo.storage[clientID] = ratelimit.SlidingLog{Timestamps: []time.Time{
+		now.Add(-1500 * time.Millisecond),
+		now.Add(-200 * time.Millisecond),
+	}}
+
+	allowed, err := svc.Allow(ctx, clientID)
+	if err != nil || !allowed {
+		t.Fatal("expected request to be allowed once the oldest entry left the window")
+	}
+
+	allowed, err = svc.Allow(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("expected request to be denied while two entries are inside the window")
+	}
+}
+
+type mockAtomicSlidingWindowLogRepo struct {
+	*mockSlidingWindowLogRepo
+	calls   int
+	allowed bool
+}
+
+func (m *mockAtomicSlidingWindowLogRepo) TakeLog(ctx context.Context, clientID string, now time.Time, maxRequests int, timeFrame time.Duration, n int) (int, time.Time, time.Time, bool, error) {
+	m.calls++
+	return 1, now, now, m.allowed, nil
+}
+
+func TestSlidingWindowLogService_Allow_AtomicRepository(t *testing.T) {
+	repo := &mockAtomicSlidingWindowLogRepo{mockSlidingWindowLogRepo: newSlidingWindowLogMockRepo(), allowed: true}
+	cfg := config.SlidingWindowLog{MaxRequests: 2, TimeFrameMs: 1000}
+	svc := service.NewSlidingWindowLogService(repo, cfg)
+
+	allowed, err := svc.Allow(context.Background(), "client3")
+	if err != nil || !allowed {
+		t.Error("expected request to be allowed")
+	}
+	if repo.calls != 1 {
+		t.Errorf("expected TakeLog to be called once, got %d", repo.calls)
+	}
+	if len(repo.storage) != 0 {
+		t.Error("expected GetLog/SaveLog not to be used")
+	}
+}
+
+func TestSlidingWindowLogService_Decide_ReportsRemainingAndReset(t *testing.T) {
+	repo := newSlidingWindowLogMockRepo()
+	cfg := config.SlidingWindowLog{MaxRequests: 2, TimeFrameMs: 10000}
+	svc := service.NewSlidingWindowLogService(repo, cfg)
+	clientID := "client-decide"
+	ctx := context.Background()
+
+	now := time.Now()
+	oldest := now.Add(-8 * time.Second)
+	newest := now.Add(-3 * time.Second)
+	repo.storage[clientID] = ratelimit.SlidingLog{Timestamps: []time.Time{oldest, newest}}
+
+	d, err := svc.Decide(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed || d.Limit != 2 || d.Remaining != 0 {
+		t.Fatalf("expected denied with 0 of 2 remaining, got %+v", d)
+	}
+	if !d.ResetAt.Equal(newest.Add(10 * time.Second)) {
+		t.Errorf("expected reset once the newest entry leaves, got %v", d.ResetAt)
+	}
+	if d.RetryAfter <= 1900*time.Millisecond || d.RetryAfter > 2*time.Second {
+		t.Errorf("expected retry-after until the oldest entry leaves, got %v", d.RetryAfter)
+	}
+}
+
+func TestSlidingWindowLogService_DecideN(t *testing.T) {
+	repo := newSlidingWindowLogMockRepo()
+	cfg := config.SlidingWindowLog{MaxRequests: 4, TimeFrameMs: 10000}
+	svc := service.NewSlidingWindowLogService(repo, cfg)
+	clientID := "client-weighted"
+	ctx := context.Background()
+
+	now := time.Now()
+	repo.storage[clientID] = ratelimit.SlidingLog{Timestamps: []time.Time{
+		now.Add(-8 * time.Second),
+		now.Add(-6 * time.Second),
+	}}
+
+	d, err := svc.DecideN(ctx, clientID, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed {
+		t.Fatal("expected request costing 3 to be denied with 2 entries logged")
+	}
+	// One entry has to leave before three more fit, and that is the oldest.
+	if d.RetryAfter <= 1900*time.Millisecond || d.RetryAfter > 2*time.Second {
+		t.Errorf("expected retry-after until the oldest entry leaves, got %v", d.RetryAfter)
+	}
+
+	d, _ = svc.DecideN(ctx, clientID, 2)
+	if !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected request costing 2 to fill the log, got %+v", d)
+	}
+	if got := len(repo.storage[clientID].Timestamps); got != 4 {
+		t.Errorf("expected 4 entries, got %d", got)
+	}
+}
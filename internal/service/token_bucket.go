@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
@@ -12,55 +13,184 @@ import (
 type TokenBucketRepository interface {
 	GetBucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error)
 	SaveBucket(ctx context.Context, clientID string, bucket ratelimit.TokenBucket) error
+	DeleteBucket(ctx context.Context, clientID string) error
+	// ListBuckets returns the IDs of the clients starting with prefix that
+	// have a bucket.
+	ListBuckets(ctx context.Context, prefix string) ([]string, error)
+}
+
+// AtomicTokenBucketRepository is implemented by repositories that can refill
+// and consume a bucket as one operation on the store itself. The service
+// prefers it over GetBucket/SaveBucket because the striped mutex only guards a
+// single process.
+type AtomicTokenBucketRepository interface {
+	TakeToken(ctx context.Context, clientID string, now time.Time, maxTokens float64, refillRate float64, n int) (ratelimit.TokenBucket, bool, error)
 }
 
 type TokenBucketService struct {
-	repo  TokenBucketRepository
-	cfg   config.TokenBucket
-	locks *util.StripedMutex
+	repo   TokenBucketRepository
+	atomic AtomicTokenBucketRepository
+	cfg    atomic.Pointer[config.TokenBucket]
+	limits LimitSource[config.TokenBucket]
+	locks  *util.StripedMutex
 }
 
 func NewTokenBucketService(repo TokenBucketRepository, cfg config.TokenBucket) *TokenBucketService {
-	return &TokenBucketService{
-		repo:  repo,
-		cfg:   cfg,
-		locks: util.NewStripedMutex(256),
+	atomicRepo, _ := repo.(AtomicTokenBucketRepository)
+	s := &TokenBucketService{
+		repo:   repo,
+		atomic: atomicRepo,
+		locks:  util.NewStripedMutex(256),
 	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the limits used from the next decision on. Decisions
+// already running finish with the limits they started with.
+func (s *TokenBucketService) SetConfig(cfg config.TokenBucket) {
+	s.cfg.Store(&cfg)
+}
+
+// SetLimitSource makes the service look up the limits of each client in src,
+// falling back to its config for clients src does not know. It has to be
+// called before the service is used.
+func (s *TokenBucketService) SetLimitSource(src LimitSource[config.TokenBucket]) {
+	s.limits = src
 }
 
 func (s *TokenBucketService) Allow(ctx context.Context, clientID string) (bool, error) {
+	return s.AllowN(ctx, clientID, 1)
+}
+
+// AllowN is Allow for a request that costs n units of the limit.
+func (s *TokenBucketService) AllowN(ctx context.Context, clientID string, n int) (bool, error) {
+	decision, err := s.DecideN(ctx, clientID, n)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Decide runs the check for clientID and reports the whole tokens left, when
+// the bucket will be full again and, on rejection, when the next token lands.
+func (s *TokenBucketService) Decide(ctx context.Context, clientID string) (ratelimit.Decision, error) {
+	return s.DecideN(ctx, clientID, 1)
+}
+
+// DecideN is Decide for a request that consumes n tokens at once.
+func (s *TokenBucketService) DecideN(ctx context.Context, clientID string, n int) (ratelimit.Decision, error) {
+	if err := validateCost(n); err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	if float64(n) > cfg.MaxTokens {
+		return tooExpensive(int(cfg.MaxTokens)), nil
+	}
+
+	if s.atomic != nil {
+		now := time.Now()
+		bucket, allowed, err := s.atomic.TakeToken(ctx, clientID, now, cfg.MaxTokens, cfg.RefillRate, n)
+		if err != nil {
+			return ratelimit.Decision{}, err
+		}
+		return s.decision(cfg, now, bucket, allowed, n), nil
+	}
+
 	unlock := s.locks.Lock(clientID)
 	defer unlock()
 
 	bucket, err := s.repo.GetBucket(ctx, clientID)
 	if err != nil {
-		return false, err
+		return ratelimit.Decision{}, err
 	}
 
 	now := time.Now()
 
+	bucket = refill(cfg, bucket, now)
+
+	allowed := false
+	if bucket.Tokens >= float64(n) {
+		bucket.Tokens -= float64(n)
+		allowed = true
+	}
+
+	if err := s.repo.SaveBucket(ctx, clientID, bucket); err != nil {
+		return ratelimit.Decision{}, err
+	}
+	return s.decision(cfg, now, bucket, allowed, n), nil
+}
+
+// Bucket returns the client's bucket refilled up to now without taking a
+// token. A client without a bucket has a full one.
+func (s *TokenBucketService) Bucket(ctx context.Context, clientID string) (ratelimit.TokenBucket, error) {
+	cfg, err := clientLimits(ctx, s.limits, clientID, s.cfg.Load())
+	if err != nil {
+		return ratelimit.TokenBucket{}, err
+	}
+
+	bucket, err := s.repo.GetBucket(ctx, clientID)
+	if err != nil {
+		return ratelimit.TokenBucket{}, err
+	}
+	return refill(cfg, bucket, time.Now()), nil
+}
+
+// Reset forgets the client's bucket, so it starts full again.
+func (s *TokenBucketService) Reset(ctx context.Context, clientID string) error {
+	unlock := s.locks.Lock(clientID)
+	defer unlock()
+
+	return s.repo.DeleteBucket(ctx, clientID)
+}
+
+// Clients returns the IDs of the clients starting with prefix that have a
+// bucket.
+func (s *TokenBucketService) Clients(ctx context.Context, prefix string) ([]string, error) {
+	return s.repo.ListBuckets(ctx, prefix)
+}
+
+// refill adds the tokens earned since the bucket's last refill, capped at
+// MaxTokens. A bucket never refilled is a new, full one.
+func refill(cfg *config.TokenBucket, bucket ratelimit.TokenBucket, now time.Time) ratelimit.TokenBucket {
 	if bucket.LastRefill.IsZero() {
 		bucket.LastRefill = now
-		bucket.Tokens = s.cfg.MaxTokens
+		bucket.Tokens = cfg.MaxTokens
 	}
 
 	elapsed := now.Sub(bucket.LastRefill).Seconds()
 	if elapsed > 0 {
-		bucket.Tokens += elapsed * s.cfg.RefillRate
-		if bucket.Tokens > s.cfg.MaxTokens {
-			bucket.Tokens = s.cfg.MaxTokens
+		bucket.Tokens += elapsed * cfg.RefillRate
+		if bucket.Tokens > cfg.MaxTokens {
+			bucket.Tokens = cfg.MaxTokens
 		}
 		bucket.LastRefill = now
 	}
+	return bucket
+}
 
-	allowed := false
-	if bucket.Tokens >= 1.0 {
-		bucket.Tokens -= 1.0
-		allowed = true
+func (s *TokenBucketService) decision(cfg *config.TokenBucket, now time.Time, bucket ratelimit.TokenBucket, allowed bool, n int) ratelimit.Decision {
+	d := ratelimit.Decision{
+		Allowed:   allowed,
+		Limit:     int(cfg.MaxTokens),
+		Remaining: int(bucket.Tokens),
+		ResetAt:   now.Add(s.refillTime(cfg, cfg.MaxTokens-bucket.Tokens)),
+	}
+	if !allowed {
+		d.RetryAfter = s.refillTime(cfg, float64(n)-bucket.Tokens)
 	}
+	return d
+}
 
-	if err := s.repo.SaveBucket(ctx, clientID, bucket); err != nil {
-		return false, err
+// refillTime returns how long the bucket takes to gain tokens.
+func (s *TokenBucketService) refillTime(cfg *config.TokenBucket, tokens float64) time.Duration {
+	if tokens <= 0 || cfg.RefillRate <= 0 {
+		return 0
 	}
-	return allowed, nil
+	return time.Duration(tokens / cfg.RefillRate * float64(time.Second))
 }
@@ -2,6 +2,8 @@ package service_test
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,6 +33,22 @@ func (m *mockRepo) SaveBucket(ctx context.Context, clientID string, bucket ratel
 	return nil
 }
 
+func (m *mockRepo) DeleteBucket(ctx context.Context, clientID string) error {
+	delete(m.data, clientID)
+	return nil
+}
+
+func (m *mockRepo) ListBuckets(ctx context.Context, prefix string) ([]string, error) {
+	var ids []string
+	for id := range m.data {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
 func TestTokenBucketService_Allow(t *testing.T) {
 	cfg := config.TokenBucket{
 		MaxTokens:  5,
@@ -71,3 +89,154 @@ func TestTokenBucketService_Allow(t *testing.T) {
 		t.Fatalf("expected allowed=true after refill")
 	}
 }
+
+type mockAtomicRepo struct {
+	*mockRepo
+	calls      int
+	maxTokens  float64
+	refillRate float64
+	allowed    bool
+}
+
+func (m *mockAtomicRepo) TakeToken(ctx context.Context, clientID string, now time.Time, maxTokens float64, refillRate float64, n int) (ratelimit.TokenBucket, bool, error) {
+	m.calls++
+	m.maxTokens = maxTokens
+	m.refillRate = refillRate
+	return ratelimit.TokenBucket{Tokens: maxTokens - 1, LastRefill: now}, m.allowed, nil
+}
+
+func TestTokenBucketService_Allow_AtomicRepository(t *testing.T) {
+	cfg := config.TokenBucket{
+		MaxTokens:  5,
+		RefillRate: 2,
+	}
+
+	repo := &mockAtomicRepo{mockRepo: newTokenBucketMockRepo(), allowed: true}
+	svc := service.NewTokenBucketService(repo, cfg)
+
+	allowed, err := svc.Allow(context.Background(), "test-client")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Fatalf("expected allowed=true")
+	}
+	if repo.calls != 1 {
+		t.Fatalf("expected TakeToken to be called once, got %d", repo.calls)
+	}
+	if repo.maxTokens != 5 || repo.refillRate != 2 {
+		t.Fatalf("expected limits 5/2, got %v/%v", repo.maxTokens, repo.refillRate)
+	}
+	if len(repo.data) != 0 {
+		t.Fatalf("expected GetBucket/SaveBucket not to be used")
+	}
+}
+
+func TestTokenBucketService_Decide_ReportsRemainingAndReset(t *testing.T) {
+	repo := newTokenBucketMockRepo()
+	cfg := config.TokenBucket{MaxTokens: 2, RefillRate: 10}
+	svc := service.NewTokenBucketService(repo, cfg)
+	clientID := "client-decide"
+	ctx := context.Background()
+
+	before := time.Now()
+	d, err := svc.Decide(ctx, clientID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !d.Allowed || d.Limit != 2 || d.Remaining != 1 {
+		t.Fatalf("expected allowed with 1 of 2 remaining, got %+v", d)
+	}
+	if reset := d.ResetAt.Sub(before); reset < 90*time.Millisecond || reset > 110*time.Millisecond {
+		t.Errorf("expected bucket full again after one refill, got %v", reset)
+	}
+
+	repo.data[clientID] = ratelimit.TokenBucket{Tokens: 0.5, LastRefill: time.Now()}
+	d, _ = svc.Decide(ctx, clientID)
+	if d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected request to be denied with 0 remaining, got %+v", d)
+	}
+	if d.RetryAfter <= 40*time.Millisecond || d.RetryAfter > 50*time.Millisecond {
+		t.Errorf("expected retry-after until half a token refills, got %v", d.RetryAfter)
+	}
+}
+
+func TestTokenBucketService_DecideN_RetryAfterCoversCost(t *testing.T) {
+	repo := newTokenBucketMockRepo()
+	cfg := config.TokenBucket{MaxTokens: 5, RefillRate: 10}
+	svc := service.NewTokenBucketService(repo, cfg)
+	clientID := "client-weighted"
+	ctx := context.Background()
+
+	d, err := svc.DecideN(ctx, clientID, 4)
+	if err != nil || !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("expected request costing 4 to leave 1 token, got %+v, %v", d, err)
+	}
+
+	d, _ = svc.DecideN(ctx, clientID, 3)
+	if d.Allowed {
+		t.Fatal("expected request costing 3 to be denied")
+	}
+	if d.RetryAfter < 190*time.Millisecond || d.RetryAfter > 200*time.Millisecond {
+		t.Errorf("expected retry-after until two more tokens refill, got %v", d.RetryAfter)
+	}
+}
+
+func TestTokenBucketService_SetConfig(t *testing.T) {
+	repo := newTokenBucketMockRepo()
+	svc := service.NewTokenBucketService(repo, config.TokenBucket{MaxTokens: 1, RefillRate: 0.001})
+	ctx := context.Background()
+
+	if allowed, err := svc.Allow(ctx, "client1"); err != nil || !allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	if allowed, _ := svc.Allow(ctx, "client1"); allowed {
+		t.Fatal("expected second request to be denied")
+	}
+
+	// A much faster refill tops the bucket up again almost at once.
+	svc.SetConfig(config.TokenBucket{MaxTokens: 1, RefillRate: 1000})
+	time.Sleep(5 * time.Millisecond)
+
+	if allowed, err := svc.Allow(ctx, "client1"); err != nil || !allowed {
+		t.Error("expected request to be allowed after raising the refill rate")
+	}
+}
+
+func TestTokenBucketService_BucketAndReset(t *testing.T) {
+	repo := newTokenBucketMockRepo()
+	svc := service.NewTokenBucketService(repo, config.TokenBucket{MaxTokens: 5, RefillRate: 1})
+	ctx := context.Background()
+
+	bucket, err := svc.Bucket(ctx, "p:new")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bucket.Tokens != 5 {
+		t.Fatalf("expected a new bucket to be full, got %v", bucket.Tokens)
+	}
+	if len(repo.data) != 0 {
+		t.Fatalf("expected Bucket not to save anything")
+	}
+
+	repo.data["p:a"] = ratelimit.TokenBucket{Tokens: 1, LastRefill: time.Now().Add(-2 * time.Second)}
+	bucket, _ = svc.Bucket(ctx, "p:a")
+	if bucket.Tokens < 2.9 || bucket.Tokens > 3.1 {
+		t.Fatalf("expected bucket refilled to ~3 tokens, got %v", bucket.Tokens)
+	}
+	if repo.data["p:a"].Tokens != 1 {
+		t.Fatalf("expected the stored bucket to be left alone")
+	}
+
+	clients, _ := svc.Clients(ctx, "p:")
+	if !slices.Equal(clients, []string{"p:a"}) {
+		t.Fatalf("expected clients [p:a], got %v", clients)
+	}
+
+	if err := svc.Reset(ctx, "p:a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := repo.data["p:a"]; ok {
+		t.Fatalf("expected bucket to be deleted")
+	}
+}
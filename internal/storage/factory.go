@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/metrics"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/redis/go-redis/v9"
+)
+
+// Factory builds the repository of each algorithm on the backend chosen in
+// the storage section of the config. Redis clients are only created for
+// algorithms that are stored in Redis, one per database. Repositories whose
+// Redis scripts depend on the limit take the algorithm config, so that each
+// policy can get its own.
+type Factory struct {
+	cfg *config.Config
+	// policy is the policy the Redis keys are namespaced under, set by
+	// ForPolicy.
+	policy  string
+	clients map[int]redis.UniversalClient
+	breaker *rdb.CircuitBreaker
+	metrics *metrics.Metrics
+	// janitors stops the janitors of the in-memory repositories, shared with
+	// the Local factories so Close stops theirs too.
+	janitors *[]func()
+}
+
+func NewFactory(cfg *config.Config) *Factory {
+	f := &Factory{
+		cfg:      cfg,
+		clients:  make(map[int]redis.UniversalClient),
+		janitors: new([]func()),
+	}
+	// Every database lives on the same server, so one breaker guards them all.
+	if cb := cfg.Redis.CircuitBreaker; cb.Failures > 0 {
+		f.breaker = rdb.NewCircuitBreaker(cb.Failures, time.Duration(cb.CooldownMs)*time.Millisecond)
+	}
+	return f
+}
+
+// ForPolicy returns a factory building the repositories of policy, sharing the
+// Redis clients, breaker and janitors of f.
+func (f *Factory) ForPolicy(policy string) *Factory {
+	g := *f
+	g.policy = policy
+	return &g
+}
+
+// Local returns a factory building in-memory repositories for every
+// algorithm, for limiters that stand in while the configured store fails.
+func (f *Factory) Local() *Factory {
+	cfg := *f.cfg
+	cfg.Storage = config.Storage{
+		FixedWindow:          config.StorageMemory,
+		TokenBucket:          config.StorageMemory,
+		SlidingWindowLog:     config.StorageMemory,
+		SlidingWindowCounter: config.StorageMemory,
+		GCRA:                 config.StorageMemory,
+		LeakyBucket:          config.StorageMemory,
+		Concurrency:          config.StorageMemory,
+		Memory:               f.cfg.Storage.Memory,
+	}
+	return &Factory{
+		cfg:      &cfg,
+		policy:   f.policy,
+		clients:  make(map[int]redis.UniversalClient),
+		metrics:  f.metrics,
+		janitors: f.janitors,
+	}
+}
+
+func (f *Factory) FixedWindowRepository() (service.FixedWindowRepository, error) {
+	switch backend := f.cfg.Storage.FixedWindow; backend {
+	case config.StorageMemory:
+		repo := memory.NewFixedWindowRepository(f.memoryOptions()...)
+		*f.janitors = append(*f.janitors, repo.Close)
+		return f.metrics.FixedWindowRepository(repo, backend), nil
+	case config.StorageRedis:
+		return f.metrics.FixedWindowRepository(rdb.NewFixedWindowRepository(f.client(f.cfg.Redis.FixedWindowDb), f.keys(config.AlgorithmFixedWindow)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmFixedWindow, backend)
+	}
+}
+
+func (f *Factory) TokenBucketRepository(cfg config.TokenBucket) (service.TokenBucketRepository, error) {
+	switch backend := f.cfg.Storage.TokenBucket; backend {
+	case config.StorageMemory:
+		repo := memory.NewTokenBucketRepository(cfg.MaxTokens, cfg.RefillRate, f.memoryOptions()...)
+		*f.janitors = append(*f.janitors, repo.Close)
+		return f.metrics.TokenBucketRepository(repo, backend), nil
+	case config.StorageRedis:
+		return f.metrics.TokenBucketRepository(rdb.NewTokenBucketRepository(f.client(f.cfg.Redis.TokenBucketDb), cfg.MaxTokens, cfg.RefillRate, f.keys(config.AlgorithmTokenBucket)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmTokenBucket, backend)
+	}
+}
+
+func (f *Factory) SlidingWindowLogRepository(cfg config.SlidingWindowLog) (service.SlidingWindowLogRepository, error) {
+	timeFrame := time.Duration(cfg.TimeFrameMs) * time.Millisecond
+	switch backend := f.cfg.Storage.SlidingWindowLog; backend {
+	case config.StorageMemory:
+		return f.metrics.SlidingWindowLogRepository(memory.NewSlidingWindowLogRepository(), backend), nil
+	case config.StorageRedis:
+		return f.metrics.SlidingWindowLogRepository(rdb.NewSlidingWindowLogRepository(f.client(f.cfg.Redis.SlidingWindowLogDb), timeFrame, f.keys(config.AlgorithmSlidingWindowLog)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmSlidingWindowLog, backend)
+	}
+}
+
+func (f *Factory) SlidingWindowCounterRepository(cfg config.SlidingWindowCounter) (service.SlidingWindowCounterRepository, error) {
+	timeFrame := time.Duration(cfg.TimeFrameMs) * time.Millisecond
+	switch backend := f.cfg.Storage.SlidingWindowCounter; backend {
+	case config.StorageMemory:
+		return f.metrics.SlidingWindowCounterRepository(memory.NewSlidingWindowCounterRepository(), backend), nil
+	case config.StorageRedis:
+		return f.metrics.SlidingWindowCounterRepository(rdb.NewSlidingWindowCounterRepository(f.client(f.cfg.Redis.SlidingWindowCounterDb), timeFrame, f.keys(config.AlgorithmSlidingWindowCounter)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmSlidingWindowCounter, backend)
+	}
+}
+
+func (f *Factory) GCRARepository() (service.GCRARepository, error) {
+	switch backend := f.cfg.Storage.GCRA; backend {
+	case config.StorageMemory:
+		return f.metrics.GCRARepository(memory.NewGCRARepository(), backend), nil
+	case config.StorageRedis:
+		return f.metrics.GCRARepository(rdb.NewGCRARepository(f.client(f.cfg.Redis.GCRADb), f.keys(config.AlgorithmGCRA)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmGCRA, backend)
+	}
+}
+
+func (f *Factory) LeakyBucketRepository(cfg config.LeakyBucket) (service.LeakyBucketRepository, error) {
+	switch backend := f.cfg.Storage.LeakyBucket; backend {
+	case config.StorageMemory:
+		return f.metrics.LeakyBucketRepository(memory.NewLeakyBucketRepository(), backend), nil
+	case config.StorageRedis:
+		return f.metrics.LeakyBucketRepository(rdb.NewLeakyBucketRepository(f.client(f.cfg.Redis.LeakyBucketDb), cfg.LeakRate, f.keys(config.AlgorithmLeakyBucket)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmLeakyBucket, backend)
+	}
+}
+
+func (f *Factory) ConcurrencyRepository() (service.ConcurrencyRepository, error) {
+	switch backend := f.cfg.Storage.Concurrency; backend {
+	case config.StorageMemory:
+		return f.metrics.ConcurrencyRepository(memory.NewConcurrencyRepository(), backend), nil
+	case config.StorageRedis:
+		return f.metrics.ConcurrencyRepository(rdb.NewConcurrencyRepository(f.client(f.cfg.Redis.ConcurrencyDb), f.keys(config.AlgorithmConcurrency)), backend), nil
+	default:
+		return nil, errUnknownBackend(config.AlgorithmConcurrency, backend)
+	}
+}
+
+// OverrideRepository keeps the limits the admin API sets for single clients
+// until they expire. A zero expiry time means the client has none.
+type OverrideRepository interface {
+	GetOverride(ctx context.Context, clientID string) (config.Limits, time.Time, error)
+	SaveOverride(ctx context.Context, clientID string, limits config.Limits, expiresAt time.Time) error
+	DeleteOverride(ctx context.Context, clientID string) (bool, error)
+}
+
+// OverrideRepository builds the store of the overrides of a policy using
+// algorithm. It keeps them on the backend and database of the policy's state,
+// so instances sharing the state in Redis share the overrides too.
+func (f *Factory) OverrideRepository(algorithm string) (OverrideRepository, error) {
+	backend, db := f.backend(algorithm)
+	switch backend {
+	case config.StorageMemory:
+		// Overrides are few and must not be evicted, so only the janitor
+		// of storage.memory applies.
+		repo := memory.NewOverrideRepository(memory.WithJanitor(time.Duration(f.cfg.Storage.Memory.JanitorIntervalMs) * time.Millisecond))
+		*f.janitors = append(*f.janitors, repo.Close)
+		return repo, nil
+	case config.StorageRedis:
+		return rdb.NewOverrideRepository(f.client(db), f.keys(algorithm)), nil
+	default:
+		return nil, errUnknownBackend(algorithm, backend)
+	}
+}
+
+// SetMetrics makes the factory instrument the repositories it builds from then
+// on.
+func (f *Factory) SetMetrics(m *metrics.Metrics) {
+	f.metrics = m
+}
+
+// Ping pings every Redis client the factory created and returns the outcome
+// per database, keyed "redis/db<n>". A factory keeping everything in memory
+// has nothing to check and returns an empty map.
+func (f *Factory) Ping(ctx context.Context) map[string]error {
+	results := make(map[string]error, len(f.clients))
+	for db, client := range f.clients {
+		results[checkName(db)] = client.Ping(ctx).Err()
+	}
+	return results
+}
+
+// CheckName returns the name Ping reports the store of algorithm under, or
+// false when the algorithm is kept in memory and there is nothing to check.
+func (f *Factory) CheckName(algorithm string) (string, bool) {
+	backend, db := f.backend(algorithm)
+	if backend != config.StorageRedis {
+		return "", false
+	}
+	if f.cfg.Redis.Mode == config.RedisModeCluster {
+		db = 0
+	}
+	return checkName(db), true
+}
+
+func checkName(db int) string {
+	return fmt.Sprintf("redis/db%d", db)
+}
+
+// Close stops the janitors of the in-memory repositories and closes every
+// Redis client the factory created.
+func (f *Factory) Close() error {
+	for _, stop := range *f.janitors {
+		stop()
+	}
+	*f.janitors = nil
+
+	var errs []error
+	for db, client := range f.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close redis db %d: %w", db, err))
+		}
+	}
+	clear(f.clients)
+	return errors.Join(errs...)
+}
+
+// client returns the Redis client for db, creating it on first use. A cluster
+// only has database 0, so every algorithm shares one client there.
+func (f *Factory) client(db int) redis.UniversalClient {
+	if f.cfg.Redis.Mode == config.RedisModeCluster {
+		db = 0
+	}
+	if client, ok := f.clients[db]; ok {
+		return client
+	}
+
+	client := newRedisClient(f.cfg.Redis, db)
+	if f.breaker != nil {
+		client.AddHook(f.breaker)
+	}
+	f.clients[db] = client
+	return client
+}
+
+// backend returns the backend the storage section picks for algorithm and the
+// Redis database it uses there.
+func (f *Factory) backend(algorithm string) (string, int) {
+	s, r := f.cfg.Storage, f.cfg.Redis
+	switch algorithm {
+	case config.AlgorithmFixedWindow:
+		return s.FixedWindow, r.FixedWindowDb
+	case config.AlgorithmTokenBucket:
+		return s.TokenBucket, r.TokenBucketDb
+	case config.AlgorithmSlidingWindowLog:
+		return s.SlidingWindowLog, r.SlidingWindowLogDb
+	case config.AlgorithmSlidingWindowCounter:
+		return s.SlidingWindowCounter, r.SlidingWindowCounterDb
+	case config.AlgorithmGCRA:
+		return s.GCRA, r.GCRADb
+	case config.AlgorithmLeakyBucket:
+		return s.LeakyBucket, r.LeakyBucketDb
+	case config.AlgorithmConcurrency:
+		return s.Concurrency, r.ConcurrencyDb
+	default:
+		return "", 0
+	}
+}
+
+// keys namespaces the Redis keys of algorithm as the redis key-schema says.
+func (f *Factory) keys(algorithm string) rdb.Option {
+	r := f.cfg.Redis
+	return rdb.WithKeys(rdb.NewKeys(r.KeySchema, r.KeyPrefix, algorithm, f.policy))
+}
+
+// memoryOptions bounds the in-memory repositories as the storage.memory
+// section says.
+func (f *Factory) memoryOptions() []memory.Option {
+	m := f.cfg.Storage.Memory
+	return []memory.Option{
+		memory.WithJanitor(time.Duration(m.JanitorIntervalMs) * time.Millisecond),
+		memory.WithMaxEntries(m.MaxEntries),
+	}
+}
+
+func errUnknownBackend(algorithm, backend string) error {
+	return domain.NewError(domain.ErrInvalidArgument, "unknown storage backend %q for %s", backend, algorithm)
+}
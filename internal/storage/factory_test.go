@@ -0,0 +1,249 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/domain"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/memory"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/rdb"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/service"
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/storage"
+)
+
+func newConfig(backend string) *config.Config {
+	return &config.Config{
+		Redis: config.Redis{Host: "localhost", Port: 6379},
+		Storage: config.Storage{
+			FixedWindow:          backend,
+			TokenBucket:          backend,
+			SlidingWindowLog:     backend,
+			SlidingWindowCounter: backend,
+			GCRA:                 backend,
+			LeakyBucket:          backend,
+			Concurrency:          backend,
+		},
+	}
+}
+
+func TestFactory_Memory(t *testing.T) {
+	f := storage.NewFactory(newConfig(config.StorageMemory))
+	defer f.Close()
+
+	fw, err := f.FixedWindowRepository()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := fw.(*memory.FixedWindowRepository); !ok {
+		t.Errorf("expected memory repository, got %T", fw)
+	}
+
+	cc, err := f.ConcurrencyRepository()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cc.(*memory.ConcurrencyRepository); !ok {
+		t.Errorf("expected memory repository, got %T", cc)
+	}
+}
+
+func TestFactory_Redis(t *testing.T) {
+	f := storage.NewFactory(newConfig(config.StorageRedis))
+	defer f.Close()
+
+	tb, err := f.TokenBucketRepository(config.TokenBucket{MaxTokens: 2, RefillRate: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := tb.(*rdb.TokenBucketRepository); !ok {
+		t.Errorf("expected redis repository, got %T", tb)
+	}
+
+	lb, err := f.LeakyBucketRepository(config.LeakyBucket{LeakRate: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := lb.(*rdb.LeakyBucketRepository); !ok {
+		t.Errorf("expected redis repository, got %T", lb)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("unexpected error closing clients: %v", err)
+	}
+}
+
+func TestFactory_Local(t *testing.T) {
+	f := storage.NewFactory(newConfig(config.StorageRedis))
+	defer f.Close()
+
+	tb, err := f.Local().TokenBucketRepository(config.TokenBucket{MaxTokens: 2, RefillRate: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := tb.(*memory.TokenBucketRepository); !ok {
+		t.Errorf("expected memory repository, got %T", tb)
+	}
+}
+
+func TestFactory_UnknownBackend(t *testing.T) {
+	f := storage.NewFactory(newConfig("postgres"))
+	defer f.Close()
+
+	_, err := f.GCRARepository()
+
+	var domainErr *domain.Error
+	if !errors.As(err, &domainErr) || domainErr.Code() != domain.ErrInvalidArgument {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
+
+func TestFactory_Ping(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := newConfig(config.StorageRedis)
+	cfg.Redis.Host, cfg.Redis.Port = "127.0.0.1", server.Server().Addr().Port
+	cfg.Redis.GCRADb = 4
+	f := storage.NewFactory(cfg)
+	defer f.Close()
+
+	if got := storage.NewFactory(newConfig(config.StorageMemory)).Ping(context.Background()); len(got) != 0 {
+		t.Errorf("expected nothing to check in memory, got %v", got)
+	}
+
+	f.FixedWindowRepository()
+	f.GCRARepository()
+	got := f.Ping(context.Background())
+	if len(got) != 2 || got["redis/db0"] != nil || got["redis/db4"] != nil {
+		t.Fatalf("expected db0 and db4 to answer, got %v", got)
+	}
+
+	server.Close()
+	if err := f.Ping(context.Background())["redis/db0"]; err == nil {
+		t.Errorf("expected an error once redis is gone")
+	}
+}
+
+func TestFactory_RedisCluster(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := newConfig(config.StorageRedis)
+	cfg.Redis.Mode = config.RedisModeCluster
+	cfg.Redis.Addrs = []string{server.Addr()}
+	cfg.Redis.GCRADb = 4
+	cfg.Redis.KeySchema = rdb.KeyClientID
+	f := storage.NewFactory(cfg)
+	defer f.Close()
+
+	repo, err := f.FixedWindowRepository()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.GCRARepository()
+
+	// A cluster only has database 0, which every algorithm shares.
+	got := f.Ping(context.Background())
+	if len(got) != 1 || got["redis/db0"] != nil {
+		t.Fatalf("expected one client for db0, got %v", got)
+	}
+
+	ctx := context.Background()
+	svc := service.NewFixedWindowService(repo, config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000})
+	if allowed, err := svc.Allow(ctx, "fw:alice"); err != nil || !allowed {
+		t.Fatalf("expected the first request through the cluster to be allowed, got %v, %v", allowed, err)
+	}
+	if clients, err := svc.Clients(ctx, "fw:"); err != nil || len(clients) != 1 || clients[0] != "fw:alice" {
+		t.Errorf("expected the cluster scan to find fw:alice, got %v, %v", clients, err)
+	}
+	if !server.Exists("{fw:alice}") {
+		t.Errorf("expected the key to carry its client ID as hash tag, got keys %v", server.Keys())
+	}
+}
+
+func TestFactory_RedisKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := newConfig(config.StorageRedis)
+	cfg.Redis.Host, cfg.Redis.Port = "127.0.0.1", server.Server().Addr().Port
+	cfg.Redis.KeyPrefix = "checkout"
+	cfg.Redis.KeySchema = rdb.DefaultKeySchema
+	f := storage.NewFactory(cfg)
+	defer f.Close()
+
+	ctx := context.Background()
+	windows, err := f.ForPolicy("api").FixedWindowRepository()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buckets, err := f.ForPolicy("api").TokenBucketRepository(config.TokenBucket{MaxTokens: 10, RefillRate: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fw := service.NewFixedWindowService(windows, config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000})
+	tb := service.NewTokenBucketService(buckets, config.TokenBucket{MaxTokens: 10, RefillRate: 1})
+	fw.Allow(ctx, "api:alice")
+	tb.Allow(ctx, "api:alice")
+
+	// Both algorithms share one database without their keys colliding.
+	for _, key := range []string{"checkout:fixed-window:api:{alice}", "checkout:token-bucket:api:{alice}"} {
+		if !server.Exists(key) {
+			t.Errorf("expected key %s, got keys %v", key, server.Keys())
+		}
+	}
+	if clients, err := fw.Clients(ctx, "api:"); err != nil || len(clients) != 1 || clients[0] != "api:alice" {
+		t.Errorf("expected the scan to find api:alice, got %v, %v", clients, err)
+	}
+}
+
+func TestFactory_OverridesShared(t *testing.T) {
+	server := miniredis.RunT(t)
+	cfg := newConfig(config.StorageRedis)
+	cfg.Redis.Host, cfg.Redis.Port = "127.0.0.1", server.Server().Addr().Port
+	cfg.Redis.KeyPrefix = "ratelimit"
+	cfg.Redis.KeySchema = rdb.DefaultKeySchema
+
+	// Two factories stand for two instances sharing the database.
+	ctx := context.Background()
+	a, b := storage.NewFactory(cfg), storage.NewFactory(cfg)
+	defer a.Close()
+	defer b.Close()
+	written, err := a.ForPolicy("api").OverrideRepository(config.AlgorithmFixedWindow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	read, err := b.ForPolicy("api").OverrideRepository(config.AlgorithmFixedWindow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limits := config.Limits{FixedWindow: &config.FixedWindow{MaxRequests: 50, TimeFrameMs: 60000}}
+	expiresAt := time.Now().Add(time.Minute).Round(0)
+	if err := written.SaveOverride(ctx, "api:alice", limits, expiresAt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, gotExpiry, err := read.GetOverride(ctx, "api:alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.FixedWindow == nil || got.FixedWindow.MaxRequests != 50 || !gotExpiry.Equal(expiresAt) {
+		t.Errorf("expected the override saved by the other instance, got %+v until %v", got, gotExpiry)
+	}
+
+	key := "ratelimit:fixed-window:api:{alice}:override"
+	if ttl := server.TTL(key); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("expected %s to expire with the override, got TTL %v (keys %v)", key, ttl, server.Keys())
+	}
+
+	// The override key stays out of the policy's client list.
+	windows, _ := b.ForPolicy("api").FixedWindowRepository()
+	if clients, err := service.NewFixedWindowService(windows, config.FixedWindow{MaxRequests: 1, TimeFrameMs: 60000}).Clients(ctx, "api:"); err != nil || len(clients) != 0 {
+		t.Errorf("expected no clients, got %v, %v", clients, err)
+	}
+
+	if found, err := read.DeleteOverride(ctx, "api:alice"); err != nil || !found {
+		t.Fatalf("expected the override to be deleted, got %v, %v", found, err)
+	}
+	if _, gotExpiry, _ := written.GetOverride(ctx, "api:alice"); !gotExpiry.IsZero() {
+		t.Errorf("expected no override after the delete, got one until %v", gotExpiry)
+	}
+}
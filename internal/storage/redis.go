@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/daverussell13/rate-limiter-doitpay-project/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisClient connects to db the way the redis section's mode says.
+func newRedisClient(cfg config.Redis, db int) redis.UniversalClient {
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled {
+		tlsConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ServerName:         cfg.TLS.ServerName,
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		}
+	}
+
+	switch cfg.Mode {
+	case config.RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               db,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+			TLSConfig:        tlsConfig,
+		})
+	case config.RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		})
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			DB:           db,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		})
+	}
+}